@@ -0,0 +1,366 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Access log formats
+const (
+	AccessLogCommon   = "common"
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+)
+
+// Match results reported in access log
+const (
+	MatchResultHit   = "hit"
+	MatchResultMiss  = "miss"
+	MatchResultError = "error"
+)
+
+// clfTimeFormat - time format used by Common Log Format
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// rotatedTimeFormat - suffix appended to rotated access log files
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+// rxRotatedSuffix - matches suffixes written by rotate, so other files next to the log aren't taken for backups.
+// Millisecond suffixes were written by earlier versions, "-N" is appended when the name is already taken.
+var rxRotatedSuffix = regexp.MustCompile(`^\.\d{8}T\d{6}\.(\d{3}|\d{9})(-\d+)?$`)
+
+// AccessLogEntry - single access log line
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Method     string    `json:"method"`
+	Host       string    `json:"host"`
+	URI        string    `json:"uri"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	// Bytes - response body length, -1 when unknown
+	Bytes     int64  `json:"bytes"`
+	Referer   string `json:"referer,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	Mode      string `json:"mode"`
+	Match     string `json:"match,omitempty"`
+	// Duration in milliseconds
+	Duration float64 `json:"duration"`
+}
+
+// newAccessLogEntry - creates access log entry for request processed by the proxy
+func newAccessLogEntry(req *http.Request, resp *http.Response, mode string, started time.Time) AccessLogEntry {
+	entry := AccessLogEntry{
+		Time:       started,
+		RemoteAddr: req.RemoteAddr,
+		Method:     req.Method,
+		Host:       req.Host,
+		URI:        req.URL.RequestURI(),
+		Proto:      req.Proto,
+		Referer:    req.Referer(),
+		UserAgent:  req.UserAgent(),
+		Mode:       mode,
+		Bytes:      -1,
+		Duration:   float64(time.Since(started)) / float64(time.Millisecond),
+	}
+
+	if resp == nil {
+		return entry
+	}
+
+	entry.Status = resp.StatusCode
+	entry.Bytes = resp.ContentLength
+	entry.Match = matchResult(resp, mode)
+	return entry
+}
+
+// matchResult - returns match result for response created by the proxy, empty when request wasn't
+// virtualized
+func matchResult(resp *http.Response, mode string) string {
+	if resp == nil {
+		return ""
+	}
+	if kind := resp.Header.Get(HoverflyErrorHeader); kind == ErrorKindMiss {
+		return MatchResultMiss
+	} else if kind != "" {
+		return MatchResultError
+	} else if mode == VirtualizeMode || mode == FuzzMode {
+		return MatchResultHit
+	}
+	return ""
+}
+
+// clfField - returns "-" for empty values as Common Log Format requires
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Format - formats entry as a single log line in given format
+func (e AccessLogEntry) Format(format string) ([]byte, error) {
+	if format == AccessLogJSON {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+
+	host := e.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	bytes := "-"
+	if e.Bytes >= 0 {
+		bytes = strconv.FormatInt(e.Bytes, 10)
+	}
+
+	line := fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s`,
+		clfField(host), e.Time.Format(clfTimeFormat), e.Method, e.URI, clfField(e.Proto), e.Status, bytes)
+
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(` "%s" "%s"`, clfField(e.Referer), clfField(e.UserAgent))
+	}
+
+	// Hoverfly specific fields are appended after standard ones
+	line += fmt.Sprintf(` "%s" "%s" %.3f`, clfField(e.Mode), clfField(e.Match), e.Duration)
+
+	return []byte(line + "\n"), nil
+}
+
+// ValidAccessLogFormat - checks whether given access log format is supported
+func ValidAccessLogFormat(format string) bool {
+	return format == AccessLogCommon || format == AccessLogCombined || format == AccessLogJSON
+}
+
+// AccessLogger - writes access log entries in configured format
+type AccessLogger struct {
+	Format string
+	out    io.Writer
+	mu     sync.Mutex
+}
+
+// NewAccessLogger - returns access logger writing to given writer
+func NewAccessLogger(out io.Writer, format string) *AccessLogger {
+	return &AccessLogger{Format: format, out: out}
+}
+
+// Log - writes entry to access log, it's safe to call on nil logger
+func (l *AccessLogger) Log(entry AccessLogEntry) {
+	if l == nil {
+		return
+	}
+
+	line, err := entry.Format(l.Format)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Failed to format access log entry")
+		return
+	}
+
+	l.mu.Lock()
+	_, err = l.out.Write(line)
+	l.mu.Unlock()
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Failed to write access log entry")
+	}
+}
+
+// NewAccessLoggerFromConfig - returns access logger configured by given configuration, "-" as
+// access log path writes to stdout. Returns nil logger when access log is not configured.
+func NewAccessLoggerFromConfig(cfg *Configuration) (*AccessLogger, error) {
+	if cfg.AccessLog == "" {
+		return nil, nil
+	}
+
+	format := cfg.AccessLogFormat
+	if format == "" {
+		format = AccessLogCombined
+	}
+	if !ValidAccessLogFormat(format) {
+		return nil, fmt.Errorf("unknown access log format '%s', use %s, %s or %s", format, AccessLogCommon, AccessLogCombined, AccessLogJSON)
+	}
+
+	if cfg.AccessLog == "-" {
+		return NewAccessLogger(os.Stdout, format), nil
+	}
+
+	rf, err := NewRotatingFile(cfg.AccessLog, int64(cfg.AccessLogMaxSize)*1024*1024, cfg.AccessLogRotateEvery,
+		cfg.AccessLogMaxBackups, cfg.AccessLogMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	return NewAccessLogger(rf, format), nil
+}
+
+// RotatingFile - file writer that rotates the file when it reaches maximum size or age and removes
+// rotated files beyond retention limits
+type RotatingFile struct {
+	Path string
+	// MaxSize in bytes, 0 disables size based rotation
+	MaxSize int64
+	// RotateEvery - file age after which it's rotated, 0 disables time based rotation
+	RotateEvery time.Duration
+	// MaxBackups - how many rotated files are kept, 0 keeps all
+	MaxBackups int
+	// MaxAge - rotated files older than this are removed, 0 keeps all
+	MaxAge time.Duration
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// NewRotatingFile - opens (or creates) file at given path for appending
+func NewRotatingFile(path string, maxSize int64, rotateEvery time.Duration, maxBackups int, maxAge time.Duration) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		Path:        path,
+		MaxSize:     maxSize,
+		RotateEvery: rotateEvery,
+		MaxBackups:  maxBackups,
+		MaxAge:      maxAge,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = info.Size()
+	rf.opened = time.Now()
+	return nil
+}
+
+// Write - writes to current file, rotating it first if needed
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	sizeExceeded := rf.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.MaxSize
+	ageExceeded := rf.RotateEvery > 0 && time.Since(rf.opened) >= rf.RotateEvery
+
+	if sizeExceeded || ageExceeded {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// Close - closes current file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
+
+// rotate - renames current file using timestamp suffix, opens a new one and applies retention
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+
+	rotated := fmt.Sprintf("%s.%s", rf.Path, time.Now().Format(rotatedTimeFormat))
+	// rotations within the same clock tick don't overwrite each other
+	for i := 1; ; i++ {
+		if taken, _ := exists(rotated); !taken {
+			break
+		}
+		rotated = fmt.Sprintf("%s.%s-%d", rf.Path, time.Now().Format(rotatedTimeFormat), i)
+	}
+	if err := os.Rename(rf.Path, rotated); err != nil {
+		return err
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	rf.removeOldBackups()
+	return nil
+}
+
+// backups - returns rotated files, oldest first
+func (rf *RotatingFile) backups() []string {
+	files, err := ioutil.ReadDir(filepath.Dir(rf.Path))
+	if err != nil {
+		return nil
+	}
+
+	base := filepath.Base(rf.Path)
+	var backups []string
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, base) || !rxRotatedSuffix.MatchString(name[len(base):]) {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(rf.Path), name))
+	}
+	// timestamp suffix sorts chronologically
+	sort.Strings(backups)
+	return backups
+}
+
+func (rf *RotatingFile) removeOldBackups() {
+	backups := rf.backups()
+
+	var remove []string
+	if rf.MaxBackups > 0 && len(backups) > rf.MaxBackups {
+		remove = append(remove, backups[:len(backups)-rf.MaxBackups]...)
+		backups = backups[len(backups)-rf.MaxBackups:]
+	}
+
+	if rf.MaxAge > 0 {
+		for _, b := range backups {
+			info, err := os.Stat(b)
+			if err == nil && time.Since(info.ModTime()) > rf.MaxAge {
+				remove = append(remove, b)
+			}
+		}
+	}
+
+	for _, b := range remove {
+		if err := os.Remove(b); err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+				"file":  b,
+			}).Warn("Failed to remove rotated access log")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAccessLogEntry() AccessLogEntry {
+	return AccessLogEntry{
+		Time:       time.Date(2016, 3, 10, 13, 55, 36, 0, time.UTC),
+		RemoteAddr: "127.0.0.1:52345",
+		Method:     "GET",
+		Host:       "example.com",
+		URI:        "/orders?page=2",
+		Proto:      "HTTP/1.1",
+		Status:     200,
+		Bytes:      2326,
+		UserAgent:  "curl/7.43.0",
+		Mode:       VirtualizeMode,
+		Match:      MatchResultHit,
+		Duration:   1.5,
+	}
+}
+
+func TestAccessLogCommonFormat(t *testing.T) {
+	line, err := testAccessLogEntry().Format(AccessLogCommon)
+	expect(t, err, nil)
+	expect(t, string(line), `127.0.0.1 - - [10/Mar/2016:13:55:36 +0000] "GET /orders?page=2 HTTP/1.1" 200 2326 "virtualize" "hit" 1.500`+"\n")
+}
+
+func TestAccessLogCombinedFormat(t *testing.T) {
+	entry := testAccessLogEntry()
+	entry.Bytes = -1
+
+	line, err := entry.Format(AccessLogCombined)
+	expect(t, err, nil)
+	expect(t, string(line), `127.0.0.1 - - [10/Mar/2016:13:55:36 +0000] "GET /orders?page=2 HTTP/1.1" 200 - "-" "curl/7.43.0" "virtualize" "hit" 1.500`+"\n")
+}
+
+func TestAccessLogJSONFormat(t *testing.T) {
+	line, err := testAccessLogEntry().Format(AccessLogJSON)
+	expect(t, err, nil)
+
+	var decoded AccessLogEntry
+	err = json.Unmarshal(line, &decoded)
+	expect(t, err, nil)
+	expect(t, decoded.Status, 200)
+	expect(t, decoded.Bytes, int64(2326))
+	expect(t, decoded.Mode, VirtualizeMode)
+	expect(t, decoded.Match, MatchResultHit)
+}
+
+func TestAccessLogVirtualizeHitAndMiss(t *testing.T) {
+	server, dbClient := testTools(201, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	var buf bytes.Buffer
+	dbClient.AccessLog = NewAccessLogger(&buf, AccessLogJSON)
+	dbClient.Cfg.SetMode(VirtualizeMode)
+
+	err := dbClient.ImportPayloads([]Payload{
+		{
+			Request:  RequestDetails{Destination: "logged.com", Path: "/", Method: "GET"},
+			Response: ResponseDetails{Status: 200, Body: "here"},
+		},
+	})
+	expect(t, err, nil)
+
+	r, _ := http.NewRequest("GET", "http://logged.com/", nil)
+	dbClient.processRequest(r)
+
+	missing, _ := http.NewRequest("GET", "http://logged.com/missing", nil)
+	dbClient.processRequest(missing)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expect(t, len(lines), 2)
+
+	var hit, miss AccessLogEntry
+	expect(t, json.Unmarshal([]byte(lines[0]), &hit), nil)
+	expect(t, json.Unmarshal([]byte(lines[1]), &miss), nil)
+
+	expect(t, hit.Match, MatchResultHit)
+	expect(t, hit.Status, 200)
+	expect(t, hit.Bytes, int64(4))
+	expect(t, hit.URI, "/")
+
+	expect(t, miss.Match, MatchResultMiss)
+	expect(t, miss.URI, "/missing")
+	expect(t, miss.Mode, VirtualizeMode)
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	rf, err := NewRotatingFile(path, 10, 0, 2, 0)
+	expect(t, err, nil)
+	defer rf.Close()
+
+	// files next to the log aren't backups
+	for _, other := range []string{"access.log.old", "access.log.json", "access.log.20200101T000000.000.gz"} {
+		expect(t, ioutil.WriteFile(filepath.Join(dir, other), []byte("keep"), 0600), nil)
+	}
+
+	// rotations within the same clock tick get unique names
+	for i := 0; i < 5; i++ {
+		_, err := rf.Write([]byte("12345678\n"))
+		expect(t, err, nil)
+	}
+
+	// only configured number of backups is kept
+	backups := rf.backups()
+	expect(t, len(backups), 2)
+	for _, other := range []string{"access.log.old", "access.log.json", "access.log.20200101T000000.000.gz"} {
+		_, err := os.Stat(filepath.Join(dir, other))
+		expect(t, err, nil)
+	}
+
+	current, err := ioutil.ReadFile(path)
+	expect(t, err, nil)
+	expect(t, string(current), "12345678\n")
+
+	// without retention every rotation is kept
+	unlimited, err := NewRotatingFile(filepath.Join(dir, "unlimited.log"), 10, 0, 0, 0)
+	expect(t, err, nil)
+	defer unlimited.Close()
+	for i := 0; i < 5; i++ {
+		_, err := unlimited.Write([]byte("12345678\n"))
+		expect(t, err, nil)
+	}
+	expect(t, len(unlimited.backups()), 4)
+}
+
+func TestRotatingFileRotatesByAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	expect(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	rf, err := NewRotatingFile(path, 0, time.Millisecond, 0, 0)
+	expect(t, err, nil)
+	defer rf.Close()
+
+	rf.Write([]byte("first\n"))
+	time.Sleep(5 * time.Millisecond)
+	rf.Write([]byte("second\n"))
+
+	expect(t, len(rf.backups()), 1)
+
+	current, err := ioutil.ReadFile(path)
+	expect(t, err, nil)
+	expect(t, string(current), "second\n")
+}
+
+func TestNewAccessLoggerFromConfig(t *testing.T) {
+	logger, err := NewAccessLoggerFromConfig(&Configuration{})
+	expect(t, err, nil)
+	expect(t, logger, (*AccessLogger)(nil))
+
+	_, err = NewAccessLoggerFromConfig(&Configuration{AccessLog: "-", AccessLogFormat: "apache"})
+	refute(t, err, nil)
+}
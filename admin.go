@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	// static assets
@@ -36,11 +37,31 @@ type recordsCount struct {
 type statsResponse struct {
 	Stats        Stats `json:"stats"`
 	RecordsCount int   `json:"recordsCount"`
+	// Delta - requests since previous websocket message
+	Delta []StatsDelta `json:"delta,omitempty"`
+}
+
+type statsBreakdownResponse struct {
+	Window string           `json:"window"`
+	Data   []BreakdownEntry `json:"data"`
 }
 
 type stateRequest struct {
 	Mode        string `json:"mode"`
 	Destination string `json:"destination"`
+	// Locked - only reported, simulation is locked through "/lock"
+	Locked bool `json:"locked"`
+}
+
+type waitRequest struct {
+	Matcher RequestMatcher `json:"matcher"`
+	// Timeout in milliseconds
+	Timeout int       `json:"timeout"`
+	Since   time.Time `json:"since"`
+}
+
+type journalResponse struct {
+	Data []JournalEntry `json:"data"`
 }
 
 type messageResponse struct {
@@ -103,6 +124,11 @@ func getBoneRouter(d DBClient) *bone.Mux {
 		negroni.HandlerFunc(d.AllRecordsHandler),
 	))
 
+	mux.Get("/records/export", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.ExportRecordsHandler),
+	))
+
 	mux.Delete("/records", negroni.New(
 		negroni.HandlerFunc(am.RequireTokenAuthentication),
 		negroni.HandlerFunc(d.DeleteAllRecordsHandler),
@@ -120,9 +146,30 @@ func getBoneRouter(d DBClient) *bone.Mux {
 		negroni.HandlerFunc(am.RequireTokenAuthentication),
 		negroni.HandlerFunc(d.StatsHandler),
 	))
+	mux.Delete("/stats", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.ResetStatsHandler),
+	))
+	mux.Get("/stats/breakdown", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.StatsBreakdownHandler),
+	))
 	// TODO: check auth for websocket connection
 	mux.Get("/statsws", http.HandlerFunc(d.StatsWSHandler))
 
+	mux.Get("/lock", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.LockHandler),
+	))
+	mux.Post("/lock", negroni.New(
+		negroni.HandlerFunc(am.RequireAdmin),
+		negroni.HandlerFunc(d.SetLockHandler),
+	))
+	mux.Delete("/lock", negroni.New(
+		negroni.HandlerFunc(am.RequireAdmin),
+		negroni.HandlerFunc(d.DeleteLockHandler),
+	))
+
 	mux.Get("/state", negroni.New(
 		negroni.HandlerFunc(am.RequireTokenAuthentication),
 		negroni.HandlerFunc(d.CurrentStateHandler),
@@ -137,6 +184,111 @@ func getBoneRouter(d DBClient) *bone.Mux {
 		negroni.HandlerFunc(d.ManualAddHandler),
 	))
 
+	mux.Post("/payloads", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.AuthorPayloadHandler),
+	))
+
+	mux.Post("/batch", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.BatchHandler),
+	))
+
+	mux.Get("/replication", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.ReplicationStatusHandler),
+	))
+	mux.Get("/replication/changes", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.ReplicationChangesHandler),
+	))
+	mux.Post("/replication/changes", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.ApplyReplicationChangesHandler),
+	))
+
+	mux.Post("/registry/publish", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.PublishSimulationHandler),
+	))
+	mux.Post("/registry/import", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.ImportSimulationHandler),
+	))
+
+	mux.Post("/match", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.MatchHandler),
+	))
+
+	mux.Post("/wait", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.WaitForRequestHandler),
+	))
+
+	mux.Get("/journal", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.JournalHandler),
+	))
+	mux.Delete("/journal", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.DeleteJournalHandler),
+	))
+
+	mux.Get("/error-templates", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.ErrorTemplatesHandler),
+	))
+	mux.Post("/error-templates", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.SetErrorTemplatesHandler),
+	))
+
+	mux.Get("/response-schemas", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.ResponseSchemasHandler),
+	))
+	mux.Post("/response-schemas", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.SetResponseSchemasHandler),
+	))
+
+	mux.Get("/sessions", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.SessionsHandler),
+	))
+	mux.Delete("/sessions", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.DeleteSessionsHandler),
+	))
+
+	mux.Get("/static-rules", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.StaticRulesHandler),
+	))
+	mux.Post("/static-rules", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.SetStaticRulesHandler),
+	))
+
+	mux.Get("/logging", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.LogLevelsHandler),
+	))
+	mux.Post("/logging", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.SetLogLevelsHandler),
+	))
+	mux.Get("/logs", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.LogsHandler),
+	))
+
+	mux.Get("/diagnostics", negroni.New(
+		negroni.HandlerFunc(am.RequireTokenAuthentication),
+		negroni.HandlerFunc(d.DiagnosticsHandler),
+	))
+
 	if d.Cfg.Development {
 		// since hoverfly is not started from cmd/hoverfly/hoverfly
 		// we have to target to that directory
@@ -157,6 +309,22 @@ func getBoneRouter(d DBClient) *bone.Mux {
 	return mux
 }
 
+// ExportRecordsHandler returns zip bundle with all records and body files they reference
+func (d *DBClient) ExportRecordsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var buf bytes.Buffer
+	if err := d.WriteSimulationBundle(&buf); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Failed to export records")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=simulation.zip")
+	w.Write(buf.Bytes())
+}
+
 // AllRecordsHandler returns JSON content type http response
 func (d *DBClient) AllRecordsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
 	records, err := d.Cache.GetAllRequests()
@@ -246,6 +414,60 @@ func (d *DBClient) StatsHandler(w http.ResponseWriter, req *http.Request, next h
 
 }
 
+// ResetStatsHandler - resets request counters, latencies and windowed stats
+func (d *DBClient) ResetStatsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	d.Counter.Reset()
+
+	log.Info("stats reset")
+
+	var response messageResponse
+	response.Message = "Stats reset successfuly"
+
+	b, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// StatsBreakdownHandler - returns request counts and latency percentiles per destination, path template and
+// status class within a rolling window (1m, 5m or 1h, supplied as "window" query parameter)
+func (d *DBClient) StatsBreakdownHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	window := req.URL.Query().Get("window")
+	if window == "" {
+		window = "1m"
+	}
+
+	duration, ok := StatsWindows[window]
+	if !ok {
+		http.Error(w, "Bad window supplied, use 1m, 5m or 1h.", 400)
+		return
+	}
+
+	var response statsBreakdownResponse
+	response.Window = window
+	response.Data = d.Counter.Windows.Breakdown(duration, time.Now())
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// vetoed - responds to admin request rejected by "before" hook
+func vetoed(w http.ResponseWriter, err error) {
+	var response messageResponse
+	response.Message = err.Error()
+
+	b, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write(b)
+}
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -271,6 +493,8 @@ func (d *DBClient) StatsWSHandler(w http.ResponseWriter, r *http.Request) {
 			"message": string(p),
 		}).Info("Got message...")
 
+		totals := d.Counter.Windows.Totals()
+
 		for _ = range time.Tick(1 * time.Second) {
 
 			count, err := d.Cache.RecordsCount()
@@ -285,9 +509,13 @@ func (d *DBClient) StatsWSHandler(w http.ResponseWriter, r *http.Request) {
 
 			stats := d.Counter.Flush()
 
+			current := d.Counter.Windows.Totals()
+
 			var sr statsResponse
 			sr.Stats = stats
 			sr.RecordsCount = count
+			sr.Delta = statsDeltas(totals, current)
+			totals = current
 
 			b, err := json.Marshal(sr)
 
@@ -306,6 +534,9 @@ func (d *DBClient) StatsWSHandler(w http.ResponseWriter, r *http.Request) {
 
 // ImportRecordsHandler - accepts JSON payload and saves it to cache
 func (d *DBClient) ImportRecordsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	if d.rejectLocked(w) {
+		return
+	}
 
 	var requests recordedRequests
 
@@ -346,8 +577,13 @@ func (d *DBClient) ImportRecordsHandler(w http.ResponseWriter, req *http.Request
 
 }
 
-// ManualAddHandler - manually add new request/responses, using a form
+// ManualAddHandler - manually add new request/responses, using a form. Payloads with headers or scheme can be
+// added as JSON with AuthorPayloadHandler.
 func (d *DBClient) ManualAddHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	if d.rejectLocked(w) {
+		return
+	}
+
 	err := req.ParseForm()
 
 	if err != nil {
@@ -400,12 +636,17 @@ func (d *DBClient) ManualAddHandler(w http.ResponseWriter, req *http.Request, ne
 	}).Info("manually adding request/response")
 
 	p := Payload{Request: preq, Response: presp}
+	applyPayloadDefaults(&p)
 
-	var pls []Payload
-
-	pls = append(pls, p)
-
-	err = d.ImportPayloads(pls)
+	if errs := d.validatePayload(p); len(errs) > 0 {
+		var messages []string
+		for _, e := range errs {
+			messages = append(messages, e.Field+": "+e.Message)
+		}
+		err = fmt.Errorf("%s", strings.Join(messages, ", "))
+	} else {
+		_, err = d.importPayload(p, nil)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	var response messageResponse
@@ -432,19 +673,44 @@ func (d *DBClient) ManualAddHandler(w http.ResponseWriter, req *http.Request, ne
 
 // DeleteAllRecordsHandler - deletes all captured requests
 func (d *DBClient) DeleteAllRecordsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
-	err := d.Cache.DeleteData()
+	if d.rejectLocked(w) {
+		return
+	}
 
-	var en Entry
-	en.ActionType = ActionTypeWipeDB
-	en.Message = "wipe"
-	en.Time = time.Now()
+	before := Entry{
+		ActionType: ActionTypeBeforeWipeDB,
+		Message:    "wipe",
+		Time:       time.Now(),
+		Mode:       d.Cfg.GetMode(),
+	}
+	if err := d.fireBeforeHooks(&before); err != nil {
+		vetoed(w, err)
+		return
+	}
 
-	if err := d.Hooks.Fire(ActionTypeWipeDB, &en); err != nil {
-		log.WithFields(log.Fields{
-			"error":      err.Error(),
-			"message":    en.Message,
-			"actionType": ActionTypeWipeDB,
-		}).Error("failed to fire hook")
+	unlock := d.lockRecords()
+	blobsMu.Lock()
+	err := d.Cache.DeleteData()
+
+	if d.Bodies != nil {
+		if blobErr := d.Bodies.DeleteBlobs(); blobErr != nil {
+			log.WithFields(log.Fields{
+				"error": blobErr.Error(),
+			}).Error("Failed to delete response body blobs")
+		}
+	}
+	blobsMu.Unlock()
+	unlock()
+
+	// records are still there when wipe failed
+	if err == nil || err.Error() == "bucket not found" {
+		var en Entry
+		en.ActionType = ActionTypeWipeDB
+		en.Message = "wipe"
+		en.Time = time.Now()
+		en.Mode = d.Cfg.GetMode()
+
+		d.fireHooks(&en)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -473,6 +739,7 @@ func (d *DBClient) CurrentStateHandler(w http.ResponseWriter, req *http.Request,
 	var resp stateRequest
 	resp.Mode = d.Cfg.GetMode()
 	resp.Destination = d.Cfg.Destination
+	resp.Locked = d.Cfg.IsLocked()
 
 	b, _ := json.Marshal(resp)
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -481,6 +748,10 @@ func (d *DBClient) CurrentStateHandler(w http.ResponseWriter, req *http.Request,
 
 // StateHandler handles current proxy state
 func (d *DBClient) StateHandler(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if d.rejectLocked(w) {
+		return
+	}
+
 	var sr stateRequest
 
 	// this is mainly for testing, since when you create
@@ -513,16 +784,38 @@ func (d *DBClient) StateHandler(w http.ResponseWriter, r *http.Request, next htt
 		"capture":    true,
 		"modify":     true,
 		"synthesize": true,
+		"fuzz":       true,
 	}
 
 	if !availableModes[sr.Mode] {
 		log.WithFields(log.Fields{
 			"suppliedMode": sr.Mode,
 		}).Error("Wrong mode found, can't change state")
-		http.Error(w, "Bad mode supplied, available modes: virtualize, capture, modify, synthesize.", 400)
+		http.Error(w, "Bad mode supplied, available modes: virtualize, capture, modify, synthesize, fuzz.", 400)
+		return
+	}
+
+	before := Entry{
+		ActionType: ActionTypeBeforeConfigurationChange,
+		Message:    "change",
+		Time:       time.Now(),
+		Data:       []byte(sr.Mode),
+		Mode:       d.Cfg.GetMode(),
+	}
+	if err := d.fireBeforeHooks(&before); err != nil {
+		vetoed(w, err)
 		return
 	}
 
+	// hooks can change requested mode
+	if string(before.Data) != sr.Mode {
+		sr.Mode = string(before.Data)
+		if !availableModes[sr.Mode] {
+			http.Error(w, fmt.Sprintf("Hook changed mode to '%s' which is not available.", sr.Mode), 400)
+			return
+		}
+	}
+
 	log.WithFields(log.Fields{
 		"newState": sr.Mode,
 		"body":     string(body),
@@ -535,21 +828,568 @@ func (d *DBClient) StateHandler(w http.ResponseWriter, r *http.Request, next htt
 	en.ActionType = ActionTypeConfigurationChanged
 	en.Message = "changed"
 	en.Time = time.Now()
-	en.Data = []byte("sr.Mode")
+	en.Data = []byte(sr.Mode)
+	en.Mode = sr.Mode
 
-	if err := d.Hooks.Fire(ActionTypeConfigurationChanged, &en); err != nil {
-		log.WithFields(log.Fields{
-			"error":      err.Error(),
-			"message":    en.Message,
-			"actionType": ActionTypeConfigurationChanged,
-		}).Error("failed to fire hook")
-	}
+	d.fireHooks(&en)
 
 	var resp stateRequest
 	resp.Mode = d.Cfg.GetMode()
 	resp.Destination = d.Cfg.Destination
+	resp.Locked = d.Cfg.IsLocked()
 	b, _ := json.Marshal(resp)
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.Write(b)
 
 }
+
+// MatchHandler - accepts request details and explains which payload would be served for them,
+// nothing is sent through the proxy
+func (d *DBClient) MatchHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var details RequestDetails
+
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Could not read request body!")
+		http.Error(w, "Failed to read request body.", 400)
+		return
+	}
+
+	err = json.Unmarshal(body, &details)
+
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(422) // can't process this entity
+		return
+	}
+
+	explanation, err := d.ExplainMatch(details)
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Failed to explain match")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	b, err := json.Marshal(explanation)
+
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// WaitForRequestHandler - blocks until request matching supplied matcher goes through the proxy
+// or timeout elapses, returns observed request details
+func (d *DBClient) WaitForRequestHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var wr waitRequest
+
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	var response messageResponse
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Could not read request body!")
+		http.Error(w, "Failed to read request body.", 400)
+		return
+	}
+
+	err = json.Unmarshal(body, &wr)
+
+	if err != nil {
+		w.WriteHeader(422) // can't process this entity
+		return
+	}
+
+	timeout := DefaultWaitTimeout
+	if wr.Timeout > 0 {
+		timeout = time.Duration(wr.Timeout) * time.Millisecond
+	}
+	if timeout > MaxWaitTimeout {
+		timeout = MaxWaitTimeout
+	}
+
+	log.WithFields(log.Fields{
+		"matcher": wr.Matcher,
+		"timeout": timeout.String(),
+	}).Debug("waiting for request")
+
+	observed, err := d.Notifier.Wait(req.Context(), wr.Matcher, wr.Since, timeout)
+
+	if err != nil && req.Context().Err() != nil {
+		// client went away, nobody is waiting for the response
+		return
+	} else if err == ErrWaitTimeout {
+		response.Message = err.Error()
+		w.WriteHeader(http.StatusRequestTimeout)
+		b, _ := json.Marshal(response)
+		w.Write(b)
+		return
+	} else if err != nil {
+		response.Message = err.Error()
+		w.WriteHeader(400)
+		b, _ := json.Marshal(response)
+		w.Write(b)
+		return
+	}
+
+	b, err := json.Marshal(observed)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(b)
+}
+
+// JournalHandler - returns journal entries, optionally filtered by "type" and limited by "limit" query parameters
+func (d *DBClient) JournalHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	limit := 0
+	if l := req.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			http.Error(w, "Bad limit supplied, it should be a number.", 400)
+			return
+		}
+	}
+
+	var response journalResponse
+	response.Data = d.Journal.Entries(req.URL.Query().Get("type"), limit)
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// DeleteJournalHandler - removes all journal entries
+func (d *DBClient) DeleteJournalHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	d.Journal.Delete()
+
+	var response messageResponse
+	response.Message = "Journal deleted successfuly"
+
+	b, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// SessionsHandler - returns sessions simulated in virtualize mode
+func (d *DBClient) SessionsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	response := sessionsResponse{Data: []SimulatedSession{}}
+	if d.Sessions != nil {
+		response.Data = d.Sessions.Sessions()
+	}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// DeleteSessionsHandler - removes simulated sessions, so clients start without cookies issued before
+func (d *DBClient) DeleteSessionsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	if d.Sessions != nil {
+		d.Sessions.Reset()
+	}
+
+	var response messageResponse
+	response.Message = "Sessions deleted successfuly"
+
+	b, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// ErrorTemplatesHandler returns currently configured error templates
+func (d *DBClient) ErrorTemplatesHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var response errorTemplates
+	response.Data = d.Cfg.GetErrorTemplates()
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// SetErrorTemplatesHandler replaces error templates with the ones supplied in request body
+func (d *DBClient) SetErrorTemplatesHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var templates errorTemplates
+
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	var response messageResponse
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Could not read request body!")
+		http.Error(w, "Failed to read request body.", 400)
+		return
+	}
+
+	err = json.Unmarshal(body, &templates)
+
+	if err != nil {
+		w.WriteHeader(422) // can't process this entity
+		return
+	}
+
+	for i := range templates.Data {
+		if err := templates.Data[i].Validate(); err != nil {
+			response.Message = fmt.Sprintf("Error template %d is not valid: %s", i, err.Error())
+			w.WriteHeader(400)
+			b, _ := json.Marshal(response)
+			w.Write(b)
+			return
+		}
+	}
+
+	d.Cfg.SetErrorTemplates(templates.Data)
+
+	log.WithFields(log.Fields{
+		"count": len(templates.Data),
+	}).Info("error templates updated")
+
+	response.Message = fmt.Sprintf("%d error templates set.", len(templates.Data))
+	b, _ := json.Marshal(response)
+	w.Write(b)
+}
+
+// ResponseSchemasHandler returns currently configured response schemas
+func (d *DBClient) ResponseSchemasHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var response responseSchemas
+	response.Data = d.Cfg.GetResponseSchemas()
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// SetResponseSchemasHandler replaces response schemas used in synthesize mode with the ones supplied in request body
+func (d *DBClient) SetResponseSchemasHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var schemas responseSchemas
+
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	var response messageResponse
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Could not read request body!")
+		http.Error(w, "Failed to read request body.", 400)
+		return
+	}
+
+	err = json.Unmarshal(body, &schemas)
+
+	if err != nil {
+		w.WriteHeader(422) // can't process this entity
+		return
+	}
+
+	for i := range schemas.Data {
+		if err := schemas.Data[i].Validate(); err != nil {
+			response.Message = fmt.Sprintf("Response schema %d is not valid: %s", i, err.Error())
+			w.WriteHeader(400)
+			b, _ := json.Marshal(response)
+			w.Write(b)
+			return
+		}
+	}
+
+	d.Cfg.SetResponseSchemas(schemas.Data)
+
+	log.WithFields(log.Fields{
+		"count": len(schemas.Data),
+	}).Info("response schemas updated")
+
+	response.Message = fmt.Sprintf("%d response schemas set.", len(schemas.Data))
+	b, _ := json.Marshal(response)
+	w.Write(b)
+}
+
+// StaticRulesHandler returns currently configured static directory rules
+func (d *DBClient) StaticRulesHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var response staticRules
+	response.Data = d.Cfg.GetStaticRules()
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// SetStaticRulesHandler replaces static directory rules with the ones supplied in request body
+func (d *DBClient) SetStaticRulesHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var rules staticRules
+
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	var response messageResponse
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Could not read request body!")
+		http.Error(w, "Failed to read request body.", 400)
+		return
+	}
+
+	err = json.Unmarshal(body, &rules)
+
+	if err != nil {
+		w.WriteHeader(422) // can't process this entity
+		return
+	}
+
+	// admin API can't expose arbitrary directories of the host
+	if d.Cfg.StaticRoot == "" {
+		response.Message = "Static rules can only be set through the API when static root is configured (-static-root)"
+		w.WriteHeader(http.StatusForbidden)
+		b, _ := json.Marshal(response)
+		w.Write(b)
+		return
+	}
+
+	for i := range rules.Data {
+		if err := rules.Data[i].confine(d.Cfg.StaticRoot); err != nil {
+			response.Message = fmt.Sprintf("Static rule %d is not valid: %s", i, err.Error())
+			w.WriteHeader(400)
+			b, _ := json.Marshal(response)
+			w.Write(b)
+			return
+		}
+		if err := rules.Data[i].Validate(); err != nil {
+			response.Message = fmt.Sprintf("Static rule %d is not valid: %s", i, err.Error())
+			w.WriteHeader(400)
+			b, _ := json.Marshal(response)
+			w.Write(b)
+			return
+		}
+	}
+
+	d.Cfg.SetStaticRules(rules.Data)
+
+	log.WithFields(log.Fields{
+		"count": len(rules.Data),
+	}).Info("static rules updated")
+
+	response.Message = fmt.Sprintf("%d static rules set.", len(rules.Data))
+	b, _ := json.Marshal(response)
+	w.Write(b)
+}
+
+// LogLevelsHandler returns global log level and effective log level of each component
+func (d *DBClient) LogLevelsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	response := logLevelsRequest{
+		Level:      d.Logging.Level().String(),
+		Components: make(map[string]string),
+	}
+	for c, level := range d.Logging.ComponentLevels() {
+		response.Components[c] = level.String()
+	}
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// SetLogLevelsHandler changes global and component log levels without restarting Hoverfly. Setting empty
+// component level makes it follow global level again.
+func (d *DBClient) SetLogLevelsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var levels logLevelsRequest
+
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	var response messageResponse
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Could not read request body!")
+		http.Error(w, "Failed to read request body.", 400)
+		return
+	}
+
+	err = json.Unmarshal(body, &levels)
+
+	if err != nil {
+		w.WriteHeader(422) // can't process this entity
+		return
+	}
+
+	badRequest := func(msg string) {
+		response.Message = msg
+		w.WriteHeader(400)
+		b, _ := json.Marshal(response)
+		w.Write(b)
+	}
+
+	// validating everything first so invalid request doesn't change anything
+	var global log.Level
+	if levels.Level != "" {
+		if global, err = log.ParseLevel(levels.Level); err != nil {
+			badRequest(err.Error())
+			return
+		}
+	}
+
+	components := make(map[string]log.Level)
+	for c, l := range levels.Components {
+		if !validLogComponent(c) {
+			badRequest(fmt.Sprintf("Unknown log component '%s', use one of: %s", c, strings.Join(LogComponents, ", ")))
+			return
+		}
+		if l == "" {
+			continue
+		}
+		if components[c], err = log.ParseLevel(l); err != nil {
+			badRequest(err.Error())
+			return
+		}
+	}
+
+	if levels.Level != "" {
+		d.Logging.SetLevel(global)
+	}
+	for c, l := range levels.Components {
+		if l == "" {
+			d.Logging.ResetComponentLevel(c)
+		} else {
+			d.Logging.SetComponentLevel(c, components[c])
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"level":      levels.Level,
+		"components": levels.Components,
+	}).Warn("log levels changed")
+
+	response.Message = "Log levels changed"
+	b, _ := json.Marshal(response)
+	w.Write(b)
+}
+
+// LogsHandler returns recent log entries, optionally filtered by minimum level, component and limited
+// to given number of most recent entries
+func (d *DBClient) LogsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	query := req.URL.Query()
+
+	limit := 0
+	if l := query.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil {
+			http.Error(w, "Bad limit supplied, it should be a number.", 400)
+			return
+		}
+	}
+
+	level := log.DebugLevel
+	if l := query.Get("level"); l != "" {
+		var err error
+		level, err = log.ParseLevel(l)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+	}
+
+	component := query.Get("component")
+	if component != "" && !validLogComponent(component) {
+		http.Error(w, fmt.Sprintf("Unknown log component '%s'", component), 400)
+		return
+	}
+
+	var response logsResponse
+	response.Data = d.Logging.Entries(level, component, limit)
+
+	b, err := json.Marshal(response)
+	if err != nil {
+		log.Error(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// DiagnosticsHandler returns zip bundle with configuration (secrets redacted), stats, recent logs, goroutine dump,
+// database stats, recent journal entries and version info
+func (d *DBClient) DiagnosticsHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var buf bytes.Buffer
+
+	err := d.WriteDiagnostics(&buf)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Failed to create diagnostics bundle")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("hoverfly-diagnostics-%s.zip", time.Now().Format("20060102-150405"))
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
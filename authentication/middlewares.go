@@ -42,3 +42,33 @@ func (a *AuthMiddleware) RequireTokenAuthentication(w http.ResponseWriter, req *
 		w.WriteHeader(http.StatusUnauthorized)
 	}
 }
+
+// RequireAdmin - allows only requests with a token of an admin user, when auth is disabled all requests are allowed
+func (a *AuthMiddleware) RequireAdmin(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	if !a.Enabled {
+		next(w, req)
+		return
+	}
+
+	authBackend := InitJWTAuthenticationBackend(a.AB, a.SecretKey, a.JWTExpirationDelta)
+
+	token, err := jwt.ParseFromRequest(req, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return authBackend.SecretKey, nil
+	})
+
+	if err != nil || !token.Valid || authBackend.IsInBlacklist(req.Header.Get("Authorization")) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	username, _ := token.Claims["username"].(string)
+	user, err := a.AB.GetUser([]byte(username))
+	if err != nil || !user.IsAdmin {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	next(w, req)
+}
@@ -0,0 +1,318 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// PayloadFieldError - validation error of a single payload field, Field is a JSON path, e.g. "request.method"
+type PayloadFieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// payloadAuthoring - payload authored through the admin API
+type payloadAuthoring struct {
+	// Template - key of stored payload used as a base, fields supplied in Payload override it
+	Template string          `json:"template,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+	// DryRun - payload is only validated and its fingerprint returned
+	DryRun bool `json:"dryRun,omitempty"`
+	// Test - payload request is sent through the matching pipeline
+	Test bool `json:"test,omitempty"`
+}
+
+// PayloadTestResult - response Hoverfly gives to authored payload request in virtualize mode
+type PayloadTestResult struct {
+	Matched bool `json:"matched"`
+	// MatchedAuthored - request matched the authored payload and not a different one
+	MatchedAuthored bool             `json:"matchedAuthored"`
+	Matcher         string           `json:"matcher,omitempty"`
+	Key             string           `json:"key,omitempty"`
+	Response        *ResponseDetails `json:"response,omitempty"`
+	Error           string           `json:"error,omitempty"`
+}
+
+type payloadAuthoringResponse struct {
+	Fingerprint string              `json:"fingerprint,omitempty"`
+	Stored      bool                `json:"stored"`
+	Payload     *Payload            `json:"payload,omitempty"`
+	Errors      []PayloadFieldError `json:"errors,omitempty"`
+	Test        *PayloadTestResult  `json:"test,omitempty"`
+	Message     string              `json:"message,omitempty"`
+}
+
+// authorPayload - decodes authored payload on top of template payload (if any)
+func (d *DBClient) authorPayload(template string, raw json.RawMessage) (pl Payload, errs []PayloadFieldError) {
+	if template != "" {
+		bts, err := d.Cache.Get([]byte(template))
+		if err != nil {
+			return pl, []PayloadFieldError{{Field: "template", Message: fmt.Sprintf("payload '%s' not found", template)}}
+		}
+		base, err := decodePayload(bts)
+		if err != nil {
+			return pl, []PayloadFieldError{{Field: "template", Message: err.Error()}}
+		}
+		pl = *base
+		pl.ID = ""
+	}
+
+	if len(raw) == 0 {
+		if template == "" {
+			errs = append(errs, PayloadFieldError{Field: "payload", Message: "payload or template is required"})
+		}
+		return pl, errs
+	}
+
+	if err := json.Unmarshal(raw, &pl); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok && typeErr.Field != "" {
+			return pl, []PayloadFieldError{{Field: typeErr.Field, Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}}
+		}
+		return pl, []PayloadFieldError{{Field: "payload", Message: err.Error()}}
+	}
+	return pl, nil
+}
+
+// applyPayloadDefaults - fills in fields authored payloads usually omit
+func applyPayloadDefaults(pl *Payload) {
+	pl.Request.Method = strings.ToUpper(pl.Request.Method)
+	if pl.Request.Method == "" {
+		pl.Request.Method = "GET"
+	}
+	if pl.Request.Path == "" {
+		pl.Request.Path = "/"
+	}
+	if pl.Request.Scheme == "" {
+		pl.Request.Scheme = "http"
+	}
+	if pl.Response.Status == 0 {
+		pl.Response.Status = http.StatusOK
+	}
+
+	headers := copyHeaders(pl.Response.Headers)
+	if headers.Get("Content-Type") == "" && pl.Response.Body != "" {
+		if json.Valid([]byte(pl.Response.Body)) {
+			headers.Set("Content-Type", "application/json")
+		} else {
+			headers.Set("Content-Type", http.DetectContentType([]byte(pl.Response.Body)))
+		}
+		pl.Response.Headers = headers
+	}
+}
+
+// validHeaderName - checks header name is a token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// validatePayload - returns validation errors of payload fields
+func (d *DBClient) validatePayload(pl Payload) (errs []PayloadFieldError) {
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, PayloadFieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	r := pl.Request
+	if r.Destination == "" {
+		add("request.destination", "destination is required")
+	} else if strings.ContainsAny(r.Destination, "/ ") {
+		add("request.destination", "destination should be a host (with optional port), got '%s'", r.Destination)
+	}
+	if !validHeaderName(r.Method) {
+		add("request.method", "invalid method '%s'", r.Method)
+	}
+	if !strings.HasPrefix(r.Path, "/") {
+		add("request.path", "path should start with '/'")
+	}
+	if r.Scheme != "http" && r.Scheme != "https" {
+		add("request.scheme", "scheme should be http or https, got '%s'", r.Scheme)
+	}
+	if _, err := url.ParseQuery(r.Query); err != nil {
+		add("request.query", "invalid query: %s", err.Error())
+	}
+	for name := range r.Headers {
+		if !validHeaderName(name) {
+			add("request.headers", "invalid header name '%s'", name)
+		}
+	}
+
+	resp := pl.Response
+	if resp.Status < 100 || resp.Status > 599 {
+		add("response.status", "status should be between 100 and 599, got %d", resp.Status)
+	}
+	for name := range resp.Headers {
+		if !validHeaderName(name) {
+			add("response.headers", "invalid header name '%s'", name)
+		}
+	}
+	if resp.BodyFile != "" {
+		if resp.Body != "" {
+			add("response.bodyFile", "only one of body and bodyFile can be set")
+		} else if d.Bodies == nil {
+			add("response.bodyFile", "body storage is not configured")
+		} else if body, _, err := d.Bodies.Open(resp.BodyFile); err != nil {
+			add("response.bodyFile", "%s", err.Error())
+		} else {
+			body.Close()
+		}
+	}
+
+	for i := range pl.Callbacks {
+		if err := pl.Callbacks[i].Validate(); err != nil {
+			add(fmt.Sprintf("callbacks[%d]", i), "%s", err.Error())
+		}
+	}
+	return
+}
+
+// testPayload - sends payload request through the matching pipeline without side effects of serving it
+// (callbacks and events) and returns the response clients would get
+func (d *DBClient) testPayload(pl Payload) *PayloadTestResult {
+	result := &PayloadTestResult{}
+
+	u := url.URL{Scheme: pl.Request.Scheme, Host: pl.Request.Destination, Path: pl.Request.Path, RawQuery: pl.Request.Query}
+	req, err := http.NewRequest(pl.Request.Method, u.String(), strings.NewReader(pl.Request.Body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header = copyHeaders(pl.Request.Headers)
+
+	key, matcher, bts, err := d.lookupPayload(pl.Request)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	matched, err := decodePayload(bts)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Matched = true
+	result.MatchedAuthored = key == pl.ID
+	result.Matcher = matcher
+	result.Key = key
+
+	c := d.newConstructor(req, *matched)
+	if d.Cfg.Middleware != "" {
+		_ = c.ApplyMiddleware(d.Cfg.Middleware)
+	}
+	if err := c.openBody(); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	c.ApplyHTTPSemantics()
+	response := c.ReconstructResponse()
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Response = &ResponseDetails{Status: response.StatusCode, Headers: response.Header, Body: string(body)}
+	return result
+}
+
+// AuthorPayloadHandler - adds payload supplied as JSON, optionally based on a stored payload. Validation errors
+// are reported per field, "dryRun" only returns fingerprint of the payload and "test" sends payload request through
+// the matching pipeline.
+func (d *DBClient) AuthorPayloadHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var authoring payloadAuthoring
+
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Could not read request body!")
+		http.Error(w, "Failed to read request body.", 400)
+		return
+	}
+
+	err = json.Unmarshal(body, &authoring)
+
+	if err != nil {
+		w.WriteHeader(422) // can't process this entity
+		return
+	}
+
+	var response payloadAuthoringResponse
+	write := func(status int) {
+		b, _ := json.Marshal(response)
+		w.WriteHeader(status)
+		w.Write(b)
+	}
+
+	pl, errs := d.authorPayload(authoring.Template, authoring.Payload)
+	if len(errs) == 0 {
+		applyPayloadDefaults(&pl)
+		errs = d.validatePayload(pl)
+	}
+	if len(errs) > 0 {
+		response.Errors = errs
+		response.Message = "Payload is not valid"
+		write(400)
+		return
+	}
+
+	if pl.Request.Session == "" {
+		pl.Request.Session = d.Sessions.identity(pl.Request.Headers)
+	}
+	r := RequestContainer{Details: pl.Request}
+	pl.ID = r.Hash()
+	response.Fingerprint = pl.ID
+
+	if !authoring.DryRun && d.rejectLocked(w) {
+		return
+	}
+
+	status := http.StatusOK
+	if !authoring.DryRun {
+		stored, err := d.importPayload(pl, nil)
+		if err != nil {
+			if _, ok := err.(*VetoError); ok {
+				vetoed(w, err)
+				return
+			}
+			response.Message = fmt.Sprintf("Got error: %s", err.Error())
+			write(400)
+			return
+		}
+		// hooks could have changed the payload
+		pl = stored
+		response.Fingerprint = pl.ID
+		response.Stored = true
+		status = http.StatusCreated
+
+		log.WithFields(log.Fields{
+			"key":         pl.ID,
+			"destination": pl.Request.Destination,
+			"path":        pl.Request.Path,
+			"method":      pl.Request.Method,
+		}).Info("payload added")
+	}
+	response.Payload = &pl
+
+	if authoring.Test {
+		response.Test = d.testPayload(pl)
+	}
+
+	write(status)
+}
@@ -0,0 +1,189 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func authorPayloadRequest(t *testing.T, dbClient *DBClient, body string) (int, payloadAuthoringResponse) {
+	m := getBoneRouter(*dbClient)
+
+	req, err := http.NewRequest("POST", "/payloads", bytes.NewBufferString(body))
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	var response payloadAuthoringResponse
+	if rec.Code != 422 {
+		expect(t, json.Unmarshal(rec.Body.Bytes(), &response), nil)
+	}
+	return rec.Code, response
+}
+
+func TestAuthorPayload(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	code, response := authorPayloadRequest(t, dbClient, `{
+		"payload": {
+			"request": {"destination": "api.com", "path": "/users", "method": "post", "body": "name=bob",
+				"headers": {"Authorization": ["Bearer token"]}},
+			"response": {"status": 201, "body": "{\"id\": 1}", "headers": {"Location": ["/users/1"]}}
+		},
+		"test": true
+	}`)
+	expect(t, code, http.StatusCreated)
+	expect(t, response.Stored, true)
+	expect(t, len(response.Errors), 0)
+
+	r := RequestContainer{Details: RequestDetails{Destination: "api.com", Path: "/users", Method: "POST", Body: "name=bob"}}
+	expect(t, response.Fingerprint, r.Hash())
+
+	// defaults are applied
+	expect(t, response.Payload.Request.Scheme, "http")
+	expect(t, response.Payload.Response.Headers["Content-Type"][0], "application/json")
+
+	expect(t, response.Test.Matched, true)
+	expect(t, response.Test.MatchedAuthored, true)
+	expect(t, response.Test.Matcher, MatcherExact)
+	expect(t, response.Test.Response.Status, 201)
+	expect(t, response.Test.Response.Body, `{"id": 1}`)
+	expect(t, response.Test.Response.Headers["Location"][0], "/users/1")
+
+	// payload is served
+	req, _ := http.NewRequest("POST", "http://api.com/users", strings.NewReader("name=bob"))
+	resp := dbClient.getResponse(req)
+	expect(t, resp.StatusCode, 201)
+}
+
+func TestAuthorPayloadValidation(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	code, response := authorPayloadRequest(t, dbClient, `{
+		"payload": {
+			"request": {"destination": "http://api.com/", "path": "users", "scheme": "ftp",
+				"headers": {"Bad Header": ["x"]}},
+			"response": {"status": 999, "body": "x", "bodyFile": "x.json"}
+		}
+	}`)
+	expect(t, code, 400)
+	expect(t, response.Stored, false)
+
+	fields := make(map[string]bool)
+	for _, e := range response.Errors {
+		fields[e.Field] = true
+	}
+	for _, f := range []string{"request.destination", "request.path", "request.scheme", "request.headers",
+		"response.status", "response.bodyFile"} {
+		expect(t, fields[f], true)
+	}
+
+	// type errors are reported for the field
+	code, response = authorPayloadRequest(t, dbClient, `{"payload": {"response": {"status": "ok"}}}`)
+	expect(t, code, 400)
+	expect(t, response.Errors[0].Field, "response.status")
+
+	code, _ = authorPayloadRequest(t, dbClient, `not json`)
+	expect(t, code, 422)
+
+	count, _ := dbClient.Cache.RecordsCount()
+	expect(t, count, 0)
+}
+
+func TestAuthorPayloadDryRun(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	code, response := authorPayloadRequest(t, dbClient, `{
+		"payload": {"request": {"destination": "api.com"}, "response": {"body": "hi"}},
+		"dryRun": true,
+		"test": true
+	}`)
+	expect(t, code, http.StatusOK)
+	expect(t, response.Stored, false)
+	refute(t, response.Fingerprint, "")
+	expect(t, response.Test.Matched, false)
+
+	count, _ := dbClient.Cache.RecordsCount()
+	expect(t, count, 0)
+}
+
+func TestAuthorPayloadFromTemplate(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	base := Payload{
+		Request:  RequestDetails{Destination: "api.com", Path: "/users/1", Method: "GET"},
+		Response: ResponseDetails{Status: 200, Body: "bob", Headers: map[string][]string{"X-Version": {"1"}}},
+	}
+	stored, err := dbClient.importPayload(base, nil)
+	expect(t, err, nil)
+
+	code, response := authorPayloadRequest(t, dbClient, `{
+		"template": "`+stored.ID+`",
+		"payload": {"request": {"path": "/users/2"}, "response": {"body": "alice"}},
+		"test": true
+	}`)
+	expect(t, code, http.StatusCreated)
+	expect(t, response.Payload.Request.Destination, "api.com")
+	expect(t, response.Payload.Request.Path, "/users/2")
+	expect(t, response.Payload.Response.Headers["X-Version"][0], "1")
+	expect(t, response.Test.Response.Body, "alice")
+
+	count, _ := dbClient.Cache.RecordsCount()
+	expect(t, count, 2)
+
+	code, response = authorPayloadRequest(t, dbClient, `{"template": "missing"}`)
+	expect(t, code, 400)
+	expect(t, response.Errors[0].Field, "template")
+}
+
+func TestAuthorPayloadTestShadowedPayload(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	// HEAD request without its own payload is answered from GET payload
+	_, err := dbClient.importPayload(Payload{
+		Request:  RequestDetails{Destination: "api.com", Path: "/", Method: "GET"},
+		Response: ResponseDetails{Status: 200, Body: "get"},
+	}, nil)
+	expect(t, err, nil)
+
+	code, response := authorPayloadRequest(t, dbClient, `{
+		"payload": {"request": {"destination": "api.com", "method": "HEAD"}},
+		"dryRun": true,
+		"test": true
+	}`)
+	expect(t, code, http.StatusOK)
+	expect(t, response.Test.Matched, true)
+	expect(t, response.Test.MatchedAuthored, false)
+	expect(t, response.Test.Matcher, MatcherHeadFallback)
+}
+
+func TestManualAddValidation(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+	m := getBoneRouter(*dbClient)
+
+	form := url.Values{"inputPath": {"/x"}, "inputMethod": {"GET"}}
+	req, _ := http.NewRequest("POST", "/add", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, 400)
+	expect(t, strings.Contains(rec.Body.String(), "request.destination"), true)
+}
@@ -0,0 +1,303 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// batchMu - batches are executed one at a time, so rollback doesn't undo changes made by another batch. Records
+// are changed outside of batches under read lock (see lockRecords), so they wait for running batch instead of
+// being undone by its rollback.
+var batchMu sync.RWMutex
+
+// lockRecords - takes batchMu read lock before records are changed and returns function releasing it. Operations
+// of the running batch already hold the lock, so they don't take it again.
+func (d *DBClient) lockRecords() func() {
+	if d.inBatch {
+		return func() {}
+	}
+	batchMu.RLock()
+	return batchMu.RUnlock
+}
+
+// batchUnsupported - admin endpoints that can't be called from a batch, long polling ones would block
+// captures for as long as they wait
+var batchUnsupported = map[string]bool{
+	"/batch":               true,
+	"/statsws":             true,
+	"/wait":                true,
+	"/replication/changes": true,
+}
+
+// BatchOperation - single admin API call executed as a part of a batch
+type BatchOperation struct {
+	Method string `json:"method"`
+	// Path - admin API path with optional query, e.g. "/records" or "/logs?limit=10"
+	Path    string              `json:"path"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	// Body - JSON request body, JSON strings are sent as they are (e.g. form bodies for "/add")
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResult - result of batch operation
+type BatchResult struct {
+	Index  int    `json:"index"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	// Response - response body, JSON responses are embedded as they are
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+type batchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+type batchResponse struct {
+	Data       []BatchResult `json:"data"`
+	Failed     int           `json:"failed"`
+	RolledBack bool          `json:"rolledBack"`
+	Message    string        `json:"message"`
+}
+
+// request - builds admin API request for operation
+func (o BatchOperation) request(auth string) (*http.Request, error) {
+	o.Method = strings.ToUpper(o.Method)
+	if o.Method == "" {
+		return nil, fmt.Errorf("method is required")
+	}
+	u, err := url.Parse(o.Path)
+	if err != nil || u.IsAbs() || !strings.HasPrefix(u.Path, "/") {
+		return nil, fmt.Errorf("path should be an admin API path, e.g. '/records', got '%s'", o.Path)
+	}
+	if batchUnsupported[u.Path] {
+		return nil, fmt.Errorf("'%s' can't be used in a batch", u.Path)
+	}
+
+	var body []byte
+	if len(o.Body) > 0 && o.Body[0] == '"' {
+		var s string
+		if err := json.Unmarshal(o.Body, &s); err != nil {
+			return nil, err
+		}
+		body = []byte(s)
+	} else if len(o.Body) > 0 && string(o.Body) != "null" {
+		body = o.Body
+	}
+
+	req, err := http.NewRequest(o.Method, u.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range o.Headers {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+	if auth != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return req, nil
+}
+
+// cacheSnapshot - contents of the cache (and body blobs payloads reference) taken before the batch
+type cacheSnapshot struct {
+	entries map[string][]byte
+	blobs   map[string][]byte
+	refs    map[string]uint64
+}
+
+// snapshotCache - copies all cache entries, so they can be restored if batch fails
+func (d *DBClient) snapshotCache() (*cacheSnapshot, error) {
+	keys, err := d.Cache.GetAllKeys()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &cacheSnapshot{
+		entries: make(map[string][]byte, len(keys)),
+		blobs:   make(map[string][]byte),
+		refs:    make(map[string]uint64),
+	}
+	for key := range keys {
+		value, err := d.Cache.Get([]byte(key))
+		if err != nil {
+			return nil, err
+		}
+		snapshot.entries[key] = value
+
+		if d.Bodies == nil {
+			continue
+		}
+		pl, err := decodePayload(value)
+		if err != nil || !isBlobRef(pl.Response.BodyFile) {
+			continue
+		}
+		ref := pl.Response.BodyFile
+		snapshot.refs[ref]++
+		if _, ok := snapshot.blobs[ref]; ok {
+			continue
+		}
+		blob, err := d.Bodies.Blob(ref)
+		if err != nil {
+			// payload already references missing blob, nothing to restore
+			continue
+		}
+		snapshot.blobs[ref] = blob
+	}
+	return snapshot, nil
+}
+
+// restoreCache - replaces cache contents with the snapshot
+func (d *DBClient) restoreCache(snapshot *cacheSnapshot) error {
+	blobsMu.Lock()
+	defer blobsMu.Unlock()
+
+	// blobs are restored first, so restored payloads never reference missing ones. They are content addressed,
+	// so they get their previous references.
+	for _, blob := range snapshot.blobs {
+		if _, err := d.Bodies.Put(blob); err != nil {
+			return err
+		}
+	}
+
+	if err := d.Cache.Restore(snapshot.entries); err != nil {
+		return err
+	}
+
+	// blobs added by the batch are removed with their references
+	if d.Bodies != nil {
+		if err := d.Bodies.recount(snapshot.refs); err != nil {
+			return err
+		}
+	}
+
+	// records were changed without hooks, replicas need all of them again
+	d.Replication.reset()
+	return nil
+}
+
+// BatchHandler - executes ordered list of admin API operations. Execution stops on the first failed operation
+// (status 400 or above) and cache changes made by the batch are rolled back. Other changes (i.e. mode, error
+// templates) are not rolled back.
+func (d *DBClient) BatchHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var br batchRequest
+
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Could not read request body!")
+		http.Error(w, "Failed to read request body.", 400)
+		return
+	}
+
+	err = json.Unmarshal(body, &br)
+
+	if err != nil {
+		w.WriteHeader(422) // can't process this entity
+		return
+	}
+
+	var response batchResponse
+	write := func(status int) {
+		b, _ := json.Marshal(response)
+		w.WriteHeader(status)
+		w.Write(b)
+	}
+
+	if len(br.Operations) == 0 {
+		response.Message = "Bad request. No operations supplied!"
+		write(400)
+		return
+	}
+
+	// operations are validated before anything is executed
+	auth := req.Header.Get("Authorization")
+	requests := make([]*http.Request, len(br.Operations))
+	for i, op := range br.Operations {
+		requests[i], err = op.request(auth)
+		if err != nil {
+			response.Data = append(response.Data, BatchResult{Index: i, Method: op.Method, Path: op.Path, Error: err.Error()})
+		}
+	}
+	if len(response.Data) > 0 {
+		response.Failed = len(response.Data)
+		response.Message = "Batch is not valid, no operations were executed"
+		write(400)
+		return
+	}
+
+	batchMu.Lock()
+	defer batchMu.Unlock()
+
+	snapshot, err := d.snapshotCache()
+	if err != nil {
+		response.Message = fmt.Sprintf("Failed to snapshot cache, no operations were executed: %s", err.Error())
+		write(500)
+		return
+	}
+
+	batched := *d
+	batched.inBatch = true
+	mux := getBoneRouter(batched)
+	for i, opReq := range requests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, opReq)
+
+		result := BatchResult{Index: i, Method: opReq.Method, Path: br.Operations[i].Path, Status: rec.Code}
+		if respBody := bytes.TrimSpace(rec.Body.Bytes()); len(respBody) > 0 {
+			if json.Valid(respBody) {
+				result.Response = respBody
+			} else {
+				result.Response, _ = json.Marshal(string(respBody))
+			}
+		}
+		response.Data = append(response.Data, result)
+
+		if rec.Code >= 400 {
+			response.Failed = 1
+			break
+		}
+	}
+
+	if response.Failed == 0 {
+		response.Message = fmt.Sprintf("%d operations executed", len(response.Data))
+		write(http.StatusOK)
+		return
+	}
+
+	failed := response.Data[len(response.Data)-1]
+	if err := d.restoreCache(snapshot); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Failed to roll back cache after failed batch")
+		response.Message = fmt.Sprintf("Operation %d failed and cache could not be rolled back: %s", failed.Index, err.Error())
+		write(500)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"index":  failed.Index,
+		"method": failed.Method,
+		"path":   failed.Path,
+		"status": failed.Status,
+	}).Warn("Batch operation failed, cache rolled back")
+
+	response.RolledBack = true
+	response.Message = fmt.Sprintf("Operation %d failed, cache changes were rolled back", failed.Index)
+	write(400)
+}
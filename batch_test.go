@@ -0,0 +1,225 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func batchRequestRecorder(t *testing.T, dbClient *DBClient, body string) (int, batchResponse) {
+	m := getBoneRouter(*dbClient)
+
+	req, err := http.NewRequest("POST", "/batch", bytes.NewBufferString(body))
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	var response batchResponse
+	expect(t, json.Unmarshal(rec.Body.Bytes(), &response), nil)
+	return rec.Code, response
+}
+
+func TestBatch(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	expect(t, dbClient.ImportPayloads([]Payload{{
+		Request:  RequestDetails{Destination: "old.com", Path: "/", Method: "GET"},
+		Response: ResponseDetails{Status: 200},
+	}}), nil)
+
+	code, response := batchRequestRecorder(t, dbClient, `{"operations": [
+		{"method": "DELETE", "path": "/records"},
+		{"method": "POST", "path": "/records", "body": {"data": [
+			{"request": {"destination": "a.com", "path": "/", "method": "GET"}, "response": {"status": 200}},
+			{"request": {"destination": "b.com", "path": "/", "method": "GET"}, "response": {"status": 200}}
+		]}},
+		{"method": "POST", "path": "/state", "body": {"mode": "virtualize"}},
+		{"method": "GET", "path": "/count"}
+	]}`)
+	expect(t, code, http.StatusOK)
+	expect(t, response.Failed, 0)
+	expect(t, response.RolledBack, false)
+	expect(t, len(response.Data), 4)
+	expect(t, response.Data[3].Status, http.StatusOK)
+	expect(t, string(response.Data[3].Response), `{"count":2}`)
+
+	count, _ := dbClient.Cache.RecordsCount()
+	expect(t, count, 2)
+	expect(t, dbClient.Cfg.GetMode(), "virtualize")
+}
+
+func TestBatchRollback(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Bodies = testBodyStore("")
+	ref, err := dbClient.Bodies.Put([]byte("large body"))
+	expect(t, err, nil)
+	expect(t, dbClient.ImportPayloads([]Payload{bodyFilePayload("/file", ref)}), nil)
+	keys, _ := dbClient.Cache.GetAllKeys()
+
+	code, response := batchRequestRecorder(t, dbClient, `{"operations": [
+		{"method": "DELETE", "path": "/records"},
+		{"method": "POST", "path": "/records", "body": {"data": [
+			{"request": {"destination": "a.com", "path": "/", "method": "GET"}, "response": {"status": 200}}
+		]}},
+		{"method": "POST", "path": "/state", "body": {"mode": "unknown"}},
+		{"method": "GET", "path": "/count"}
+	]}`)
+	expect(t, code, 400)
+	expect(t, response.Failed, 1)
+	expect(t, response.RolledBack, true)
+	expect(t, len(response.Data), 3)
+	expect(t, response.Data[2].Status, 400)
+
+	restored, _ := dbClient.Cache.GetAllKeys()
+	expect(t, len(restored), 1)
+	for key := range keys {
+		expect(t, restored[key], true)
+	}
+
+	// blob deleted by the wipe is restored as well
+	data, err := dbClient.Bodies.Blob(ref)
+	expect(t, err, nil)
+	expect(t, string(data), "large body")
+
+	// and so is its reference count, blob goes away with the payload referencing it
+	expect(t, dbClient.ImportPayloads([]Payload{{
+		Request:  RequestDetails{Destination: "files.com", Path: "/file", Method: "GET"},
+		Response: ResponseDetails{Status: 200, Body: "inline"},
+	}}), nil)
+	_, err = dbClient.Bodies.Blob(ref)
+	refute(t, err, nil)
+}
+
+func TestBatchValidation(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	expect(t, dbClient.ImportPayloads([]Payload{{
+		Request:  RequestDetails{Destination: "old.com", Path: "/", Method: "GET"},
+		Response: ResponseDetails{Status: 200},
+	}}), nil)
+
+	code, response := batchRequestRecorder(t, dbClient, `{"operations": [
+		{"method": "DELETE", "path": "/records"},
+		{"method": "POST", "path": "/batch", "body": {"operations": []}},
+		{"path": "/state"},
+		{"method": "GET", "path": "http://other.com/records"}
+	]}`)
+	expect(t, code, 400)
+	expect(t, response.Failed, 3)
+	expect(t, response.Data[0].Index, 1)
+
+	// nothing was executed
+	count, _ := dbClient.Cache.RecordsCount()
+	expect(t, count, 1)
+
+	code, _ = batchRequestRecorder(t, dbClient, `{"operations": []}`)
+	expect(t, code, 400)
+
+	// long polling endpoints would keep the batch running
+	code, response = batchRequestRecorder(t, dbClient, `{"operations": [
+		{"method": "POST", "path": "/wait", "body": {"matcher": {"path": "/never"}}},
+		{"method": "GET", "path": "/replication/changes?since=0&wait=60000"}
+	]}`)
+	expect(t, code, 400)
+	expect(t, response.Failed, 2)
+}
+
+func TestBatchFormBody(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	code, response := batchRequestRecorder(t, dbClient, `{"operations": [
+		{"method": "POST", "path": "/add",
+			"headers": {"Content-Type": ["application/x-www-form-urlencoded"]},
+			"body": "inputDestination=a.com&inputPath=/x&inputMethod=GET&inputResponseStatusCode=200"}
+	]}`)
+	expect(t, code, http.StatusOK)
+	expect(t, response.Data[0].Status, http.StatusCreated)
+
+	count, _ := dbClient.Cache.RecordsCount()
+	expect(t, count, 1)
+}
+
+func TestCaptureWaitsForBatch(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	// batch is running
+	batchMu.Lock()
+	captured := make(chan struct{})
+	go func() {
+		req, _ := http.NewRequest("GET", "http://example.com/during-batch", nil)
+		dbClient.captureRequest(req)
+		close(captured)
+	}()
+
+	select {
+	case <-captured:
+		t.Fatal("payload was captured while batch was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	batchMu.Unlock()
+
+	<-captured
+	count, _ := dbClient.Cache.RecordsCount()
+	expect(t, count, 1)
+}
+
+func TestImportAndWipeWaitForBatch(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	// batch is running
+	batchMu.Lock()
+	imported := make(chan struct{})
+	go func() {
+		dbClient.ImportPayloads([]Payload{{
+			Request:  RequestDetails{Destination: "during-batch.com", Path: "/", Method: "GET"},
+			Response: ResponseDetails{Status: 200},
+		}})
+		close(imported)
+	}()
+
+	select {
+	case <-imported:
+		t.Fatal("payload was imported while batch was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	batchMu.Unlock()
+
+	<-imported
+	count, _ := dbClient.Cache.RecordsCount()
+	expect(t, count, 1)
+
+	batchMu.Lock()
+	wiped := make(chan struct{})
+	go func() {
+		lockTestRequest(dbClient, "DELETE", "/records", "")
+		close(wiped)
+	}()
+
+	select {
+	case <-wiped:
+		t.Fatal("records were wiped while batch was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+	batchMu.Unlock()
+
+	<-wiped
+	count, _ = dbClient.Cache.RecordsCount()
+	expect(t, count, 0)
+}
@@ -0,0 +1,614 @@
+package hoverfly
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+// BlobsBucketName - BoltDB bucket for response bodies stored outside of payloads
+const BlobsBucketName = "blobs"
+
+// BlobRefsBucketName - BoltDB bucket with number of payloads referencing each blob
+const BlobRefsBucketName = "blobRefs"
+
+// blobRefPrefix - body file references with this prefix point to blob bucket instead of a file
+const blobRefPrefix = "blob:"
+
+// simulationFileName - name of payloads file in exported simulation bundle
+const simulationFileName = "simulation.json"
+
+// bundleBodiesDir - directory with body files in exported simulation bundle
+const bundleBodiesDir = "bodies"
+
+// responseBody - response body stored outside of payload
+type responseBody interface {
+	io.Reader
+	io.ReaderAt
+	io.Closer
+}
+
+type blobReader struct {
+	*bytes.Reader
+}
+
+func (blobReader) Close() error {
+	return nil
+}
+
+type sectionBody struct {
+	*io.SectionReader
+	io.Closer
+}
+
+// BodyStore - stores response bodies referenced by ResponseDetails.BodyFile. References are either paths
+// relative to simulation directory or "blob:<sha256>" for bodies kept in BoltDB blob bucket. Blobs are counted
+// by stored payloads referencing them (see DBClient.storePayload) and removed with the last reference.
+type BodyStore struct {
+	Dir        string
+	DB         *bolt.DB
+	Bucket     []byte
+	RefsBucket []byte
+}
+
+// NewBodyStore - returns body store resolving files against given directory, db can be nil when blobs
+// aren't needed
+func NewBodyStore(dir string, db *bolt.DB) *BodyStore {
+	if dir == "" {
+		dir = "."
+	}
+	return &BodyStore{Dir: dir, DB: db, Bucket: []byte(BlobsBucketName), RefsBucket: []byte(BlobRefsBucketName)}
+}
+
+func isBlobRef(ref string) bool {
+	return strings.HasPrefix(ref, blobRefPrefix)
+}
+
+// blobRef - returns reference of blob with given content
+func blobRef(data []byte) string {
+	sum := sha256.Sum256(data)
+	return blobRefPrefix + hex.EncodeToString(sum[:])
+}
+
+func blobKey(ref string) []byte {
+	return []byte(strings.TrimPrefix(ref, blobRefPrefix))
+}
+
+// filePath - returns path of referenced file, references can't point outside of simulation directory
+func (s *BodyStore) filePath(ref string) (string, error) {
+	clean := path.Clean(filepath.ToSlash(ref))
+	if filepath.IsAbs(ref) || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("body file '%s' must be relative to simulation directory", ref)
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(clean)), nil
+}
+
+// Open - opens referenced body, returns its size
+func (s *BodyStore) Open(ref string) (responseBody, int64, error) {
+	if isBlobRef(ref) {
+		data, err := s.Blob(ref)
+		if err != nil {
+			return nil, 0, err
+		}
+		return blobReader{bytes.NewReader(data)}, int64(len(data)), nil
+	}
+
+	p, err := s.filePath(ref)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, 0, fmt.Errorf("body file '%s' is a directory", ref)
+	}
+	return f, info.Size(), nil
+}
+
+// Read - returns referenced body
+func (s *BodyStore) Read(ref string) ([]byte, error) {
+	if isBlobRef(ref) {
+		return s.Blob(ref)
+	}
+	p, err := s.filePath(ref)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(p)
+}
+
+// Blob - returns body stored in blob bucket
+func (s *BodyStore) Blob(ref string) (data []byte, err error) {
+	if s.DB == nil {
+		return nil, fmt.Errorf("blob storage is not available")
+	}
+	err = s.DB.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(s.Bucket)
+		if bucket == nil {
+			return fmt.Errorf("blob %q not found", ref)
+		}
+		val := bucket.Get(blobKey(ref))
+		if val == nil {
+			return fmt.Errorf("blob %q not found", ref)
+		}
+		// values are only valid during transaction
+		data = append([]byte{}, val...)
+		return nil
+	})
+	return
+}
+
+// Put - stores body in blob bucket and returns its reference, identical bodies are stored once. Blob isn't
+// referenced by any payload, so it's kept only until blobs are recounted.
+func (s *BodyStore) Put(data []byte) (string, error) {
+	if s.DB == nil {
+		return "", fmt.Errorf("blob storage is not available")
+	}
+	ref := blobRef(data)
+
+	err := s.DB.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(s.Bucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(blobKey(ref), data)
+	})
+	if err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// acquire - counts one more payload referencing blob, data is stored with the reference when it's not nil
+func (s *BodyStore) acquire(ref string, data []byte) error {
+	if s.DB == nil {
+		return fmt.Errorf("blob storage is not available")
+	}
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		if data != nil {
+			bucket, err := tx.CreateBucketIfNotExists(s.Bucket)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(blobKey(ref), data); err != nil {
+				return err
+			}
+		}
+		refs, err := tx.CreateBucketIfNotExists(s.RefsBucket)
+		if err != nil {
+			return err
+		}
+		return refs.Put(blobKey(ref), encodeRefCount(decodeRefCount(refs.Get(blobKey(ref)))+1))
+	})
+}
+
+// release - counts one payload less referencing blob, blob is removed with its last reference
+func (s *BodyStore) release(ref string) error {
+	if s.DB == nil {
+		return nil
+	}
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		refs := tx.Bucket(s.RefsBucket)
+		count := uint64(0)
+		if refs != nil {
+			count = decodeRefCount(refs.Get(blobKey(ref)))
+		}
+		if count > 1 {
+			return refs.Put(blobKey(ref), encodeRefCount(count-1))
+		}
+		if refs != nil {
+			if err := refs.Delete(blobKey(ref)); err != nil {
+				return err
+			}
+		}
+		if bucket := tx.Bucket(s.Bucket); bucket != nil {
+			return bucket.Delete(blobKey(ref))
+		}
+		return nil
+	})
+}
+
+// recount - replaces reference counts with given ones, blobs without references are removed
+func (s *BodyStore) recount(counts map[string]uint64) error {
+	if s.DB == nil {
+		return nil
+	}
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(s.RefsBucket) != nil {
+			if err := tx.DeleteBucket(s.RefsBucket); err != nil {
+				return err
+			}
+		}
+		refs, err := tx.CreateBucket(s.RefsBucket)
+		if err != nil {
+			return err
+		}
+		for ref, count := range counts {
+			if err := refs.Put(blobKey(ref), encodeRefCount(count)); err != nil {
+				return err
+			}
+		}
+
+		bucket := tx.Bucket(s.Bucket)
+		if bucket == nil {
+			return nil
+		}
+		var unreferenced [][]byte
+		bucket.ForEach(func(k, v []byte) error {
+			if counts[blobRefPrefix+string(k)] == 0 {
+				unreferenced = append(unreferenced, append([]byte{}, k...))
+			}
+			return nil
+		})
+		for _, k := range unreferenced {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func encodeRefCount(count uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, count)
+	return b
+}
+
+func decodeRefCount(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// DeleteBlobs - removes all blobs
+func (s *BodyStore) DeleteBlobs() error {
+	if s.DB == nil {
+		return nil
+	}
+	return s.DB.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{s.Bucket, s.RefsBucket} {
+			if tx.Bucket(name) == nil {
+				continue
+			}
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// openBody - opens payload body file, so it can be streamed by ReconstructResponse. Content-Type is derived
+// from file extension or body content when payload doesn't set it.
+func (c *Constructor) openBody() error {
+	ref := c.payload.Response.BodyFile
+	if ref == "" || c.body != nil {
+		return nil
+	}
+	if c.bodies == nil {
+		return fmt.Errorf("body file '%s' can't be opened, body storage is not configured", ref)
+	}
+
+	body, size, err := c.bodies.Open(ref)
+	if err != nil {
+		return err
+	}
+	c.setBody(body, size, ref)
+	return nil
+}
+
+// loadBody - reads payload body file into payload body, so middleware and fuzzing see the body and their changes
+// aren't replaced by the file
+func (c *Constructor) loadBody() error {
+	ref := c.payload.Response.BodyFile
+	if ref == "" {
+		return nil
+	}
+	if c.bodies == nil {
+		return fmt.Errorf("body file '%s' can't be read, body storage is not configured", ref)
+	}
+
+	data, err := c.bodies.Read(ref)
+	if err != nil {
+		return err
+	}
+
+	headers := copyHeaders(c.payload.Response.Headers)
+	headers.Del("Content-Length")
+	if headers.Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(path.Ext(ref))
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		headers.Set("Content-Type", contentType)
+	}
+	c.payload.Response.Headers = headers
+	c.payload.Response.Body = string(data)
+	c.payload.Response.BodyFile = ""
+	return nil
+}
+
+// setBody - sets body streamed instead of payload body, name is used to derive Content-Type
+func (c *Constructor) setBody(body responseBody, size int64, name string) {
+	c.body = body
+	c.bodySize = size
+
+	headers := copyHeaders(c.payload.Response.Headers)
+	headers.Del("Content-Length")
+	if headers.Get("Content-Type") == "" {
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			sniff := make([]byte, 512)
+			n, _ := body.ReadAt(sniff, 0)
+			contentType = http.DetectContentType(sniff[:n])
+		}
+		headers.Set("Content-Type", contentType)
+	}
+	c.payload.Response.Headers = headers
+}
+
+// closeBody - closes body file when response won't have a body
+func (c *Constructor) closeBody() {
+	if c.body != nil {
+		c.body.Close()
+		c.body = nil
+		c.bodySize = 0
+	}
+}
+
+// bodyLength - returns length of payload body, stored in payload or in a file
+func (c *Constructor) bodyLength() int64 {
+	if c.body != nil {
+		return c.bodySize
+	}
+	return int64(len(c.payload.Response.Body))
+}
+
+// blobsMu - serialises changes of blobs and their reference counts with storing and wiping payloads, so a blob is
+// never removed while a payload referencing it is being stored
+var blobsMu sync.Mutex
+
+// storePayload - stores encoded payload under key. Blob referenced by payload (blob is its BodyFile) is counted,
+// and stored when data isn't nil. Blob referenced by payload it replaces is removed when no other payload
+// references it (blobs are shared by payloads with identical bodies).
+func (d *DBClient) storePayload(key string, bts []byte, blob string, data []byte) error {
+	defer d.lockRecords()()
+
+	blobsMu.Lock()
+	defer blobsMu.Unlock()
+
+	counted := isBlobRef(blob) && d.Bodies != nil && d.Bodies.DB != nil
+	if counted {
+		if err := d.Bodies.acquire(blob, data); err != nil {
+			return err
+		}
+	}
+
+	replaced := d.storedBlob(key)
+	if err := d.Cache.Set([]byte(key), bts); err != nil {
+		if counted {
+			d.releaseBlob(blob)
+		}
+		return err
+	}
+	if replaced != "" {
+		d.releaseBlob(replaced)
+	}
+	return nil
+}
+
+// storedBlob - returns blob referenced by payload stored under key
+func (d *DBClient) storedBlob(key string) string {
+	if d.Bodies == nil || d.Bodies.DB == nil {
+		return ""
+	}
+	value, err := d.Cache.Get([]byte(key))
+	if err != nil {
+		return ""
+	}
+	pl, err := decodePayload(value)
+	if err != nil || !isBlobRef(pl.Response.BodyFile) {
+		return ""
+	}
+	return pl.Response.BodyFile
+}
+
+// releaseBlob - drops payload reference to blob, blob is removed unless another payload references it
+func (d *DBClient) releaseBlob(ref string) {
+	if err := d.Bodies.release(ref); err != nil {
+		log.WithFields(log.Fields{
+			"error":    err.Error(),
+			"bodyFile": ref,
+		}).Warn("Failed to release blob payload referenced")
+	}
+}
+
+// bodyLoader - returns content of body file referenced by imported payload
+type bodyLoader func(ref string) ([]byte, error)
+
+// loadBodies - loads body files referenced by imported payloads and points payloads to blobs, so payloads don't
+// depend on files (or URLs) they were imported from. Returns blob contents by reference, blobs are stored
+// together with payloads referencing them.
+func (d *DBClient) loadBodies(payloads []Payload, load bodyLoader) (map[string][]byte, error) {
+	if d.Bodies == nil || d.Bodies.DB == nil {
+		return nil, nil
+	}
+	bodies := make(map[string][]byte)
+	for i := range payloads {
+		ref := payloads[i].Response.BodyFile
+		if ref == "" || isBlobRef(ref) {
+			continue
+		}
+		data, err := load(ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load body file '%s': %s", ref, err.Error())
+		}
+		blob := blobRef(data)
+		bodies[blob] = data
+		payloads[i].Response.BodyFile = blob
+	}
+	return bodies, nil
+}
+
+// fileBodyLoader - loads body files relative to simulation file directory
+func fileBodyLoader(simulation string) bodyLoader {
+	store := NewBodyStore(filepath.Dir(simulation), nil)
+	return store.Read
+}
+
+// urlBodyLoader - loads body files relative to simulation URL
+func (d *DBClient) urlBodyLoader(simulation string) bodyLoader {
+	return func(ref string) ([]byte, error) {
+		base, err := url.Parse(simulation)
+		if err != nil {
+			return nil, err
+		}
+		u, err := base.Parse(ref)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := d.HTTP.Get(u.String())
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("got status %d", resp.StatusCode)
+		}
+		return ioutil.ReadAll(resp.Body)
+	}
+}
+
+// ImportFromZip - imports simulation bundle created by export, body files are read from the bundle
+func (d *DBClient) ImportFromZip(bundle string) error {
+	r, err := zip.OpenReader(bundle)
+	if err != nil {
+		return fmt.Errorf("Got error while opening simulation bundle, error %s", err.Error())
+	}
+	defer r.Close()
+
+	files := make(map[string]*zip.File)
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+
+	read := func(name string) ([]byte, error) {
+		f, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("'%s' not found in bundle", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+
+	data, err := read(simulationFileName)
+	if err != nil {
+		return fmt.Errorf("Got error while reading simulation bundle, error %s", err.Error())
+	}
+
+	var requests recordedRequests
+	if err := json.Unmarshal(data, &requests); err != nil {
+		return fmt.Errorf("Got error while parsing payloads file, error %s", err.Error())
+	}
+
+	bodies, err := d.loadBodies(requests.Data, func(ref string) ([]byte, error) {
+		return read(path.Clean(ref))
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.importPayloads(requests.Data, bodies)
+}
+
+// WriteSimulationBundle - writes zip bundle with all payloads and body files they reference, bundle can be
+// imported with ImportFromZip
+func (d *DBClient) WriteSimulationBundle(w io.Writer) error {
+	payloads, err := d.Cache.GetAllRequests()
+	if err != nil {
+		return err
+	}
+
+	z := zip.NewWriter(w)
+	written := make(map[string]bool)
+
+	for i := range payloads {
+		ref := payloads[i].Response.BodyFile
+		if ref == "" {
+			continue
+		}
+		if d.Bodies == nil {
+			return fmt.Errorf("body file '%s' can't be exported, body storage is not configured", ref)
+		}
+
+		data, err := d.Bodies.Read(ref)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error":    err.Error(),
+				"bodyFile": ref,
+				"key":      payloads[i].ID,
+			}).Error("Failed to read body file for export")
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		name := bundleBodiesDir + "/" + hex.EncodeToString(sum[:])
+		if !isBlobRef(ref) {
+			name += path.Ext(ref)
+		}
+		payloads[i].Response.BodyFile = name
+
+		if written[name] {
+			continue
+		}
+		written[name] = true
+
+		f, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(data); err != nil {
+			return err
+		}
+	}
+
+	f, err := z.Create(simulationFileName)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(recordedRequests{Data: payloads}); err != nil {
+		return err
+	}
+	return z.Close()
+}
@@ -0,0 +1,255 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func bodyStoreTools(t *testing.T) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "hoverfly-bodies")
+	expect(t, err, nil)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func testBodyStore(dir string) *BodyStore {
+	store := NewBodyStore(dir, TestDB)
+	store.Bucket = GetRandomName(10)
+	store.RefsBucket = GetRandomName(10)
+	return store
+}
+
+func bodyFilePayload(path, bodyFile string) Payload {
+	return Payload{
+		Request:  RequestDetails{Destination: "files.com", Path: path, Method: "GET"},
+		Response: ResponseDetails{Status: 200, BodyFile: bodyFile},
+	}
+}
+
+func TestBodyStoreRejectsFilesOutsideDirectory(t *testing.T) {
+	store := NewBodyStore("/tmp/simulation", nil)
+
+	_, err := store.filePath("../secret")
+	refute(t, err, nil)
+	_, err = store.filePath("/etc/passwd")
+	refute(t, err, nil)
+
+	p, err := store.filePath("docs/report.pdf")
+	expect(t, err, nil)
+	expect(t, p, filepath.Join("/tmp/simulation", "docs", "report.pdf"))
+}
+
+func TestVirtualizeBodyFile(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dir, cleanup := bodyStoreTools(t)
+	defer cleanup()
+	dbClient.Bodies = testBodyStore(dir)
+
+	content := []byte("%PDF-1.4 binary \x00\x01\x02 content")
+	err := ioutil.WriteFile(filepath.Join(dir, "report.pdf"), content, 0600)
+	expect(t, err, nil)
+
+	err = dbClient.ImportPayloads([]Payload{bodyFilePayload("/report", "report.pdf")})
+	expect(t, err, nil)
+
+	req, _ := http.NewRequest("GET", "http://files.com/report", nil)
+	response := dbClient.getResponse(req)
+	expect(t, response.StatusCode, 200)
+	expect(t, response.ContentLength, int64(len(content)))
+	expect(t, response.Header.Get("Content-Type"), "application/pdf")
+
+	body, err := ioutil.ReadAll(response.Body)
+	expect(t, err, nil)
+	expect(t, string(body), string(content))
+
+	// ranges are served from the file
+	req, _ = http.NewRequest("GET", "http://files.com/report", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	response = dbClient.getResponse(req)
+	expect(t, response.StatusCode, http.StatusPartialContent)
+	body, err = ioutil.ReadAll(response.Body)
+	expect(t, err, nil)
+	expect(t, string(body), "%PDF")
+
+	// missing file
+	err = dbClient.ImportPayloads([]Payload{bodyFilePayload("/missing", "missing.pdf")})
+	expect(t, err, nil)
+	req, _ = http.NewRequest("GET", "http://files.com/missing", nil)
+	response = dbClient.getResponse(req)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindVirtualize)
+}
+
+func TestCaptureLargeBodyAsBlob(t *testing.T) {
+	server, dbClient := testTools(200, `{"message": "a body larger than threshold"}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Bodies = testBodyStore("")
+	defer dbClient.Bodies.DeleteBlobs()
+	dbClient.Cfg.BodyBlobThreshold = 10
+
+	req, _ := http.NewRequest("GET", "http://blobs.com/large", nil)
+	dbClient.captureRequest(req)
+
+	payloads, err := dbClient.Cache.GetAllRequests()
+	expect(t, err, nil)
+	expect(t, len(payloads), 1)
+	expect(t, payloads[0].Response.Body, "")
+	expect(t, isBlobRef(payloads[0].Response.BodyFile), true)
+
+	req, _ = http.NewRequest("GET", "http://blobs.com/large", nil)
+	response := dbClient.getResponse(req)
+	body, err := ioutil.ReadAll(response.Body)
+	expect(t, err, nil)
+	expect(t, string(body), "{\"message\": \"a body larger than threshold\"}\n")
+}
+
+func TestImportBodyFilesRelativeToSimulation(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dir, cleanup := bodyStoreTools(t)
+	defer cleanup()
+	dbClient.Bodies = testBodyStore("")
+	defer dbClient.Bodies.DeleteBlobs()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "logo.png"), []byte("png"), 0600)
+	expect(t, err, nil)
+
+	simulation, _ := json.Marshal(recordedRequests{Data: []Payload{bodyFilePayload("/logo", "logo.png")}})
+	err = ioutil.WriteFile(filepath.Join(dir, "simulation.json"), simulation, 0600)
+	expect(t, err, nil)
+
+	err = dbClient.Import(filepath.Join(dir, "simulation.json"))
+	expect(t, err, nil)
+
+	payloads, err := dbClient.Cache.GetAllRequests()
+	expect(t, err, nil)
+	expect(t, isBlobRef(payloads[0].Response.BodyFile), true)
+
+	data, err := dbClient.Bodies.Read(payloads[0].Response.BodyFile)
+	expect(t, err, nil)
+	expect(t, string(data), "png")
+}
+
+func TestExportAndImportSimulationBundle(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dir, cleanup := bodyStoreTools(t)
+	defer cleanup()
+	dbClient.Bodies = testBodyStore(dir)
+	defer dbClient.Bodies.DeleteBlobs()
+
+	err := ioutil.WriteFile(filepath.Join(dir, "image.png"), []byte("image"), 0600)
+	expect(t, err, nil)
+	blob, err := dbClient.Bodies.Put([]byte("blob"))
+	expect(t, err, nil)
+
+	err = dbClient.ImportPayloads([]Payload{
+		bodyFilePayload("/image", "image.png"),
+		bodyFilePayload("/blob", blob),
+	})
+	expect(t, err, nil)
+
+	var bundle bytes.Buffer
+	err = dbClient.WriteSimulationBundle(&bundle)
+	expect(t, err, nil)
+
+	bundlePath := filepath.Join(dir, "simulation.zip")
+	err = ioutil.WriteFile(bundlePath, bundle.Bytes(), 0600)
+	expect(t, err, nil)
+
+	// importing into another instance
+	other, otherClient := testTools(200, `{'message': 'here'}`)
+	defer other.Close()
+	defer otherClient.Cache.DeleteData()
+	otherClient.Bodies = testBodyStore("")
+	defer otherClient.Bodies.DeleteBlobs()
+
+	err = otherClient.Import(bundlePath)
+	expect(t, err, nil)
+
+	for path, expected := range map[string]string{"/image": "image", "/blob": "blob"} {
+		req, _ := http.NewRequest("GET", "http://files.com"+path, nil)
+		response := otherClient.getResponse(req)
+		body, err := ioutil.ReadAll(response.Body)
+		expect(t, err, nil)
+		expect(t, string(body), expected)
+	}
+}
+
+func TestReplacedBlobIsReleased(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Bodies = testBodyStore("")
+	defer dbClient.Bodies.DeleteBlobs()
+
+	shared, err := dbClient.Bodies.Put([]byte("shared"))
+	expect(t, err, nil)
+	expect(t, dbClient.ImportPayloads([]Payload{bodyFilePayload("/a", shared), bodyFilePayload("/b", shared)}), nil)
+
+	// blob is still referenced by the other payload
+	expect(t, dbClient.ImportPayloads([]Payload{{
+		Request:  RequestDetails{Destination: "files.com", Path: "/a", Method: "GET"},
+		Response: ResponseDetails{Status: 200, Body: "inline"},
+	}}), nil)
+	_, err = dbClient.Bodies.Blob(shared)
+	expect(t, err, nil)
+
+	// last payload referencing blob is replaced
+	expect(t, dbClient.ImportPayloads([]Payload{{
+		Request:  RequestDetails{Destination: "files.com", Path: "/b", Method: "GET"},
+		Response: ResponseDetails{Status: 200, Body: "inline"},
+	}}), nil)
+	_, err = dbClient.Bodies.Blob(shared)
+	refute(t, err, nil)
+}
+
+func TestImportedBlobsAreCounted(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Bodies = testBodyStore("")
+	defer dbClient.Bodies.DeleteBlobs()
+
+	payloads := []Payload{bodyFilePayload("/a", "report.txt"), bodyFilePayload("/b", "report.txt")}
+	bodies, err := dbClient.loadBodies(payloads, func(ref string) ([]byte, error) {
+		return []byte("report"), nil
+	})
+	expect(t, err, nil)
+	blob := payloads[0].Response.BodyFile
+	expect(t, blob, blobRef([]byte("report")))
+
+	// blob isn't stored until payloads referencing it are
+	_, err = dbClient.Bodies.Blob(blob)
+	refute(t, err, nil)
+
+	expect(t, dbClient.importPayloads(payloads, bodies), nil)
+	// storing the same payload again doesn't add a reference
+	expect(t, dbClient.importPayloads(payloads[:1], bodies), nil)
+	data, err := dbClient.Bodies.Blob(blob)
+	expect(t, err, nil)
+	expect(t, string(data), "report")
+
+	for _, path := range []string{"/a", "/b"} {
+		expect(t, dbClient.ImportPayloads([]Payload{{
+			Request:  RequestDetails{Destination: "files.com", Path: path, Method: "GET"},
+			Response: ResponseDetails{Status: 200, Body: "inline"},
+		}}), nil)
+	}
+	_, err = dbClient.Bodies.Blob(blob)
+	refute(t, err, nil)
+}
@@ -0,0 +1,306 @@
+package hoverfly
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// statsBucketWidth - time covered by single stats bucket, windows move with this granularity
+	statsBucketWidth = 10 * time.Second
+	// statsBucketCount - number of buckets, covering the longest window
+	statsBucketCount = int64(time.Hour / statsBucketWidth)
+	// latencySamplesPerBucket - maximum number of latency samples kept per key in each bucket
+	latencySamplesPerBucket = 200
+)
+
+// StatsWindows - supported rolling windows
+var StatsWindows = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+}
+
+var (
+	uuidSegment   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	numberSegment = regexp.MustCompile(`^[0-9]+$`)
+	hexSegment    = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+)
+
+// pathTemplate - replaces path segments that look like identifiers with placeholders, so requests for
+// different resources of the same type are grouped together
+func pathTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		switch {
+		case numberSegment.MatchString(s):
+			segments[i] = "{id}"
+		case uuidSegment.MatchString(s):
+			segments[i] = "{uuid}"
+		case hexSegment.MatchString(s) && strings.ContainsAny(s, "0123456789"):
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// statusClass - returns status class such as "2xx", requests without response are reported as "none"
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "none"
+	}
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// StatsKey - groups requests in stats breakdown
+type StatsKey struct {
+	Destination string `json:"destination"`
+	Path        string `json:"path"`
+	StatusClass string `json:"statusClass"`
+}
+
+// LatencyStats - latency percentiles in milliseconds
+type LatencyStats struct {
+	Mean float64 `json:"mean"`
+	Max  float64 `json:"max"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+}
+
+// BreakdownEntry - stats of requests with the same key in given window
+type BreakdownEntry struct {
+	StatsKey
+	Count int64 `json:"count"`
+	// Rate - requests per second
+	Rate    float64      `json:"rate"`
+	Latency LatencyStats `json:"latency"`
+}
+
+// StatsDelta - number of requests with given key since previous update
+type StatsDelta struct {
+	StatsKey
+	Count int64 `json:"count"`
+}
+
+type bucketEntry struct {
+	count   int64
+	samples []float64
+}
+
+type statsBucket struct {
+	slot    int64
+	entries map[StatsKey]*bucketEntry
+}
+
+type statsTotal struct {
+	count int64
+	// slot - bucket slot key was last observed in
+	slot int64
+}
+
+// WindowedStats - request counts and latencies per destination, path template and status class kept in
+// time buckets, so they can be reported for rolling windows
+type WindowedStats struct {
+	mu      sync.Mutex
+	buckets [statsBucketCount]statsBucket
+	totals  map[StatsKey]*statsTotal
+}
+
+// NewWindowedStats - returns empty windowed stats
+func NewWindowedStats() *WindowedStats {
+	return &WindowedStats{totals: make(map[StatsKey]*statsTotal)}
+}
+
+func bucketSlot(t time.Time) int64 {
+	return t.UnixNano() / int64(statsBucketWidth)
+}
+
+// Observe - records request
+func (w *WindowedStats) Observe(destination, path string, status int, latency time.Duration, now time.Time) {
+	key := StatsKey{Destination: destination, Path: pathTemplate(path), StatusClass: statusClass(status)}
+	ms := float64(latency) / float64(time.Millisecond)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot := bucketSlot(now)
+	b := &w.buckets[slot%statsBucketCount]
+	if b.slot != slot || b.entries == nil {
+		b.slot = slot
+		b.entries = make(map[StatsKey]*bucketEntry)
+		w.pruneTotals(slot)
+	}
+
+	e, ok := b.entries[key]
+	if !ok {
+		e = &bucketEntry{}
+		b.entries[key] = e
+	}
+	e.count++
+
+	// reservoir sampling keeps latency sample representative once bucket is full
+	if len(e.samples) < latencySamplesPerBucket {
+		e.samples = append(e.samples, ms)
+	} else if j := rand.Int63n(e.count); j < latencySamplesPerBucket {
+		e.samples[j] = ms
+	}
+
+	t, ok := w.totals[key]
+	if !ok {
+		t = &statsTotal{}
+		w.totals[key] = t
+	}
+	t.count++
+	t.slot = slot
+}
+
+// pruneTotals - drops totals of keys that weren't observed in any bucket, so keys (i.e. arbitrary hosts in
+// proxy mode) don't accumulate for the life of the process
+func (w *WindowedStats) pruneTotals(slot int64) {
+	for key, t := range w.totals {
+		if t.slot <= slot-statsBucketCount {
+			delete(w.totals, key)
+		}
+	}
+}
+
+// Breakdown - returns stats for requests observed within the window, most frequent first
+func (w *WindowedStats) Breakdown(window time.Duration, now time.Time) []BreakdownEntry {
+	last := bucketSlot(now)
+	first := last - int64(window/statsBucketWidth) + 1
+
+	counts := make(map[StatsKey]int64)
+	samples := make(map[StatsKey][]float64)
+
+	w.mu.Lock()
+	for i := range w.buckets {
+		b := &w.buckets[i]
+		if b.entries == nil || b.slot < first || b.slot > last {
+			continue
+		}
+		for key, e := range b.entries {
+			counts[key] += e.count
+			samples[key] = append(samples[key], e.samples...)
+		}
+	}
+	w.mu.Unlock()
+
+	entries := []BreakdownEntry{}
+	for key, count := range counts {
+		entries = append(entries, BreakdownEntry{
+			StatsKey: key,
+			Count:    count,
+			Rate:     float64(count) / window.Seconds(),
+			Latency:  newLatencyStats(samples[key]),
+		})
+	}
+
+	sort.Sort(byCount(entries))
+	return entries
+}
+
+// Totals - returns number of requests observed for each key since start or last reset. Keys not observed
+// within the longest window are dropped, their totals start over when they are observed again.
+func (w *WindowedStats) Totals() map[StatsKey]int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	totals := make(map[StatsKey]int64, len(w.totals))
+	for k, t := range w.totals {
+		totals[k] = t.count
+	}
+	return totals
+}
+
+// Reset - removes all observed requests
+func (w *WindowedStats) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for i := range w.buckets {
+		w.buckets[i] = statsBucket{}
+	}
+	w.totals = make(map[StatsKey]*statsTotal)
+}
+
+// statsDeltas - returns changes between two totals snapshots, keys that disappeared because of reset
+// are ignored
+func statsDeltas(previous, current map[StatsKey]int64) []StatsDelta {
+	var deltas []StatsDelta
+	for key, count := range current {
+		last := previous[key]
+		if count < last {
+			// stats were reset since previous snapshot
+			last = 0
+		}
+		if count != last {
+			deltas = append(deltas, StatsDelta{StatsKey: key, Count: count - last})
+		}
+	}
+	sort.Sort(deltasByKey(deltas))
+	return deltas
+}
+
+func newLatencyStats(samples []float64) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	sort.Float64s(samples)
+
+	var sum float64
+	for _, s := range samples {
+		sum += s
+	}
+
+	percentile := func(p float64) float64 {
+		i := int(p*float64(len(samples))+0.5) - 1
+		if i < 0 {
+			i = 0
+		}
+		if i >= len(samples) {
+			i = len(samples) - 1
+		}
+		return samples[i]
+	}
+
+	return LatencyStats{
+		Mean: sum / float64(len(samples)),
+		Max:  samples[len(samples)-1],
+		P50:  percentile(0.5),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+	}
+}
+
+func (k StatsKey) less(o StatsKey) bool {
+	if k.Destination != o.Destination {
+		return k.Destination < o.Destination
+	}
+	if k.Path != o.Path {
+		return k.Path < o.Path
+	}
+	return k.StatusClass < o.StatusClass
+}
+
+type byCount []BreakdownEntry
+
+func (e byCount) Len() int      { return len(e) }
+func (e byCount) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e byCount) Less(i, j int) bool {
+	if e[i].Count != e[j].Count {
+		return e[i].Count > e[j].Count
+	}
+	return e[i].StatsKey.less(e[j].StatsKey)
+}
+
+type deltasByKey []StatsDelta
+
+func (d deltasByKey) Len() int           { return len(d) }
+func (d deltasByKey) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d deltasByKey) Less(i, j int) bool { return d[i].StatsKey.less(d[j].StatsKey) }
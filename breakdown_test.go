@@ -0,0 +1,150 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPathTemplate(t *testing.T) {
+	expect(t, pathTemplate("/users/123/orders"), "/users/{id}/orders")
+	expect(t, pathTemplate("/users/6ba7b810-9dad-11d1-80b4-00c04fd430c8"), "/users/{uuid}")
+	expect(t, pathTemplate("/commits/5f3a9c2e8b7d4a1f"), "/commits/{id}")
+	expect(t, pathTemplate("/api/v2/status"), "/api/v2/status")
+	expect(t, pathTemplate("/"), "/")
+}
+
+func TestStatusClass(t *testing.T) {
+	expect(t, statusClass(200), "2xx")
+	expect(t, statusClass(404), "4xx")
+	expect(t, statusClass(503), "5xx")
+	expect(t, statusClass(0), "none")
+}
+
+func TestWindowedStatsBreakdown(t *testing.T) {
+	ws := NewWindowedStats()
+	now := time.Now()
+
+	// older than 5 minutes, only in 1h window
+	ws.Observe("api.com", "/users/1", 200, 40*time.Millisecond, now.Add(-10*time.Minute))
+	// older than a minute, in 5m and 1h windows
+	ws.Observe("api.com", "/users/2", 200, 30*time.Millisecond, now.Add(-3*time.Minute))
+
+	ws.Observe("api.com", "/users/3", 200, 10*time.Millisecond, now)
+	ws.Observe("api.com", "/users/4", 200, 20*time.Millisecond, now)
+	ws.Observe("api.com", "/users/5", 404, 5*time.Millisecond, now)
+
+	minute := ws.Breakdown(time.Minute, now)
+	expect(t, len(minute), 2)
+	expect(t, minute[0].StatsKey, StatsKey{Destination: "api.com", Path: "/users/{id}", StatusClass: "2xx"})
+	expect(t, minute[0].Count, int64(2))
+	expect(t, minute[0].Latency.Max, float64(20))
+	expect(t, minute[0].Latency.P50, float64(10))
+	expect(t, minute[1].StatusClass, "4xx")
+
+	fiveMinutes := ws.Breakdown(5*time.Minute, now)
+	expect(t, fiveMinutes[0].Count, int64(3))
+
+	hour := ws.Breakdown(time.Hour, now)
+	expect(t, hour[0].Count, int64(4))
+	expect(t, hour[0].Latency.Max, float64(40))
+
+	ws.Reset()
+	expect(t, len(ws.Breakdown(time.Hour, now)), 0)
+	expect(t, len(ws.Totals()), 0)
+}
+
+func TestWindowedStatsPrunesTotals(t *testing.T) {
+	ws := NewWindowedStats()
+	now := time.Now()
+
+	ws.Observe("old.com", "/", 200, time.Millisecond, now.Add(-2*time.Hour))
+	expect(t, len(ws.Totals()), 1)
+
+	// keys not observed within the last hour are dropped when a new bucket starts
+	ws.Observe("recent.com", "/", 200, time.Millisecond, now.Add(-30*time.Minute))
+	ws.Observe("recent.com", "/", 200, time.Millisecond, now)
+	totals := ws.Totals()
+	expect(t, len(totals), 1)
+	expect(t, totals[StatsKey{Destination: "recent.com", Path: "/", StatusClass: "2xx"}], int64(2))
+}
+
+func TestStatsDeltas(t *testing.T) {
+	users := StatsKey{Destination: "api.com", Path: "/users", StatusClass: "2xx"}
+	orders := StatsKey{Destination: "api.com", Path: "/orders", StatusClass: "2xx"}
+
+	deltas := statsDeltas(
+		map[StatsKey]int64{users: 3, orders: 1},
+		map[StatsKey]int64{users: 5, orders: 1},
+	)
+	expect(t, len(deltas), 1)
+	expect(t, deltas[0].StatsKey, users)
+	expect(t, deltas[0].Count, int64(2))
+
+	// after reset current totals are smaller than previous ones
+	deltas = statsDeltas(map[StatsKey]int64{users: 5}, map[StatsKey]int64{users: 1})
+	expect(t, deltas[0].Count, int64(1))
+}
+
+func TestStatsBreakdownHandler(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Cfg.SetMode(VirtualizeMode)
+
+	r, _ := http.NewRequest("GET", "http://breakdown.com/items/42", nil)
+	dbClient.processRequest(r)
+
+	m := getBoneRouter(*dbClient)
+
+	req, err := http.NewRequest("GET", "/stats/breakdown?window=5m", nil)
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+
+	var response statsBreakdownResponse
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	expect(t, err, nil)
+	expect(t, response.Window, "5m")
+	expect(t, len(response.Data), 1)
+	expect(t, response.Data[0].Destination, "breakdown.com")
+	expect(t, response.Data[0].Path, "/items/{id}")
+	// request wasn't recorded
+	expect(t, response.Data[0].StatusClass, "4xx")
+
+	req, err = http.NewRequest("GET", "/stats/breakdown?window=2d", nil)
+	expect(t, err, nil)
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusBadRequest)
+}
+
+func TestResetStatsHandler(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	dbClient.Counter.Count(VirtualizeMode)
+	dbClient.Counter.Observe(time.Millisecond, MatchResultHit)
+	dbClient.Counter.Windows.Observe("api.com", "/", 200, time.Millisecond, time.Now())
+
+	m := getBoneRouter(*dbClient)
+
+	req, err := http.NewRequest("DELETE", "/stats", nil)
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+
+	stats := dbClient.Counter.Flush()
+	expect(t, stats.Counters[VirtualizeMode], int64(0))
+	expect(t, stats.Counters[MetricMatchHit], int64(0))
+	expect(t, stats.Timers[MetricLatency].Count, int64(0))
+	expect(t, len(dbClient.Counter.Windows.Totals()), 0)
+}
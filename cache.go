@@ -16,6 +16,7 @@ type Cache interface {
 	RecordsCount() (int, error)
 	DeleteData() error
 	GetAllKeys() (map[string]bool, error)
+	Restore(entries map[string][]byte) error
 	CloseDB()
 }
 
@@ -145,6 +146,28 @@ func (c *BoltCache) DeleteData() error {
 	return err
 }
 
+// Restore - replaces all saved data with given entries in a single transaction, so cache is either fully restored
+// or left as it was
+func (c *BoltCache) Restore(entries map[string][]byte) error {
+	return c.DS.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(c.RequestsBucket) != nil {
+			if err := tx.DeleteBucket(c.RequestsBucket); err != nil {
+				return err
+			}
+		}
+		bucket, err := tx.CreateBucket(c.RequestsBucket)
+		if err != nil {
+			return err
+		}
+		for key, value := range entries {
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // DeleteBucket - deletes bucket with all saved data
 func (c *BoltCache) DeleteBucket(name []byte) (err error) {
 	err = c.DS.Update(func(tx *bolt.Tx) error {
@@ -179,3 +179,23 @@ func TestGetAllKeysEmpty(t *testing.T) {
 	expect(t, err, nil)
 	expect(t, len(keys), 0)
 }
+
+func TestRestore(t *testing.T) {
+	server, dbClient := testTools(201, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Cache.Set([]byte("stale"), []byte("value"))
+
+	err := dbClient.Cache.Restore(map[string][]byte{"key1": []byte("value1"), "key2": []byte("value2")})
+	expect(t, err, nil)
+
+	keys, err := dbClient.Cache.GetAllKeys()
+	expect(t, err, nil)
+	expect(t, len(keys), 2)
+	expect(t, keys["stale"], false)
+
+	value, err := dbClient.Cache.Get([]byte("key1"))
+	expect(t, err, nil)
+	expect(t, string(value), "value1")
+}
@@ -0,0 +1,366 @@
+package hoverfly
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// DefaultCallbackRetryDelay - delay between callback attempts when retry delay is not supplied
+	DefaultCallbackRetryDelay = 1000
+	// MaxCallbackDelay - longest delay before first attempt and between attempts, in milliseconds
+	MaxCallbackDelay = 60000
+	// MaxCallbackRetries - most retries a callback can ask for
+	MaxCallbackRetries = 10
+	// DefaultCallbackWorkers - how many callbacks are sent at the same time
+	DefaultCallbackWorkers = 10
+	// DefaultCallbackQueueSize - how many callbacks can wait for their delay or a free worker, callbacks
+	// beyond that are dropped
+	DefaultCallbackQueueSize = 1000
+)
+
+// Callback - outbound request that Hoverfly sends after serving payload response, used to simulate
+// webhooks. URL, header values and Body are text/templates with access to .Request (incoming request
+// details), .Response (served response details) and fake data functions (see Faker.FuncMap).
+type Callback struct {
+	URL     string              `json:"url"`
+	Method  string              `json:"method"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    string              `json:"body,omitempty"`
+	// Delay before first attempt in milliseconds
+	Delay int `json:"delay,omitempty"`
+	// Retries - how many times failed callback (connection error or 5xx status) is retried
+	Retries int `json:"retries,omitempty"`
+	// RetryDelay between attempts in milliseconds
+	RetryDelay int `json:"retryDelay,omitempty"`
+}
+
+// callbackData - data available to callback templates
+type callbackData struct {
+	Request  RequestDetails
+	Response ResponseDetails
+}
+
+// Validate - checks whether callback templates can be parsed
+func (cb *Callback) Validate() error {
+	if cb.URL == "" {
+		return fmt.Errorf("callback URL not specified")
+	}
+	if cb.Delay < 0 || cb.Retries < 0 || cb.RetryDelay < 0 {
+		return fmt.Errorf("callback delay, retries and retry delay can't be negative")
+	}
+	if cb.Delay > MaxCallbackDelay || cb.RetryDelay > MaxCallbackDelay {
+		return fmt.Errorf("callback delay and retry delay can't be longer than %d ms", MaxCallbackDelay)
+	}
+	if cb.Retries > MaxCallbackRetries {
+		return fmt.Errorf("callback can't be retried more than %d times", MaxCallbackRetries)
+	}
+	funcs := templateFuncs(nil)
+	for _, t := range cb.templates() {
+		if _, err := template.New("callback").Funcs(funcs).Parse(t); err != nil {
+			return fmt.Errorf("invalid callback template '%s': %s", t, err.Error())
+		}
+	}
+	return nil
+}
+
+// validateCallbacks - checks all payload callbacks
+func (p *Payload) validateCallbacks() error {
+	for i := range p.Callbacks {
+		if err := p.Callbacks[i].Validate(); err != nil {
+			return fmt.Errorf("callback %d: %s", i, err.Error())
+		}
+	}
+	return nil
+}
+
+func (cb *Callback) templates() []string {
+	t := []string{cb.URL, cb.Body}
+	for _, values := range cb.Headers {
+		t = append(t, values...)
+	}
+	return t
+}
+
+// render - renders callback templates and returns request details for outbound request
+func (cb *Callback) render(data callbackData, funcs template.FuncMap) (details RequestDetails, url string, err error) {
+	execute := func(text string) (string, error) {
+		tmpl, err := template.New("callback").Funcs(funcs).Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	if url, err = execute(cb.URL); err != nil {
+		return
+	}
+
+	body, err := execute(cb.Body)
+	if err != nil {
+		return
+	}
+
+	headers := make(map[string][]string)
+	for k, values := range cb.Headers {
+		for _, v := range values {
+			rendered, err := execute(v)
+			if err != nil {
+				return details, url, err
+			}
+			headers[k] = append(headers[k], rendered)
+		}
+	}
+
+	method := cb.Method
+	if method == "" {
+		method = "POST"
+	}
+
+	details = RequestDetails{
+		Method:  method,
+		Body:    body,
+		Headers: headers,
+	}
+	return details, url, nil
+}
+
+// CallbackScheduler - sends callbacks in the background. Delays are waited for with timers instead of
+// sleeping goroutines and due callbacks are sent by a fixed number of workers. Callbacks beyond queue
+// capacity are dropped, Close cancels the ones that are still pending.
+type CallbackScheduler struct {
+	queue chan func(done <-chan struct{})
+	done  chan struct{}
+	wg    sync.WaitGroup
+
+	mu      sync.Mutex
+	size    int
+	pending int
+	closed  bool
+}
+
+// NewCallbackScheduler - returns scheduler sending callbacks with given number of workers, at most size
+// callbacks can be pending. Non-positive values fall back to defaults.
+func NewCallbackScheduler(workers, size int) *CallbackScheduler {
+	if workers <= 0 {
+		workers = DefaultCallbackWorkers
+	}
+	if size <= 0 {
+		size = DefaultCallbackQueueSize
+	}
+	s := &CallbackScheduler{
+		queue: make(chan func(done <-chan struct{}), size),
+		done:  make(chan struct{}),
+		size:  size,
+	}
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	return s
+}
+
+// Schedule - runs send after delay, returns false when the callback was dropped because too many
+// callbacks are pending or scheduler is closed. Send should give up once done is closed.
+func (s *CallbackScheduler) Schedule(delay time.Duration, send func(done <-chan struct{})) bool {
+	s.mu.Lock()
+	if s.closed || s.pending >= s.size {
+		s.mu.Unlock()
+		return false
+	}
+	s.pending++
+	s.mu.Unlock()
+
+	time.AfterFunc(delay, func() {
+		select {
+		case <-s.done:
+			s.finish()
+		default:
+			// queue capacity equals pending limit, so this never blocks
+			s.queue <- send
+		}
+	})
+	return true
+}
+
+// Close - cancels pending callbacks and waits for the ones that are being sent
+func (s *CallbackScheduler) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Pending - returns how many callbacks are waiting or being sent
+func (s *CallbackScheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+func (s *CallbackScheduler) work() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.done:
+			return
+		case send := <-s.queue:
+			send(s.done)
+			s.finish()
+		}
+	}
+}
+
+func (s *CallbackScheduler) finish() {
+	s.mu.Lock()
+	s.pending--
+	s.mu.Unlock()
+}
+
+// scheduleCallbacks - sends payload callbacks in the background
+func (d *DBClient) scheduleCallbacks(key string, request RequestDetails, payload Payload) {
+	for _, cb := range payload.Callbacks {
+		cb := cb
+		data := callbackData{Request: request, Response: payload.Response}
+		send := func(done <-chan struct{}) { d.sendCallback(key, cb, data, done) }
+
+		if !d.Callbacks.Schedule(time.Duration(cb.Delay)*time.Millisecond, send) {
+			d.recordCallback(JournalEntry{
+				Type:  JournalEntryCallback,
+				Time:  time.Now(),
+				Key:   key,
+				Error: "callback dropped, too many callbacks are pending",
+			})
+		}
+	}
+}
+
+// sendCallback - sends the request (retrying if needed) and records the result in the journal, retries
+// stop once done is closed
+func (d *DBClient) sendCallback(key string, cb Callback, data callbackData, done <-chan struct{}) {
+	entry := JournalEntry{
+		Type: JournalEntryCallback,
+		Time: time.Now(),
+		Key:  key,
+	}
+
+	details, url, err := cb.render(data, templateFuncs(d.Faker))
+	if err != nil {
+		entry.Error = fmt.Sprintf("failed to render callback: %s", err.Error())
+		d.recordCallback(entry)
+		return
+	}
+
+	retryDelay := cb.RetryDelay
+	if retryDelay == 0 {
+		retryDelay = DefaultCallbackRetryDelay
+	}
+
+	for attempt := 1; attempt <= cb.Retries+1; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-done:
+				reason := entry.Error
+				if entry.Response != nil {
+					reason = fmt.Sprintf("status %d", entry.Response.Status)
+				}
+				entry.Error = fmt.Sprintf("callback cancelled before retry, last attempt failed with %s", reason)
+				d.recordCallback(entry)
+				return
+			case <-time.After(time.Duration(retryDelay) * time.Millisecond):
+			}
+		}
+
+		entry.Attempts = attempt
+		entry.Time = time.Now()
+
+		resp, requestDetails, err := d.doCallbackRequest(url, details)
+		entry.Request = requestDetails
+		entry.Latency = float64(time.Since(entry.Time)) / float64(time.Millisecond)
+
+		if err != nil {
+			entry.Error = err.Error()
+			entry.Response = nil
+			continue
+		}
+
+		entry.Error = ""
+		entry.Response = resp
+
+		if resp.Status < 500 {
+			break
+		}
+	}
+
+	d.recordCallback(entry)
+}
+
+// doCallbackRequest - performs single callback attempt
+func (d *DBClient) doCallbackRequest(url string, details RequestDetails) (*ResponseDetails, RequestDetails, error) {
+	req, err := http.NewRequest(details.Method, url, bytes.NewBufferString(details.Body))
+	if err != nil {
+		return nil, details, err
+	}
+	for k, values := range details.Headers {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+
+	rd := RequestDetails{
+		Path:        req.URL.Path,
+		Method:      req.Method,
+		Destination: req.URL.Host,
+		Scheme:      req.URL.Scheme,
+		Query:       req.URL.RawQuery,
+		Body:        details.Body,
+		Headers:     req.Header,
+	}
+
+	resp, err := d.HTTP.Do(req)
+	if err != nil {
+		return nil, rd, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, rd, err
+	}
+
+	return &ResponseDetails{Status: resp.StatusCode, Body: string(body), Headers: resp.Header}, rd, nil
+}
+
+func (d *DBClient) recordCallback(entry JournalEntry) {
+	fields := log.Fields{
+		"key":         entry.Key,
+		"method":      entry.Request.Method,
+		"destination": entry.Request.Destination,
+		"path":        entry.Request.Path,
+		"attempts":    entry.Attempts,
+	}
+
+	if entry.Error != "" {
+		fields["error"] = entry.Error
+		log.WithFields(fields).Warn("callback failed")
+	} else {
+		fields["status"] = entry.Response.Status
+		log.WithFields(fields).Info("callback sent")
+	}
+
+	d.Journal.Add(entry)
+}
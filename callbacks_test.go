@@ -0,0 +1,215 @@
+package hoverfly
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// waitForJournal - callbacks are sent in the background, polling journal until entries appear
+func waitForJournal(j *Journal, entryType string, count int) []JournalEntry {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if entries := j.Entries(entryType, 0); len(entries) >= count {
+			return entries
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return j.Entries(entryType, 0)
+}
+
+func TestCallbackSentAfterResponse(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	receivedBody := make(chan string, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		receivedBody <- string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer webhook.Close()
+
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+	dbClient.HTTP = &http.Client{}
+
+	payload := Payload{
+		Request:  RequestDetails{Destination: "payments.com", Path: "/charge", Method: "POST", Body: "amount=10"},
+		Response: ResponseDetails{Status: 202, Body: "charge-1"},
+		Callbacks: []Callback{
+			{
+				URL:     webhook.URL + "/webhook?id={{.Response.Body}}",
+				Method:  "PUT",
+				Headers: map[string][]string{"X-Charge": []string{"{{.Request.Body}}"}},
+				Body:    `{"charge": "{{.Response.Body}}", "status": "paid"}`,
+				Delay:   10,
+			},
+		},
+	}
+	err := dbClient.ImportPayloads([]Payload{payload})
+	expect(t, err, nil)
+
+	req, _ := http.NewRequest("POST", "http://payments.com/charge", ioutil.NopCloser(bytes.NewBufferString("amount=10")))
+	response := dbClient.getResponse(req)
+	expect(t, response.StatusCode, 202)
+
+	select {
+	case r := <-received:
+		expect(t, r.Method, "PUT")
+		expect(t, r.URL.Path, "/webhook")
+		expect(t, r.URL.RawQuery, "id=charge-1")
+		expect(t, r.Header.Get("X-Charge"), "amount=10")
+		expect(t, <-receivedBody, `{"charge": "charge-1", "status": "paid"}`)
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback was not sent")
+	}
+
+	entries := waitForJournal(dbClient.Journal, JournalEntryCallback, 1)
+	expect(t, len(entries), 1)
+	expect(t, entries[0].Attempts, 1)
+	expect(t, entries[0].Error, "")
+	expect(t, entries[0].Response.Status, http.StatusAccepted)
+	expect(t, entries[0].Request.Path, "/webhook")
+}
+
+func TestCallbackRetries(t *testing.T) {
+	attempts := 0
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhook.Close()
+
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	dbClient.HTTP = &http.Client{}
+
+	cb := Callback{URL: webhook.URL, Retries: 3, RetryDelay: 1}
+	dbClient.sendCallback("key", cb, callbackData{}, nil)
+
+	entries := dbClient.Journal.Entries(JournalEntryCallback, 0)
+	expect(t, len(entries), 1)
+	expect(t, entries[0].Attempts, 3)
+	expect(t, entries[0].Response.Status, http.StatusOK)
+	expect(t, entries[0].Request.Method, "POST")
+}
+
+func TestCallbackFailureRecorded(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// nothing is listening anymore
+	webhook.Close()
+
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	dbClient.HTTP = &http.Client{}
+
+	cb := Callback{URL: webhook.URL, Retries: 1, RetryDelay: 1}
+	dbClient.sendCallback("key", cb, callbackData{}, nil)
+
+	entries := dbClient.Journal.Entries(JournalEntryCallback, 0)
+	expect(t, len(entries), 1)
+	expect(t, entries[0].Attempts, 2)
+	refute(t, entries[0].Error, "")
+	expect(t, entries[0].Response, (*ResponseDetails)(nil))
+}
+
+func TestInvalidCallbackNotImported(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	payload := Payload{
+		Request:   RequestDetails{Destination: "payments.com", Path: "/charge", Method: "POST"},
+		Response:  ResponseDetails{Status: 202},
+		Callbacks: []Callback{{URL: "http://{{.Request.Path"}},
+	}
+	err := dbClient.ImportPayloads([]Payload{payload})
+	expect(t, err, nil)
+
+	count, err := dbClient.Cache.RecordsCount()
+	expect(t, err, nil)
+	expect(t, count, 0)
+}
+
+func TestCallbackLimits(t *testing.T) {
+	cb := Callback{URL: "http://webhook.com", Delay: MaxCallbackDelay + 1}
+	refute(t, cb.Validate(), nil)
+
+	cb = Callback{URL: "http://webhook.com", RetryDelay: MaxCallbackDelay + 1}
+	refute(t, cb.Validate(), nil)
+
+	cb = Callback{URL: "http://webhook.com", Retries: MaxCallbackRetries + 1}
+	refute(t, cb.Validate(), nil)
+
+	cb = Callback{URL: "http://webhook.com", Delay: MaxCallbackDelay, RetryDelay: MaxCallbackDelay, Retries: MaxCallbackRetries}
+	expect(t, cb.Validate(), nil)
+}
+
+func TestCallbackSchedulerDropsWhenFull(t *testing.T) {
+	s := NewCallbackScheduler(1, 1)
+	defer s.Close()
+
+	sent := make(chan struct{}, 2)
+	send := func(done <-chan struct{}) { sent <- struct{}{} }
+
+	expect(t, s.Schedule(time.Hour, send), true)
+	expect(t, s.Schedule(0, send), false)
+	expect(t, s.Pending(), 1)
+}
+
+func TestCallbackSchedulerClose(t *testing.T) {
+	s := NewCallbackScheduler(1, 10)
+
+	sent := make(chan struct{}, 1)
+	expect(t, s.Schedule(time.Hour, func(done <-chan struct{}) { sent <- struct{}{} }), true)
+
+	// sending callback is told to stop and Close waits for it
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	expect(t, s.Schedule(0, func(done <-chan struct{}) {
+		close(started)
+		<-done
+		close(cancelled)
+	}), true)
+	<-started
+
+	s.Close()
+
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("Close returned before sending callback stopped")
+	}
+	expect(t, len(sent), 0)
+	expect(t, s.Schedule(0, func(done <-chan struct{}) {}), false)
+}
+
+func TestCallbackRetriesStopOnClose(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer webhook.Close()
+
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	dbClient.HTTP = &http.Client{}
+
+	done := make(chan struct{})
+	close(done)
+
+	cb := Callback{URL: webhook.URL, Retries: MaxCallbackRetries, RetryDelay: MaxCallbackDelay}
+	dbClient.sendCallback("key", cb, callbackData{}, done)
+
+	entries := dbClient.Journal.Entries(JournalEntryCallback, 0)
+	expect(t, len(entries), 1)
+	expect(t, entries[0].Attempts, 1)
+	expect(t, entries[0].Error, "callback cancelled before retry, last attempt failed with status 503")
+}
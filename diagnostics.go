@@ -0,0 +1,269 @@
+package hoverfly
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"runtime"
+	"runtime/pprof"
+	"time"
+	"unicode"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+)
+
+// Version - Hoverfly version, set during build with
+// -ldflags "-X github.com/SpectoLabs/hoverfly.Version=v0.5.17"
+var Version = "dev"
+
+// diagnosticsJournalSample - how many most recent journal entries are included in diagnostics bundle
+const diagnosticsJournalSample = 100
+
+// redacted - replaces secret configuration values in diagnostics bundle
+const redacted = "[redacted]"
+
+// VersionInfo - describes Hoverfly build
+type VersionInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+// GetVersionInfo - returns version of running Hoverfly
+func GetVersionInfo() VersionInfo {
+	return VersionInfo{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+}
+
+// BucketStats - statistics of single BoltDB bucket
+type BucketStats struct {
+	Name        string `json:"name"`
+	Keys        int    `json:"keys"`
+	Depth       int    `json:"depth"`
+	LeafPages   int    `json:"leafPages"`
+	LeafInuse   int    `json:"leafInuse"`
+	BranchPages int    `json:"branchPages"`
+}
+
+// DatabaseStats - BoltDB database and bucket statistics
+type DatabaseStats struct {
+	Path    string        `json:"path"`
+	Size    int64         `json:"size"`
+	Buckets []BucketStats `json:"buckets"`
+}
+
+// DatabaseStats - returns statistics of all buckets in the database
+func (c *BoltCache) DatabaseStats() (stats DatabaseStats, err error) {
+	stats.Path = c.DS.Path()
+	stats.Buckets = []BucketStats{}
+
+	err = c.DS.View(func(tx *bolt.Tx) error {
+		stats.Size = tx.Size()
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			s := b.Stats()
+			stats.Buckets = append(stats.Buckets, BucketStats{
+				Name:        string(name),
+				Keys:        s.KeyN,
+				Depth:       s.Depth,
+				LeafPages:   s.LeafPageN,
+				LeafInuse:   s.LeafInuse,
+				BranchPages: s.BranchPageN,
+			})
+			return nil
+		})
+	})
+	return
+}
+
+// configRedactions - configuration fields carrying secrets, mapped to their redacted values
+var configRedactions = map[string]func(v reflect.Value) interface{}{
+	"SecretKey": func(v reflect.Value) interface{} {
+		if v.Len() > 0 {
+			return redacted
+		}
+		return ""
+	},
+	"TracingEndpoint": redactURLValue,
+	"ReplicateFrom":   redactURLValue,
+	"ReplicateTo":     redactURLValue,
+	"Registry":        redactURLValue,
+}
+
+// redactURLValue - removes passwords from URL or list of URLs
+func redactURLValue(v reflect.Value) interface{} {
+	if v.Kind() == reflect.Slice {
+		urls := make([]string, v.Len())
+		for i := range urls {
+			urls[i] = redactURL(v.Index(i).String())
+		}
+		return urls
+	}
+	return redactURL(v.String())
+}
+
+// redactedConfig - returns effective configuration without secrets. All exported fields are included, so new
+// settings are reported without changes here, fields with secrets have to be listed in configRedactions.
+func (c *Configuration) redactedConfig() map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config := make(map[string]interface{})
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		value := v.Field(i)
+		name := lowerCamelCase(field.Name)
+		switch {
+		case configRedactions[field.Name] != nil:
+			config[name] = configRedactions[field.Name](value)
+		case value.Type() == reflect.TypeOf(time.Duration(0)):
+			config[name] = time.Duration(value.Int()).String()
+		default:
+			config[name] = value.Interface()
+		}
+	}
+	return config
+}
+
+// lowerCamelCase - returns field name as JSON key, i.e. "AdminPort" is "adminPort" and "JWTExpirationDelta"
+// is "jwtExpirationDelta"
+func lowerCamelCase(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		// last capital of an acronym starts the next word
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// redactURL - removes password from URL user info
+func redactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// diagnosticsFile - single file in diagnostics bundle
+type diagnosticsFile struct {
+	name    string
+	content func() ([]byte, error)
+}
+
+func jsonContent(f func() (interface{}, error)) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		v, err := f()
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(v, "", "  ")
+	}
+}
+
+func (d *DBClient) diagnosticsFiles() []diagnosticsFile {
+	return []diagnosticsFile{
+		{"version.json", jsonContent(func() (interface{}, error) {
+			return GetVersionInfo(), nil
+		})},
+		{"config.json", jsonContent(func() (interface{}, error) {
+			return d.Cfg.redactedConfig(), nil
+		})},
+		{"stats.json", jsonContent(func() (interface{}, error) {
+			count, err := d.Cache.RecordsCount()
+			if err != nil {
+				return nil, err
+			}
+			return statsResponse{Stats: d.Counter.Flush(), RecordsCount: count}, nil
+		})},
+		{"logs.json", jsonContent(func() (interface{}, error) {
+			if d.Logging == nil {
+				return []LogEntry{}, nil
+			}
+			return d.Logging.Entries(log.DebugLevel, "", 0), nil
+		})},
+		{"journal.json", jsonContent(func() (interface{}, error) {
+			return d.Journal.Entries("", diagnosticsJournalSample), nil
+		})},
+		{"database.json", jsonContent(func() (interface{}, error) {
+			bc, ok := d.Cache.(*BoltCache)
+			if !ok {
+				return nil, fmt.Errorf("cache is not backed by BoltDB")
+			}
+			return bc.DatabaseStats()
+		})},
+		{"goroutines.txt", func() ([]byte, error) {
+			var buf bytes.Buffer
+			err := pprof.Lookup("goroutine").WriteTo(&buf, 2)
+			return buf.Bytes(), err
+		}},
+	}
+}
+
+// WriteDiagnostics - writes zip bundle with information useful when debugging Hoverfly. Sections that
+// can't be collected are listed in errors.json instead of failing the whole bundle.
+func (d *DBClient) WriteDiagnostics(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	created := time.Now()
+
+	failed := make(map[string]string)
+	for _, f := range d.diagnosticsFiles() {
+		content, err := f.content()
+		if err != nil {
+			failed[f.name] = err.Error()
+			continue
+		}
+		if err := writeZipFile(zw, f.name, created, content); err != nil {
+			return err
+		}
+	}
+
+	if len(failed) > 0 {
+		content, err := json.MarshalIndent(failed, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeZipFile(zw, "errors.json", created, content); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, name string, modified time.Time, content []byte) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+	header.SetModTime(modified)
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
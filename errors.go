@@ -0,0 +1,210 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"text/template"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// HoverflyErrorHeader - header added to every response generated by Hoverfly because of an error,
+// value is the error kind
+const HoverflyErrorHeader = "Hoverfly-Error"
+
+// Error kinds, used to pick error template and as HoverflyErrorHeader value
+const (
+	// ErrorKindMiss - request was not found in cache
+	ErrorKindMiss = "miss"
+	// ErrorKindVirtualize - payload was found but could not be used
+	ErrorKindVirtualize = "virtualize"
+	// ErrorKindCapture - request could not be forwarded or captured
+	ErrorKindCapture = "capture"
+	// ErrorKindSynthesize - middleware failed to create synthetic response
+	ErrorKindSynthesize = "synthesize"
+	// ErrorKindModify - middleware failed to modify request or response
+	ErrorKindModify = "modify"
+)
+
+// default status codes for each error kind
+var defaultErrorStatus = map[string]int{
+	ErrorKindMiss:       http.StatusPreconditionFailed,
+	ErrorKindVirtualize: http.StatusInternalServerError,
+	ErrorKindCapture:    http.StatusServiceUnavailable,
+	ErrorKindSynthesize: http.StatusServiceUnavailable,
+	ErrorKindModify:     http.StatusServiceUnavailable,
+}
+
+// ErrorTemplate - describes response returned by Hoverfly when it can't serve a request. Destination is a
+// regular expression matched against request host, empty Destination or Kind match everything. Body is
+// a text/template with access to ErrorDetails fields and fake data functions (see Faker.FuncMap), e.g.
+// {"error": "{{.Reason}}", "key": "{{.Key}}", "id": "{{fakeUUID}}"}
+type ErrorTemplate struct {
+	Destination string              `json:"destination"`
+	Kind        string              `json:"kind"`
+	Status      int                 `json:"status"`
+	Headers     map[string][]string `json:"headers"`
+	Body        string              `json:"body"`
+
+	destination *regexp.Regexp
+	body        *template.Template
+}
+
+// ErrorDetails - data available to error template bodies
+type ErrorDetails struct {
+	Kind        string
+	Reason      string
+	Error       string
+	Key         string
+	Destination string
+	Path        string
+	Method      string
+	Status      int
+}
+
+type errorTemplates struct {
+	Data []ErrorTemplate `json:"data"`
+}
+
+// compile - compiles destination expression and body template once, so they aren't compiled for every
+// error response. Body is parsed with placeholder fake data functions, render swaps in the real ones.
+func (t *ErrorTemplate) compile() error {
+	var err error
+	if t.destination, err = regexp.Compile(t.Destination); err != nil {
+		return fmt.Errorf("invalid destination regexp '%s': %s", t.Destination, err.Error())
+	}
+	if t.body, err = template.New("error").Funcs(templateFuncs(nil)).Parse(t.Body); err != nil {
+		return fmt.Errorf("invalid body template: %s", err.Error())
+	}
+	return nil
+}
+
+// Validate - checks whether template can be used
+func (t *ErrorTemplate) Validate() error {
+	if t.Kind != "" {
+		if _, ok := defaultErrorStatus[t.Kind]; !ok {
+			return fmt.Errorf("unknown error kind '%s'", t.Kind)
+		}
+	}
+	if t.Status != 0 && (t.Status < 100 || t.Status > 599) {
+		return fmt.Errorf("invalid status code %d", t.Status)
+	}
+	return t.compile()
+}
+
+// matches - checks whether template is applicable for given destination and error kind
+func (t *ErrorTemplate) matches(destination, kind string) bool {
+	if t.Kind != "" && t.Kind != kind {
+		return false
+	}
+	if t.Destination == "" {
+		return true
+	}
+	return t.destination != nil && t.destination.MatchString(destination)
+}
+
+// render - creates error response from template
+func (t *ErrorTemplate) render(req *http.Request, details ErrorDetails, funcs template.FuncMap) (*http.Response, error) {
+	if t.Status != 0 {
+		details.Status = t.Status
+	}
+
+	if t.body == nil {
+		return nil, fmt.Errorf("body template is not compiled")
+	}
+	// compiled template is shared between requests, clone gets its own fake data functions
+	tmpl, err := t.body.Clone()
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Funcs(funcs)
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, details); err != nil {
+		return nil, err
+	}
+
+	response := &http.Response{
+		Request:       req,
+		StatusCode:    details.Status,
+		Header:        copyHeaders(t.Headers),
+		ContentLength: int64(body.Len()),
+		Body:          ioutil.NopCloser(&body),
+	}
+	if response.Header.Get("Content-Type") == "" {
+		response.Header.Set("Content-Type", "text/plain")
+	}
+	return response, nil
+}
+
+// LoadErrorTemplates - reads error templates from given JSON file
+func LoadErrorTemplates(path string) ([]ErrorTemplate, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Got error while opening error templates file, error %s", err.Error())
+	}
+	defer f.Close()
+
+	var templates errorTemplates
+	if err := json.NewDecoder(f).Decode(&templates); err != nil {
+		return nil, fmt.Errorf("Got error while parsing error templates file, error %s", err.Error())
+	}
+
+	for i := range templates.Data {
+		if err := templates.Data[i].Validate(); err != nil {
+			return nil, fmt.Errorf("Error template %d is not valid: %s", i, err.Error())
+		}
+	}
+	return templates.Data, nil
+}
+
+// errorResponse - returns response for requests that Hoverfly could not serve, first error template
+// matching request destination and error kind is used, otherwise default text response is returned
+func (d *DBClient) errorResponse(req *http.Request, err error, msg, kind, key string) *http.Response {
+	details := ErrorDetails{
+		Kind:        kind,
+		Reason:      msg,
+		Error:       err.Error(),
+		Key:         key,
+		Destination: req.Host,
+		Path:        req.URL.Path,
+		Method:      req.Method,
+		Status:      defaultErrorStatus[kind],
+	}
+
+	var response *http.Response
+
+	if t := d.findErrorTemplate(req.Host, kind); t != nil {
+		resp, renderErr := t.render(req, details, templateFuncs(d.Faker))
+		if renderErr != nil {
+			log.WithFields(log.Fields{
+				"error":       renderErr.Error(),
+				"kind":        kind,
+				"destination": req.Host,
+			}).Error("Failed to render error template, using default error response")
+		}
+		response = resp
+	}
+
+	if response == nil {
+		response = hoverflyError(req, err, msg, details.Status)
+	}
+
+	response.Header.Set(HoverflyErrorHeader, kind)
+	return response
+}
+
+// findErrorTemplate - returns first error template matching given destination and error kind
+func (d *DBClient) findErrorTemplate(destination, kind string) *ErrorTemplate {
+	templates := d.Cfg.GetErrorTemplates()
+	for i := range templates {
+		if templates[i].matches(destination, kind) {
+			return &templates[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDefaultMissResponse(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	request, _ := http.NewRequest("GET", "http://error-templates.com/missing", nil)
+
+	response := dbClient.getResponse(request)
+
+	expect(t, response.StatusCode, http.StatusPreconditionFailed)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+	expect(t, response.Header.Get("Content-Type"), "text/plain")
+}
+
+func TestMissResponseTemplate(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	headers := make(map[string][]string)
+	headers["Content-Type"] = []string{"application/json"}
+
+	dbClient.Cfg.SetErrorTemplates([]ErrorTemplate{
+		{
+			Destination: "other.com",
+			Status:      500,
+			Body:        "wrong template",
+		},
+		{
+			Destination: "error-templates.com",
+			Kind:        ErrorKindMiss,
+			Status:      404,
+			Headers:     headers,
+			Body:        `{"error": "{{.Reason}}", "key": "{{.Key}}"}`,
+		},
+	})
+
+	request, _ := http.NewRequest("GET", "http://error-templates.com/missing", nil)
+
+	response := dbClient.getResponse(request)
+
+	expect(t, response.StatusCode, http.StatusNotFound)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+	expect(t, response.Header.Get("Content-Type"), "application/json")
+
+	body, err := ioutil.ReadAll(response.Body)
+	expect(t, err, nil)
+
+	var decoded map[string]string
+	err = json.Unmarshal(body, &decoded)
+	expect(t, err, nil)
+	expect(t, decoded["error"], "Could not find recorded request, please record it first!")
+	expect(t, decoded["key"], getRequestFingerprint(request, []byte("")))
+}
+
+func TestErrorTemplateKindMismatch(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	dbClient.Cfg.SetErrorTemplates([]ErrorTemplate{
+		{Kind: ErrorKindCapture, Status: 502, Body: "capture failed"},
+	})
+
+	request, _ := http.NewRequest("GET", "http://error-templates.com/missing", nil)
+
+	response := dbClient.getResponse(request)
+
+	expect(t, response.StatusCode, http.StatusPreconditionFailed)
+}
+
+func TestErrorTemplateValidation(t *testing.T) {
+	tmpl := ErrorTemplate{Kind: "unknown"}
+	refute(t, tmpl.Validate(), nil)
+
+	tmpl = ErrorTemplate{Status: 1000}
+	refute(t, tmpl.Validate(), nil)
+
+	tmpl = ErrorTemplate{Destination: "("}
+	refute(t, tmpl.Validate(), nil)
+
+	tmpl = ErrorTemplate{Body: "{{.Reason"}
+	refute(t, tmpl.Validate(), nil)
+
+	tmpl = ErrorTemplate{Kind: ErrorKindMiss, Status: 404, Body: "{{.Reason}}"}
+	expect(t, tmpl.Validate(), nil)
+}
+
+func TestErrorTemplateCompiledOnce(t *testing.T) {
+	tmpl := ErrorTemplate{Destination: "compiled.com", Body: `{{.Reason}} {{fakeUUID}}`}
+	expect(t, tmpl.Validate(), nil)
+	refute(t, tmpl.destination, nil)
+	refute(t, tmpl.body, nil)
+
+	expect(t, tmpl.matches("compiled.com", ErrorKindMiss), true)
+	expect(t, tmpl.matches("other.com", ErrorKindMiss), false)
+
+	// rendering uses supplied functions without changing compiled template
+	req, _ := http.NewRequest("GET", "http://compiled.com/", nil)
+	funcs := templateFuncs(nil)
+	funcs["fakeUUID"] = func() string { return "fixed" }
+	for i := 0; i < 2; i++ {
+		response, err := tmpl.render(req, ErrorDetails{Reason: "missing", Status: 412}, funcs)
+		expect(t, err, nil)
+		body, err := ioutil.ReadAll(response.Body)
+		expect(t, err, nil)
+		expect(t, string(body), "missing fixed")
+	}
+}
+
+func TestSetErrorTemplatesHandler(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	m := getBoneRouter(*dbClient)
+
+	body := `{"data": [{"kind": "miss", "status": 404, "body": "{{.Reason}}"}]}`
+
+	req, err := http.NewRequest("POST", "/error-templates", ioutil.NopCloser(bytes.NewBufferString(body)))
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	expect(t, rec.Code, http.StatusOK)
+	expect(t, len(dbClient.Cfg.GetErrorTemplates()), 1)
+	expect(t, dbClient.Cfg.GetErrorTemplates()[0].Status, 404)
+
+	// getting them back
+	req, err = http.NewRequest("GET", "/error-templates", nil)
+	expect(t, err, nil)
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	expect(t, rec.Code, http.StatusOK)
+
+	var templates errorTemplates
+	err = json.Unmarshal(rec.Body.Bytes(), &templates)
+	expect(t, err, nil)
+	expect(t, len(templates.Data), 1)
+	expect(t, templates.Data[0].Kind, ErrorKindMiss)
+}
+
+func TestSetErrorTemplatesHandlerInvalid(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	m := getBoneRouter(*dbClient)
+
+	body := `{"data": [{"kind": "nope", "status": 404}]}`
+
+	req, err := http.NewRequest("POST", "/error-templates", ioutil.NopCloser(bytes.NewBufferString(body)))
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	expect(t, rec.Code, http.StatusBadRequest)
+	expect(t, len(dbClient.Cfg.GetErrorTemplates()), 0)
+}
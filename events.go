@@ -0,0 +1,77 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Request event action types, fired after the request was handled. Entry data contains JSON encoded EventData.
+const (
+	// ActionTypeRequestServed - recorded response was found and returned in virtualize mode
+	ActionTypeRequestServed = "requestServed"
+	// ActionTypeRequestMissed - there was no recorded response for request in virtualize mode
+	ActionTypeRequestMissed = "requestMissed"
+	// ActionTypeResponseSynthesized - response was created by middleware in synthesize mode
+	ActionTypeResponseSynthesized = "responseSynthesized"
+	// ActionTypeSynthesizeFailed - response couldn't be created in synthesize mode
+	ActionTypeSynthesizeFailed = "synthesizeFailed"
+	// ActionTypeRequestModified - request and response were modified by middleware in modify mode
+	ActionTypeRequestModified = "requestModified"
+	// ActionTypeModifyFailed - request couldn't be sent or modified in modify mode
+	ActionTypeModifyFailed = "modifyFailed"
+	// ActionTypeMiddlewareFailed - middleware returned an error or invalid payload, in any mode
+	ActionTypeMiddlewareFailed = "middlewareFailed"
+)
+
+// EventData - data of request events, hooks can read it with Entry.EventData
+type EventData struct {
+	Request    RequestDetails   `json:"request"`
+	Response   *ResponseDetails `json:"response,omitempty"`
+	Key        string           `json:"key,omitempty"`
+	Matcher    string           `json:"matcher,omitempty"`
+	Middleware string           `json:"middleware,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// EventData - decodes data of request event entry
+func (e *Entry) EventData() (*EventData, error) {
+	var data EventData
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// eventFunc - fires request event, lets code without access to DBClient (i.e. Constructor) report events
+type eventFunc func(ac ActionType, message string, data EventData)
+
+// fireEvent - fires request event to hooks registered for its action type. Data is only encoded when
+// there are hooks interested in the event.
+func (d *DBClient) fireEvent(ac ActionType, message string, data EventData) {
+	if len(d.Hooks[ac]) == 0 {
+		return
+	}
+
+	bts, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	d.fireHooks(&Entry{
+		ActionType:  ac,
+		Message:     message,
+		Time:        time.Now(),
+		Data:        bts,
+		Destination: data.Request.Destination,
+		Mode:        d.Cfg.GetMode(),
+	})
+}
+
+// newConstructor - returns constructor that reports middleware failures to hooks and can open body files
+func (d *DBClient) newConstructor(req *http.Request, payload Payload) *Constructor {
+	c := NewConstructor(req, payload)
+	c.events = d.fireEvent
+	c.bodies = d.Bodies
+	return c
+}
@@ -0,0 +1,111 @@
+package hoverfly
+
+import (
+	"net/http"
+	"testing"
+)
+
+func eventHook(dbClient *DBClient, actionTypes ...ActionType) *recordingHook {
+	dbClient.Hooks = make(ActionTypeHooks)
+	hook := &recordingHook{actionTypes: actionTypes}
+	dbClient.AddHook(hook)
+	return hook
+}
+
+func TestVirtualizeEvents(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	hook := eventHook(dbClient, ActionTypeRequestServed, ActionTypeRequestMissed)
+
+	req, _ := http.NewRequest("GET", "http://events.com/recorded", nil)
+	dbClient.captureRequest(req)
+
+	dbClient.Cfg.SetMode(VirtualizeMode)
+
+	req, _ = http.NewRequest("GET", "http://events.com/recorded", nil)
+	dbClient.getResponse(req)
+
+	req, _ = http.NewRequest("GET", "http://events.com/missing", nil)
+	dbClient.getResponse(req)
+
+	received := hook.received()
+	expect(t, len(received), 2)
+
+	expect(t, string(received[0].ActionType), ActionTypeRequestServed)
+	expect(t, received[0].Destination, "events.com")
+	expect(t, received[0].Mode, VirtualizeMode)
+
+	served, err := received[0].EventData()
+	expect(t, err, nil)
+	expect(t, served.Request.Path, "/recorded")
+	expect(t, served.Response.Status, 200)
+	refute(t, served.Key, "")
+
+	expect(t, string(received[1].ActionType), ActionTypeRequestMissed)
+	missed, err := received[1].EventData()
+	expect(t, err, nil)
+	expect(t, missed.Request.Path, "/missing")
+	expect(t, missed.Response == nil, true)
+	refute(t, missed.Error, "")
+}
+
+func TestSynthesizeEvents(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	hook := eventHook(dbClient, ActionTypeResponseSynthesized, ActionTypeSynthesizeFailed, ActionTypeMiddlewareFailed)
+
+	dbClient.Cfg.Middleware = "./examples/middleware/synthetic_service/synthetic.py"
+	req, _ := http.NewRequest("GET", "http://events.com/synthetic", nil)
+	_, err := dbClient.synthesizeResponse(req)
+	expect(t, err, nil)
+
+	dbClient.Cfg.Middleware = "./examples/middleware/this_is_not_there.py"
+	req, _ = http.NewRequest("GET", "http://events.com/synthetic", nil)
+	_, err = dbClient.synthesizeResponse(req)
+	refute(t, err, nil)
+
+	received := hook.received()
+	expect(t, len(received), 3)
+
+	expect(t, string(received[0].ActionType), ActionTypeResponseSynthesized)
+	synthesized, err := received[0].EventData()
+	expect(t, err, nil)
+	expect(t, synthesized.Response.Status, 200)
+
+	expect(t, string(received[1].ActionType), ActionTypeMiddlewareFailed)
+	expect(t, string(received[2].ActionType), ActionTypeSynthesizeFailed)
+
+	failed, err := received[2].EventData()
+	expect(t, err, nil)
+	expect(t, failed.Middleware, "./examples/middleware/this_is_not_there.py")
+	expect(t, failed.Request.Path, "/synthetic")
+}
+
+func TestModifyEvents(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	hook := eventHook(dbClient, ActionTypeRequestModified, ActionTypeModifyFailed, ActionTypeMiddlewareFailed)
+
+	req, _ := http.NewRequest("GET", "http://events.com/modify", nil)
+	_, err := dbClient.modifyRequestResponse(req, "./examples/middleware/reflect_body/reflect_body.py")
+	expect(t, err, nil)
+
+	req, _ = http.NewRequest("GET", "http://events.com/modify", nil)
+	_, err = dbClient.modifyRequestResponse(req, "./examples/middleware/this_is_not_there.py")
+	refute(t, err, nil)
+
+	received := hook.received()
+	expect(t, len(received), 3)
+	expect(t, string(received[0].ActionType), ActionTypeRequestModified)
+	expect(t, string(received[1].ActionType), ActionTypeMiddlewareFailed)
+	expect(t, string(received[2].ActionType), ActionTypeModifyFailed)
+
+	modified, err := received[0].EventData()
+	expect(t, err, nil)
+	expect(t, modified.Middleware, "./examples/middleware/reflect_body/reflect_body.py")
+	expect(t, modified.Request.Path, "/modify")
+}
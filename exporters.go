@@ -0,0 +1,239 @@
+package hoverfly
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultMetricsPrefix - prefix added to exported metric names when it's not configured
+const DefaultMetricsPrefix = "hoverfly"
+
+// DefaultMetricsFlushInterval - how often metrics are pushed to exporters when interval is not configured
+const DefaultMetricsFlushInterval = 10 * time.Second
+
+// statsdMaxPacketSize - keeps StatsD packets below common network MTU
+const statsdMaxPacketSize = 1432
+
+// metricsDialTimeout - timeout for connecting to metric backends
+const metricsDialTimeout = 5 * time.Second
+
+// MetricsExporter - pushes metrics snapshot to external backend
+type MetricsExporter interface {
+	Export(stats Stats) error
+	String() string
+}
+
+// metricName - joins prefix and metric name, replacing characters backends treat as separators
+func metricName(prefix string, parts ...string) string {
+	name := strings.Join(parts, ".")
+	name = strings.NewReplacer(" ", "_", ":", "_", "|", "_", "/", "_").Replace(name)
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type timerValue struct {
+	name  string
+	value float64
+}
+
+// timerValues - values reported for each timer, sorted by timer name
+func timerValues(timers map[string]TimerStats) []timerValue {
+	names := make([]string, 0, len(timers))
+	for name := range timers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var values []timerValue
+	for _, name := range names {
+		t := timers[name]
+		values = append(values,
+			timerValue{name + ".count", float64(t.Count)},
+			timerValue{name + ".min", t.Min},
+			timerValue{name + ".max", t.Max},
+			timerValue{name + ".mean", t.Mean},
+			timerValue{name + ".p50", t.P50},
+			timerValue{name + ".p95", t.P95},
+			timerValue{name + ".p99", t.P99},
+		)
+	}
+	return values
+}
+
+// StatsDExporter - sends metrics to StatsD over UDP. Counters are sent as increments since previous
+// export, timers and gauges as gauges.
+type StatsDExporter struct {
+	Address string
+	Prefix  string
+
+	last map[string]int64
+}
+
+// NewStatsDExporter - returns exporter sending metrics to StatsD at given address (i.e. localhost:8125)
+func NewStatsDExporter(address, prefix string) *StatsDExporter {
+	return &StatsDExporter{Address: address, Prefix: prefix, last: make(map[string]int64)}
+}
+
+func (e *StatsDExporter) String() string {
+	return "statsd " + e.Address
+}
+
+// Export - sends metrics snapshot
+func (e *StatsDExporter) Export(stats Stats) error {
+	var lines []string
+
+	for _, name := range sortedKeys(stats.Counters) {
+		value := stats.Counters[name]
+		delta := value - e.last[name]
+		if delta < 0 {
+			// counters were reset since previous export
+			delta = value
+		}
+		e.last[name] = value
+		if delta != 0 {
+			lines = append(lines, fmt.Sprintf("%s:%d|c", metricName(e.Prefix, name), delta))
+		}
+	}
+
+	for _, name := range sortedKeys(stats.Gauges) {
+		lines = append(lines, fmt.Sprintf("%s:%d|g", metricName(e.Prefix, name), stats.Gauges[name]))
+	}
+
+	for _, v := range timerValues(stats.Timers) {
+		lines = append(lines, fmt.Sprintf("%s:%.3f|g", metricName(e.Prefix, v.name), v.value))
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("udp", e.Address, metricsDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// multiple metrics are sent in one packet separated by new lines
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if packet.Len() > 0 && packet.Len()+len(line)+1 > statsdMaxPacketSize {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	_, err = conn.Write(packet.Bytes())
+	return err
+}
+
+// GraphiteExporter - sends metrics to Graphite using plaintext protocol over TCP
+type GraphiteExporter struct {
+	Address string
+	Prefix  string
+}
+
+// NewGraphiteExporter - returns exporter sending metrics to Graphite at given address (i.e. localhost:2003)
+func NewGraphiteExporter(address, prefix string) *GraphiteExporter {
+	return &GraphiteExporter{Address: address, Prefix: prefix}
+}
+
+func (e *GraphiteExporter) String() string {
+	return "graphite " + e.Address
+}
+
+// Export - sends metrics snapshot
+func (e *GraphiteExporter) Export(stats Stats) error {
+	now := time.Now().Unix()
+
+	var buf bytes.Buffer
+	for _, name := range sortedKeys(stats.Counters) {
+		fmt.Fprintf(&buf, "%s %d %d\n", metricName(e.Prefix, name, "count"), stats.Counters[name], now)
+	}
+	for _, name := range sortedKeys(stats.Gauges) {
+		fmt.Fprintf(&buf, "%s %d %d\n", metricName(e.Prefix, name), stats.Gauges[name], now)
+	}
+	for _, v := range timerValues(stats.Timers) {
+		fmt.Fprintf(&buf, "%s %.3f %d\n", metricName(e.Prefix, v.name), v.value, now)
+	}
+
+	conn, err := net.DialTimeout("tcp", e.Address, metricsDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(buf.Bytes())
+	return err
+}
+
+// NewMetricsExporters - returns exporters enabled in configuration
+func NewMetricsExporters(cfg *Configuration) []MetricsExporter {
+	prefix := cfg.MetricsPrefix
+
+	var exporters []MetricsExporter
+	if cfg.StatsDAddress != "" {
+		exporters = append(exporters, NewStatsDExporter(cfg.StatsDAddress, prefix))
+	}
+	if cfg.GraphiteAddress != "" {
+		exporters = append(exporters, NewGraphiteExporter(cfg.GraphiteAddress, prefix))
+	}
+	return exporters
+}
+
+// Export - pushes current metrics to all exporters
+func (c *CounterByMode) Export(exporters []MetricsExporter) {
+	stats := c.Flush()
+	for _, e := range exporters {
+		if err := e.Export(stats); err != nil {
+			log.WithFields(log.Fields{
+				"error":    err.Error(),
+				"exporter": e.String(),
+			}).Warn("failed to export metrics")
+		}
+	}
+}
+
+// StartExporters - periodically pushes metrics to given exporters
+func (c *CounterByMode) StartExporters(exporters []MetricsExporter, interval time.Duration) {
+	if len(exporters) == 0 {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultMetricsFlushInterval
+	}
+
+	for _, e := range exporters {
+		log.WithFields(log.Fields{
+			"exporter": e.String(),
+			"interval": interval.String(),
+		}).Info("metrics export enabled")
+	}
+
+	go func() {
+		for _ = range time.Tick(interval) {
+			c.Export(exporters)
+		}
+	}()
+}
@@ -0,0 +1,122 @@
+package hoverfly
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricName(t *testing.T) {
+	expect(t, metricName("hoverfly", "match.hit"), "hoverfly.match.hit")
+	expect(t, metricName("", "latency", "p95"), "latency.p95")
+	expect(t, metricName("hf", "a b:c|d/e"), "hf.a_b_c_d_e")
+}
+
+func TestStatsDExporter(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	expect(t, err, nil)
+	defer listener.Close()
+
+	counter := NewModeCounter()
+	counter.Count(VirtualizeMode)
+	counter.Count(VirtualizeMode)
+	counter.Observe(5*time.Millisecond, MatchResultHit)
+
+	exporter := NewStatsDExporter(listener.LocalAddr().String(), "hf")
+	err = exporter.Export(counter.Flush())
+	expect(t, err, nil)
+
+	buf := make([]byte, statsdMaxPacketSize)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := listener.ReadFrom(buf)
+	expect(t, err, nil)
+
+	lines := strings.Split(string(buf[:n]), "\n")
+	expect(t, contains(lines, "hf.virtualize:2|c"), true)
+	expect(t, contains(lines, "hf.match.hit:1|c"), true)
+	expect(t, contains(lines, "hf.latency.max:5.000|g"), true)
+	// counters without changes are not sent
+	expect(t, contains(lines, "hf.capture:0|c"), false)
+
+	// second export only sends counter increments
+	counter.Count(VirtualizeMode)
+	err = exporter.Export(counter.Flush())
+	expect(t, err, nil)
+
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err = listener.ReadFrom(buf)
+	expect(t, err, nil)
+
+	lines = strings.Split(string(buf[:n]), "\n")
+	expect(t, contains(lines, "hf.virtualize:1|c"), true)
+	expect(t, contains(lines, "hf.match.hit:1|c"), false)
+}
+
+func TestGraphiteExporter(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect(t, err, nil)
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var lines []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		received <- lines
+	}()
+
+	counter := NewModeCounter()
+	counter.Count(CaptureMode)
+	counter.Observe(2*time.Millisecond, "")
+
+	exporter := NewGraphiteExporter(listener.Addr().String(), "hf")
+	err = exporter.Export(counter.Flush())
+	expect(t, err, nil)
+
+	var lines []string
+	select {
+	case lines = <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("graphite listener didn't receive metrics")
+	}
+
+	var names []string
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		expect(t, len(fields), 3)
+		names = append(names, fields[0]+" "+fields[1])
+	}
+
+	expect(t, contains(names, "hf.capture.count 1"), true)
+	expect(t, contains(names, "hf.virtualize.count 0"), true)
+	expect(t, contains(names, "hf.latency.count 1.000"), true)
+	expect(t, contains(names, "hf.latency.min 2.000"), true)
+}
+
+func TestNewMetricsExporters(t *testing.T) {
+	expect(t, len(NewMetricsExporters(&Configuration{})), 0)
+
+	exporters := NewMetricsExporters(&Configuration{StatsDAddress: "localhost:8125", GraphiteAddress: "localhost:2003"})
+	expect(t, len(exporters), 2)
+	expect(t, exporters[0].String(), "statsd localhost:8125")
+	expect(t, exporters[1].String(), "graphite localhost:2003")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,322 @@
+package hoverfly
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultFakeLocale - locale used by fake data generator when none is configured
+const DefaultFakeLocale = "en_US"
+
+// fakeLocale - locale specific fake data
+type fakeLocale struct {
+	firstNames []string
+	lastNames  []string
+	streets    []string
+	cities     []string
+	country    string
+	domains    []string
+	// formats, '#' is replaced with random digit
+	phone    string
+	postcode string
+	// address - format with street, house number, city and postcode verbs, in this order
+	address    string
+	dateLayout string
+}
+
+var fakeLocales = map[string]fakeLocale{
+	"en_US": {
+		firstNames: []string{"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda", "David", "Elizabeth"},
+		lastNames:  []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Wilson", "Moore"},
+		streets:    []string{"Main Street", "Oak Avenue", "Maple Drive", "Cedar Lane", "Park Road", "Washington Street"},
+		cities:     []string{"New York", "Chicago", "Houston", "Phoenix", "Seattle", "Denver", "Boston"},
+		country:    "United States",
+		domains:    []string{"example.com", "mail.com", "test.org"},
+		phone:      "(###) ###-####",
+		postcode:   "#####",
+		address:    "%[2]s %[1]s, %[3]s %[4]s",
+		dateLayout: "01/02/2006",
+	},
+	"en_GB": {
+		firstNames: []string{"Oliver", "Amelia", "George", "Olivia", "Harry", "Isla", "Jack", "Emily", "Charlie", "Poppy"},
+		lastNames:  []string{"Smith", "Jones", "Taylor", "Brown", "Williams", "Wilson", "Evans", "Thomas", "Roberts", "Walker"},
+		streets:    []string{"High Street", "Station Road", "Church Lane", "Victoria Road", "Green Lane", "Mill Road"},
+		cities:     []string{"London", "Manchester", "Bristol", "Leeds", "Glasgow", "Cardiff", "Oxford"},
+		country:    "United Kingdom",
+		domains:    []string{"example.co.uk", "mail.co.uk", "test.org.uk"},
+		phone:      "07### ######",
+		postcode:   "SW# #AB",
+		address:    "%[2]s %[1]s, %[3]s %[4]s",
+		dateLayout: "02/01/2006",
+	},
+	"de_DE": {
+		firstNames: []string{"Lukas", "Anna", "Maximilian", "Lea", "Jonas", "Sophie", "Felix", "Marie", "Paul", "Jürgen"},
+		lastNames:  []string{"Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz", "Hoffmann"},
+		streets:    []string{"Hauptstraße", "Schulstraße", "Gartenstraße", "Bahnhofstraße", "Dorfstraße", "Bergstraße"},
+		cities:     []string{"Berlin", "Hamburg", "München", "Köln", "Frankfurt am Main", "Stuttgart", "Leipzig"},
+		country:    "Deutschland",
+		domains:    []string{"example.de", "mail.de", "test.de"},
+		phone:      "+49 ### #######",
+		postcode:   "#####",
+		address:    "%[1]s %[2]s, %[4]s %[3]s",
+		dateLayout: "02.01.2006",
+	},
+	"fr_FR": {
+		firstNames: []string{"Gabriel", "Emma", "Léo", "Jade", "Raphaël", "Louise", "Arthur", "Alice", "Louis", "Chloé"},
+		lastNames:  []string{"Martin", "Bernard", "Dubois", "Thomas", "Robert", "Richard", "Petit", "Durand", "Leroy", "Moreau"},
+		streets:    []string{"rue de la Paix", "avenue Victor Hugo", "rue Pasteur", "boulevard Voltaire", "rue de l'Église"},
+		cities:     []string{"Paris", "Marseille", "Lyon", "Toulouse", "Nice", "Nantes", "Bordeaux"},
+		country:    "France",
+		domains:    []string{"example.fr", "mail.fr", "test.fr"},
+		phone:      "+33 # ## ## ## ##",
+		postcode:   "#####",
+		address:    "%[2]s %[1]s, %[4]s %[3]s",
+		dateLayout: "02/01/2006",
+	},
+}
+
+var loremWords = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor
+	incididunt ut labore et dolore magna aliqua enim ad minim veniam quis nostrud exercitation ullamco laboris nisi
+	aliquip ex ea commodo consequat duis aute irure in reprehenderit voluptate velit esse cillum fugiat nulla pariatur`)
+
+// emailReplacer - turns names into ASCII e-mail local parts
+var emailReplacer = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "é", "e", "è", "e", "ë", "e", "ê", "e",
+	"à", "a", "â", "a", "ç", "c", "ï", "i", "î", "i", "ô", "o", " ", "", "'", "",
+)
+
+// FakeLocales - returns supported fake data locales
+func FakeLocales() []string {
+	var locales []string
+	for l := range fakeLocales {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Faker - generates realistic looking fake data. Generated values depend only on seed and the order of calls,
+// so the same seed gives the same data.
+type Faker struct {
+	Seed   int64
+	Locale string
+
+	mu     sync.Mutex
+	rand   *rand.Rand
+	locale fakeLocale
+}
+
+// NewFaker - returns fake data generator for given locale, seed 0 is replaced with current time
+func NewFaker(seed int64, locale string) (*Faker, error) {
+	if locale == "" {
+		locale = DefaultFakeLocale
+	}
+	l, ok := fakeLocales[locale]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake data locale '%s', available locales: %s", locale, strings.Join(FakeLocales(), ", "))
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Faker{Seed: seed, Locale: locale, rand: rand.New(rand.NewSource(seed)), locale: l}, nil
+}
+
+func (f *Faker) intn(n int) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Intn(n)
+}
+
+func (f *Faker) float() float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rand.Float64()
+}
+
+func (f *Faker) pick(values []string) string {
+	return values[f.intn(len(values))]
+}
+
+// numerify - replaces '#' in format with random digits
+func (f *Faker) numerify(format string) string {
+	var b strings.Builder
+	for _, r := range format {
+		if r == '#' {
+			b.WriteByte(byte('0' + f.intn(10)))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// FirstName - returns first name
+func (f *Faker) FirstName() string {
+	return f.pick(f.locale.firstNames)
+}
+
+// LastName - returns last name
+func (f *Faker) LastName() string {
+	return f.pick(f.locale.lastNames)
+}
+
+// Name - returns full name
+func (f *Faker) Name() string {
+	return f.FirstName() + " " + f.LastName()
+}
+
+// Email - returns e-mail address
+func (f *Faker) Email() string {
+	local := strings.ToLower(f.FirstName() + "." + f.LastName())
+	return emailReplacer.Replace(local) + "@" + f.pick(f.locale.domains)
+}
+
+// Phone - returns phone number in locale format
+func (f *Faker) Phone() string {
+	return f.numerify(f.locale.phone)
+}
+
+// Street - returns street name
+func (f *Faker) Street() string {
+	return f.pick(f.locale.streets)
+}
+
+// City - returns city name
+func (f *Faker) City() string {
+	return f.pick(f.locale.cities)
+}
+
+// Postcode - returns postal code in locale format
+func (f *Faker) Postcode() string {
+	return f.numerify(f.locale.postcode)
+}
+
+// Country - returns locale country
+func (f *Faker) Country() string {
+	return f.locale.country
+}
+
+// Address - returns full address in locale format
+func (f *Faker) Address() string {
+	return fmt.Sprintf(f.locale.address, f.Street(), fmt.Sprint(1+f.intn(200)), f.City(), f.Postcode())
+}
+
+// UUID - returns random (version 4) UUID
+func (f *Faker) UUID() string {
+	b := make([]byte, 16)
+	for i := range b {
+		b[i] = byte(f.intn(256))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// DateBetween - returns time between from and to
+func (f *Faker) DateBetween(from, to time.Time) time.Time {
+	if !to.After(from) {
+		return from
+	}
+	return from.Add(time.Duration(f.float() * float64(to.Sub(from)))).Truncate(time.Second)
+}
+
+// Date - returns time within last year
+func (f *Faker) Date() time.Time {
+	now := time.Now().UTC()
+	return f.DateBetween(now.AddDate(-1, 0, 0), now)
+}
+
+// LocalDate - returns date within last year formatted with locale date layout
+func (f *Faker) LocalDate() string {
+	return f.Date().Format(f.locale.dateLayout)
+}
+
+// Word - returns lorem ipsum word
+func (f *Faker) Word() string {
+	return f.pick(loremWords)
+}
+
+// Lorem - returns given number of lorem ipsum words
+func (f *Faker) Lorem(words int) string {
+	w := make([]string, words)
+	for i := range w {
+		w[i] = f.Word()
+	}
+	return strings.Join(w, " ")
+}
+
+// Sentence - returns lorem ipsum sentence
+func (f *Faker) Sentence() string {
+	s := f.Lorem(4 + f.intn(8))
+	return strings.ToUpper(s[:1]) + s[1:] + "."
+}
+
+// Paragraph - returns a few lorem ipsum sentences
+func (f *Faker) Paragraph() string {
+	s := make([]string, 3+f.intn(3))
+	for i := range s {
+		s[i] = f.Sentence()
+	}
+	return strings.Join(s, " ")
+}
+
+// IntBetween - returns integer in [min, max] range
+func (f *Faker) IntBetween(min, max int) int {
+	if max <= min {
+		return min
+	}
+	return min + f.intn(max-min+1)
+}
+
+// FloatBetween - returns number in [min, max) range
+func (f *Faker) FloatBetween(min, max float64) float64 {
+	if max <= min {
+		return min
+	}
+	return min + f.float()*(max-min)
+}
+
+// Bool - returns random boolean
+func (f *Faker) Bool() bool {
+	return f.intn(2) == 1
+}
+
+// FuncMap - template functions generating fake data, e.g. {{fakeName}}, {{fakeInt 1 10}} or {{fakeLorem 5}}
+func (f *Faker) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"fakeFirstName": f.FirstName,
+		"fakeLastName":  f.LastName,
+		"fakeName":      f.Name,
+		"fakeEmail":     f.Email,
+		"fakePhone":     f.Phone,
+		"fakeStreet":    f.Street,
+		"fakeCity":      f.City,
+		"fakePostcode":  f.Postcode,
+		"fakeCountry":   f.Country,
+		"fakeAddress":   f.Address,
+		"fakeUUID":      f.UUID,
+		"fakeDate":      func() string { return f.Date().Format("2006-01-02") },
+		"fakeDateTime":  func() string { return f.Date().Format(time.RFC3339) },
+		"fakeLocalDate": f.LocalDate,
+		"fakeWord":      f.Word,
+		"fakeLorem":     f.Lorem,
+		"fakeSentence":  f.Sentence,
+		"fakeParagraph": f.Paragraph,
+		"fakeInt":       f.IntBetween,
+		"fakeFloat":     f.FloatBetween,
+		"fakeBool":      f.Bool,
+	}
+}
+
+// templateFuncs - functions available to Hoverfly templates, random generator is used when faker isn't set
+func templateFuncs(f *Faker) template.FuncMap {
+	if f == nil {
+		f, _ = NewFaker(0, DefaultFakeLocale)
+	}
+	return f.FuncMap()
+}
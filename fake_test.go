@@ -0,0 +1,67 @@
+package hoverfly
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestFakerIsReproducible(t *testing.T) {
+	first, err := NewFaker(42, "en_GB")
+	expect(t, err, nil)
+	second, err := NewFaker(42, "en_GB")
+	expect(t, err, nil)
+
+	for i := 0; i < 10; i++ {
+		expect(t, first.Name(), second.Name())
+		expect(t, first.Address(), second.Address())
+		expect(t, first.UUID(), second.UUID())
+		expect(t, first.IntBetween(1, 100), second.IntBetween(1, 100))
+	}
+}
+
+func TestFakerValues(t *testing.T) {
+	f, err := NewFaker(1, "de_DE")
+	expect(t, err, nil)
+
+	expect(t, regexp.MustCompile(`^[a-z.]+@[a-z.]+$`).MatchString(f.Email()), true)
+	expect(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(f.UUID()), true)
+	expect(t, regexp.MustCompile(`^\+49 \d{3} \d{7}$`).MatchString(f.Phone()), true)
+	expect(t, regexp.MustCompile(`^\d{2}\.\d{2}\.\d{4}$`).MatchString(f.LocalDate()), true)
+	expect(t, f.Country(), "Deutschland")
+	expect(t, len(strings.Fields(f.Lorem(5))), 5)
+
+	for i := 0; i < 100; i++ {
+		n := f.IntBetween(3, 5)
+		expect(t, n >= 3 && n <= 5, true)
+	}
+
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	d := f.DateBetween(from, to)
+	expect(t, !d.Before(from) && d.Before(to), true)
+}
+
+func TestNewFakerUnknownLocale(t *testing.T) {
+	_, err := NewFaker(1, "xx_XX")
+	refute(t, err, nil)
+}
+
+func TestFakerTemplateFuncs(t *testing.T) {
+	f, err := NewFaker(3, "")
+	expect(t, err, nil)
+
+	tmpl, err := template.New("test").Funcs(f.FuncMap()).Parse(`{{fakeInt 7 7}} {{fakeCountry}} {{fakeLorem 2}}`)
+	expect(t, err, nil)
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, nil)
+	expect(t, err, nil)
+
+	parts := strings.Fields(buf.String())
+	expect(t, parts[0], "7")
+	expect(t, strings.HasPrefix(buf.String(), "7 United States "), true)
+}
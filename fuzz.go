@@ -0,0 +1,265 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Fuzz mutations
+const (
+	// FuzzDropField - removes a field from JSON object
+	FuzzDropField = "dropField"
+	// FuzzRenameField - renames a field of JSON object
+	FuzzRenameField = "renameField"
+	// FuzzChangeType - replaces JSON value with a value of different type
+	FuzzChangeType = "changeType"
+	// FuzzHugeString - replaces JSON string (or whole body when it isn't JSON) with a huge string
+	FuzzHugeString = "hugeString"
+	// FuzzInvalidUTF8 - inserts invalid UTF-8 bytes into body
+	FuzzInvalidUTF8 = "invalidUTF8"
+	// FuzzWrongContentType - replaces Content-Type header with an unexpected one
+	FuzzWrongContentType = "wrongContentType"
+	// FuzzTruncateJSON - cuts JSON body short
+	FuzzTruncateJSON = "truncateJSON"
+)
+
+// FuzzMutations - all supported mutations, used when none are configured
+var FuzzMutations = []string{
+	FuzzDropField,
+	FuzzRenameField,
+	FuzzChangeType,
+	FuzzHugeString,
+	FuzzInvalidUTF8,
+	FuzzWrongContentType,
+	FuzzTruncateJSON,
+}
+
+// fuzzHugeStringSize - length of strings produced by FuzzHugeString mutation
+const fuzzHugeStringSize = 1 << 20
+
+var fuzzContentTypes = []string{
+	"text/html; charset=utf-8",
+	"application/xml",
+	"text/plain",
+	"application/octet-stream",
+	"image/png",
+}
+
+// Fuzzer - mutates virtualized responses. Mutations are chosen with random generator derived from seed,
+// request key and number of times the key was fuzzed, so the same sequence of requests gets the same
+// mutations when the seed is reused.
+type Fuzzer struct {
+	Seed      int64
+	Mutations []string
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// NewFuzzer - returns fuzzer applying given mutations (all mutations when empty), seed 0 is replaced with
+// current time
+func NewFuzzer(seed int64, mutations []string) (*Fuzzer, error) {
+	if len(mutations) == 0 {
+		mutations = FuzzMutations
+	}
+	for _, m := range mutations {
+		if !ValidFuzzMutation(m) {
+			return nil, fmt.Errorf("unknown fuzz mutation '%s', available mutations: %s", m, strings.Join(FuzzMutations, ", "))
+		}
+	}
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Fuzzer{Seed: seed, Mutations: mutations, counts: make(map[string]int64)}, nil
+}
+
+// ValidFuzzMutation - checks whether mutation is supported
+func ValidFuzzMutation(mutation string) bool {
+	for _, m := range FuzzMutations {
+		if m == mutation {
+			return true
+		}
+	}
+	return false
+}
+
+// rand - returns random generator for next response with given key
+func (f *Fuzzer) rand(key string) *rand.Rand {
+	f.mu.Lock()
+	n := f.counts[key]
+	f.counts[key]++
+	f.mu.Unlock()
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%s:%d", f.Seed, key, n)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// Mutate - applies one of the configured mutations that can be applied to response, returns name of the
+// applied mutation or empty string when none could be applied
+func (f *Fuzzer) Mutate(key string, response *ResponseDetails) string {
+	r := f.rand(key)
+
+	var doc interface{}
+	isJSON := false
+	if response.Body != "" {
+		d := json.NewDecoder(strings.NewReader(response.Body))
+		d.UseNumber()
+		isJSON = d.Decode(&doc) == nil
+	}
+	fields := jsonFields(doc)
+
+	var applicable []string
+	for _, m := range f.Mutations {
+		switch m {
+		case FuzzDropField, FuzzRenameField, FuzzChangeType:
+			if len(fields) > 0 {
+				applicable = append(applicable, m)
+			}
+		case FuzzTruncateJSON:
+			if isJSON && len(response.Body) > 1 {
+				applicable = append(applicable, m)
+			}
+		default:
+			applicable = append(applicable, m)
+		}
+	}
+	if len(applicable) == 0 {
+		return ""
+	}
+
+	mutation := applicable[r.Intn(len(applicable))]
+	headers := http.Header(response.Headers)
+	if headers == nil {
+		headers = make(http.Header)
+	}
+
+	switch mutation {
+	case FuzzDropField:
+		field := fields[r.Intn(len(fields))]
+		delete(field.object, field.name)
+		response.Body = encodeFuzzed(doc)
+	case FuzzRenameField:
+		field := fields[r.Intn(len(fields))]
+		value := field.object[field.name]
+		delete(field.object, field.name)
+		field.object[fmt.Sprintf("%s_%d", field.name, r.Intn(1000))] = value
+		response.Body = encodeFuzzed(doc)
+	case FuzzChangeType:
+		field := fields[r.Intn(len(fields))]
+		field.object[field.name] = changeType(field.object[field.name])
+		response.Body = encodeFuzzed(doc)
+	case FuzzHugeString:
+		huge := strings.Repeat("A", fuzzHugeStringSize)
+		if len(fields) > 0 {
+			field := fields[r.Intn(len(fields))]
+			field.object[field.name] = huge
+			response.Body = encodeFuzzed(doc)
+		} else {
+			response.Body = huge
+		}
+	case FuzzInvalidUTF8:
+		i := 0
+		if len(response.Body) > 0 {
+			i = r.Intn(len(response.Body))
+		}
+		response.Body = response.Body[:i] + "\xff\xfe\xfd" + response.Body[i:]
+	case FuzzWrongContentType:
+		current := headers.Get("Content-Type")
+		var types []string
+		for _, ct := range fuzzContentTypes {
+			if ct != current {
+				types = append(types, ct)
+			}
+		}
+		headers.Set("Content-Type", types[r.Intn(len(types))])
+	case FuzzTruncateJSON:
+		response.Body = response.Body[:1+r.Intn(len(response.Body)-1)]
+	}
+
+	// recorded length no longer matches the body
+	headers.Del("Content-Length")
+	response.Headers = headers
+
+	return mutation
+}
+
+// ApplyFuzzing - mutates payload response with given fuzzer and logs applied mutation
+func (c *Constructor) ApplyFuzzing(f *Fuzzer, key string) string {
+	mutation := f.Mutate(key, &c.payload.Response)
+
+	log.WithFields(log.Fields{
+		"mutation":    mutation,
+		"seed":        f.Seed,
+		"key":         key,
+		"path":        c.request.URL.Path,
+		"method":      c.request.Method,
+		"destination": c.request.Host,
+	}).Info("response fuzzed")
+
+	return mutation
+}
+
+type jsonField struct {
+	object map[string]interface{}
+	name   string
+}
+
+// jsonFields - returns all fields of JSON objects in document, in stable order
+func jsonFields(doc interface{}) []jsonField {
+	var fields []jsonField
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fields = append(fields, jsonField{object: v, name: name})
+			fields = append(fields, jsonFields(v[name])...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			fields = append(fields, jsonFields(item)...)
+		}
+	}
+	return fields
+}
+
+// changeType - returns value of a different JSON type
+func changeType(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return 0
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	case map[string]interface{}:
+		return []interface{}{}
+	case []interface{}:
+		return map[string]interface{}{}
+	default:
+		// null
+		return ""
+	}
+}
+
+func encodeFuzzed(doc interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(doc)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,131 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func fuzzResponse() ResponseDetails {
+	return ResponseDetails{
+		Status: 200,
+		Body:   `{"id":1,"name":"bob","tags":["a"],"address":{"city":"London"}}`,
+		Headers: map[string][]string{
+			"Content-Type":   {"application/json"},
+			"Content-Length": {"62"},
+		},
+	}
+}
+
+func TestFuzzerIsReproducible(t *testing.T) {
+	first, err := NewFuzzer(42, nil)
+	expect(t, err, nil)
+	second, err := NewFuzzer(42, nil)
+	expect(t, err, nil)
+
+	for i := 0; i < 20; i++ {
+		r1 := fuzzResponse()
+		r2 := fuzzResponse()
+		expect(t, first.Mutate("key", &r1), second.Mutate("key", &r2))
+		expect(t, r1.Body, r2.Body)
+		expect(t, r1.Headers["Content-Type"][0], r2.Headers["Content-Type"][0])
+	}
+}
+
+func TestFuzzMutations(t *testing.T) {
+	original := fuzzResponse()
+
+	for _, mutation := range FuzzMutations {
+		fuzzer, err := NewFuzzer(1, []string{mutation})
+		expect(t, err, nil)
+
+		response := fuzzResponse()
+		expect(t, fuzzer.Mutate("key", &response), mutation)
+		expect(t, len(response.Headers["Content-Length"]), 0)
+
+		var doc map[string]interface{}
+		validJSON := json.Unmarshal([]byte(response.Body), &doc) == nil
+
+		switch mutation {
+		case FuzzDropField, FuzzRenameField, FuzzChangeType:
+			expect(t, validJSON, true)
+			refute(t, response.Body, original.Body)
+		case FuzzHugeString:
+			expect(t, validJSON, true)
+			expect(t, len(response.Body) > fuzzHugeStringSize, true)
+		case FuzzInvalidUTF8:
+			expect(t, utf8.ValidString(response.Body), false)
+		case FuzzWrongContentType:
+			expect(t, response.Body, original.Body)
+			refute(t, http.Header(response.Headers).Get("Content-Type"), "application/json")
+		case FuzzTruncateJSON:
+			expect(t, validJSON, false)
+			expect(t, strings.HasPrefix(original.Body, response.Body), true)
+		}
+	}
+}
+
+func TestFuzzSkipsJSONMutationsForOtherBodies(t *testing.T) {
+	fuzzer, err := NewFuzzer(1, []string{FuzzDropField, FuzzTruncateJSON})
+	expect(t, err, nil)
+
+	response := ResponseDetails{Status: 200, Body: "plain text"}
+	expect(t, fuzzer.Mutate("key", &response), "")
+	expect(t, response.Body, "plain text")
+}
+
+func TestNewFuzzerUnknownMutation(t *testing.T) {
+	_, err := NewFuzzer(1, []string{"explode"})
+	refute(t, err, nil)
+}
+
+func TestFuzzMode(t *testing.T) {
+	server, dbClient := testTools(200, `{"message": "here"}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	req, _ := http.NewRequest("GET", "http://fuzz.com/item", nil)
+	dbClient.captureRequest(req)
+
+	fuzzer, err := NewFuzzer(7, []string{FuzzWrongContentType})
+	expect(t, err, nil)
+	dbClient.Fuzzer = fuzzer
+	dbClient.Cfg.SetMode(FuzzMode)
+
+	req, _ = http.NewRequest("GET", "http://fuzz.com/item", nil)
+	_, response := dbClient.processRequest(req)
+	expect(t, response.StatusCode, 200)
+	refute(t, response.Header.Get("Content-Type"), "application/json")
+}
+
+func TestFuzzModeBlobBody(t *testing.T) {
+	server, dbClient := testTools(200, `{"message": "here"}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Bodies = testBodyStore("")
+	defer dbClient.Bodies.DeleteBlobs()
+	original := `{"message": "stored in blob"}`
+	ref, err := dbClient.Bodies.Put([]byte(original))
+	expect(t, err, nil)
+	expect(t, dbClient.ImportPayloads([]Payload{{
+		Request:  RequestDetails{Destination: "fuzz.com", Path: "/item", Method: "GET"},
+		Response: ResponseDetails{Status: 200, BodyFile: ref, Headers: map[string][]string{"Content-Type": {"application/json"}}},
+	}}), nil)
+
+	fuzzer, err := NewFuzzer(7, []string{FuzzTruncateJSON})
+	expect(t, err, nil)
+	dbClient.Fuzzer = fuzzer
+	dbClient.Cfg.SetMode(FuzzMode)
+
+	req, _ := http.NewRequest("GET", "http://fuzz.com/item", nil)
+	_, response := dbClient.processRequest(req)
+	body, err := ioutil.ReadAll(response.Body)
+	expect(t, err, nil)
+	expect(t, len(body) > 0, true)
+	expect(t, len(body) < len(original), true)
+	expect(t, response.ContentLength, int64(len(body)))
+}
@@ -0,0 +1,349 @@
+package hoverfly
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Hook delivery defaults
+const (
+	DefaultHookQueueSize  = 1000
+	DefaultHookWorkers    = 2
+	DefaultHookRetries    = 3
+	DefaultHookRetryDelay = time.Second
+)
+
+// Hook queue metric names
+const (
+	MetricHooksQueued       = "hooks.queued"
+	MetricHooksDelivered    = "hooks.delivered"
+	MetricHooksFailed       = "hooks.failed"
+	MetricHooksDeadLettered = "hooks.deadLettered"
+	MetricHooksDropped      = "hooks.dropped"
+	MetricHooksQueueLength  = "hooks.queueLength"
+)
+
+// HookOptions - controls which entries are delivered to a hook and how
+type HookOptions struct {
+	// Destination - regular expression matched against entry destination, empty matches everything
+	Destination string
+	// ActionTypes - limits hook to some of the action types it supports, empty keeps all
+	ActionTypes []ActionType
+	// Modes - limits hook to entries fired in given modes, empty matches all modes
+	Modes []string
+	// Sync - hook is called directly in the request path instead of through the queue
+	Sync bool
+}
+
+// filteredHook - hook with delivery options
+type filteredHook struct {
+	Hook
+	destination *regexp.Regexp
+	actionTypes []ActionType
+	modes       []string
+	sync        bool
+}
+
+// NewFilteredHook - wraps hook so it only receives entries matching given options
+func NewFilteredHook(hook Hook, opts HookOptions) (Hook, error) {
+	fh := &filteredHook{
+		Hook:        hook,
+		actionTypes: opts.ActionTypes,
+		modes:       opts.Modes,
+		sync:        opts.Sync,
+	}
+
+	if opts.Destination != "" {
+		re, err := regexp.Compile(opts.Destination)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hook destination filter: %s", err.Error())
+		}
+		fh.destination = re
+	}
+	return fh, nil
+}
+
+// ActionTypes - returns action types of the wrapped hook, limited by options
+func (h *filteredHook) ActionTypes() []ActionType {
+	if len(h.actionTypes) == 0 {
+		return h.Hook.ActionTypes()
+	}
+
+	var types []ActionType
+	for _, ac := range h.Hook.ActionTypes() {
+		for _, allowed := range h.actionTypes {
+			if ac == allowed {
+				types = append(types, ac)
+			}
+		}
+	}
+	return types
+}
+
+// Matches - checks whether entry passes hook filters
+func (h *filteredHook) Matches(entry *Entry) bool {
+	if h.destination != nil && !h.destination.MatchString(entry.Destination) {
+		return false
+	}
+	if len(h.modes) == 0 {
+		return true
+	}
+	for _, m := range h.modes {
+		if m == entry.Mode {
+			return true
+		}
+	}
+	return false
+}
+
+func hookMatches(hook Hook, entry *Entry) bool {
+	if fh, ok := hook.(*filteredHook); ok {
+		return fh.Matches(entry)
+	}
+	return true
+}
+
+func hookIsSync(hook Hook) bool {
+	fh, ok := hook.(*filteredHook)
+	return ok && fh.sync
+}
+
+// AddHookWithOptions - adds a hook to DBClient that only receives entries matching the options
+func (d *DBClient) AddHookWithOptions(hook Hook, opts HookOptions) error {
+	fh, err := NewFilteredHook(hook, opts)
+	if err != nil {
+		return err
+	}
+	d.Hooks.Add(fh)
+	return nil
+}
+
+type hookDelivery struct {
+	hook  Hook
+	entry Entry
+}
+
+// HookQueue - delivers entries to hooks in the background with retries. Entries that can't be delivered
+// (or don't fit into the queue) are logged as dead letters.
+type HookQueue struct {
+	Retries    int
+	RetryDelay time.Duration
+
+	queue chan hookDelivery
+	wg    sync.WaitGroup
+
+	queued, delivered, failed, deadLettered, dropped metrics.Counter
+}
+
+// NewHookQueue - returns hook queue with given capacity, call Start to begin delivery. Capacity and retry delay
+// that aren't positive and negative retries are replaced with defaults.
+func NewHookQueue(size, retries int, retryDelay time.Duration) *HookQueue {
+	if size <= 0 {
+		size = DefaultHookQueueSize
+	}
+	if retries < 0 {
+		retries = DefaultHookRetries
+	}
+	if retryDelay <= 0 {
+		retryDelay = DefaultHookRetryDelay
+	}
+	return &HookQueue{
+		Retries:      retries,
+		RetryDelay:   retryDelay,
+		queue:        make(chan hookDelivery, size),
+		queued:       metrics.NewCounter(),
+		delivered:    metrics.NewCounter(),
+		failed:       metrics.NewCounter(),
+		deadLettered: metrics.NewCounter(),
+		dropped:      metrics.NewCounter(),
+	}
+}
+
+// RegisterMetrics - adds queue metrics to given counter, so they are reported with other stats
+func (q *HookQueue) RegisterMetrics(c *CounterByMode) {
+	c.registry.GetOrRegister(MetricHooksQueued, q.queued)
+	c.registry.GetOrRegister(MetricHooksDelivered, q.delivered)
+	c.registry.GetOrRegister(MetricHooksFailed, q.failed)
+	c.registry.GetOrRegister(MetricHooksDeadLettered, q.deadLettered)
+	c.registry.GetOrRegister(MetricHooksDropped, q.dropped)
+	c.registry.GetOrRegister(MetricHooksQueueLength, metrics.NewFunctionalGauge(func() int64 {
+		return int64(len(q.queue))
+	}))
+}
+
+// Start - starts given number of delivery workers
+func (q *HookQueue) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for delivery := range q.queue {
+				q.deliver(delivery)
+			}
+		}()
+	}
+}
+
+// Close - stops accepting entries and waits until queued entries are delivered
+func (q *HookQueue) Close() {
+	close(q.queue)
+	q.wg.Wait()
+}
+
+// Enqueue - queues entry for delivery, entry is dropped when the queue is full
+func (q *HookQueue) Enqueue(hook Hook, entry Entry) {
+	select {
+	case q.queue <- hookDelivery{hook: hook, entry: entry}:
+		q.queued.Inc(1)
+	default:
+		q.dropped.Inc(1)
+		deadLetter(entry, 0, fmt.Errorf("hook queue is full"))
+	}
+}
+
+func (q *HookQueue) deliver(delivery hookDelivery) {
+	var err error
+	for attempt := 1; attempt <= q.Retries+1; attempt++ {
+		if attempt > 1 {
+			time.Sleep(q.RetryDelay * time.Duration(attempt-1))
+		}
+
+		entry := delivery.entry
+		if err = delivery.hook.Fire(&entry); err == nil {
+			q.delivered.Inc(1)
+			return
+		}
+		q.failed.Inc(1)
+
+		log.WithFields(log.Fields{
+			"error":      err.Error(),
+			"actionType": entry.ActionType,
+			"attempt":    attempt,
+		}).Warn("hook delivery failed")
+	}
+
+	q.deadLettered.Inc(1)
+	deadLetter(delivery.entry, q.Retries+1, err)
+}
+
+// deadLetter - logs entry that couldn't be delivered. Entry data carries payload headers and bodies (including
+// credentials), so it is only logged with debug level, where it can be recovered from.
+func deadLetter(entry Entry, attempts int, err error) {
+	fields := log.Fields{
+		"error":       err.Error(),
+		"actionType":  entry.ActionType,
+		"message":     entry.Message,
+		"destination": entry.Destination,
+		"mode":        entry.Mode,
+		"time":        entry.Time,
+		"attempts":    attempts,
+		"dataSize":    len(entry.Data),
+	}
+	log.WithFields(fields).Error("hook entry dead lettered")
+
+	if log.GetLevel() == log.DebugLevel {
+		fields["data"] = string(entry.Data)
+		log.WithFields(fields).Debug("dead lettered hook entry data")
+	}
+}
+
+// fireHooks - delivers entry to all hooks registered for its action type that match hook filters.
+// Hooks are called through the queue unless they are synchronous or there's no queue.
+func (d *DBClient) fireHooks(entry *Entry) {
+	for _, hook := range d.Hooks[entry.ActionType] {
+		if !hookMatches(hook, entry) {
+			continue
+		}
+
+		if d.HookQueue != nil && !hookIsSync(hook) {
+			d.HookQueue.Enqueue(hook, *entry)
+			continue
+		}
+
+		if err := hook.Fire(entry); err != nil {
+			log.WithFields(log.Fields{
+				"error":      err.Error(),
+				"message":    entry.Message,
+				"actionType": entry.ActionType,
+			}).Error("failed to fire hook")
+		}
+	}
+}
+
+// VetoError - returned when "before" hook rejects an action
+type VetoError struct {
+	ActionType ActionType
+	Reason     string
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("%s rejected by hook: %s", e.ActionType, e.Reason)
+}
+
+// Veto - helper for "before" hooks to reject an action with given reason
+func Veto(reason string) error {
+	return &VetoError{Reason: reason}
+}
+
+// fireBeforeHooks - calls hooks registered for "before" action type synchronously, in the order they were
+// added. Hooks can modify entry data, which is then passed to the next hook and used by the action. The
+// first hook that returns an error rejects the action, VetoError is returned in that case.
+func (d *DBClient) fireBeforeHooks(entry *Entry) error {
+	for _, hook := range d.Hooks[entry.ActionType] {
+		if !hookMatches(hook, entry) {
+			continue
+		}
+
+		if err := hook.Fire(entry); err != nil {
+			veto, ok := err.(*VetoError)
+			if !ok {
+				veto = &VetoError{Reason: err.Error()}
+			}
+			veto.ActionType = entry.ActionType
+
+			log.WithFields(log.Fields{
+				"actionType":  entry.ActionType,
+				"reason":      veto.Reason,
+				"destination": entry.Destination,
+			}).Warn("action rejected by hook")
+			return veto
+		}
+	}
+	return nil
+}
+
+// beforePayloadHooks - fires "before" hooks for payload action and returns payload as modified by hooks
+func (d *DBClient) beforePayloadHooks(ac ActionType, message string, payload Payload) (Payload, error) {
+	if len(d.Hooks[ac]) == 0 {
+		return payload, nil
+	}
+
+	bts, err := payload.Encode()
+	if err != nil {
+		return payload, err
+	}
+
+	en := Entry{
+		ActionType:  ac,
+		Message:     message,
+		Time:        time.Now(),
+		Data:        bts,
+		Destination: payload.Request.Destination,
+		Mode:        d.Cfg.GetMode(),
+	}
+
+	if err := d.fireBeforeHooks(&en); err != nil {
+		return payload, err
+	}
+
+	modified, err := decodePayload(en.Data)
+	if err != nil {
+		return payload, fmt.Errorf("hook returned invalid payload: %s", err.Error())
+	}
+	return *modified, nil
+}
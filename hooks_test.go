@@ -0,0 +1,321 @@
+package hoverfly
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingHook - remembers entries it received, fails the first failures deliveries
+type recordingHook struct {
+	actionTypes []ActionType
+	failures    int
+
+	mu       sync.Mutex
+	attempts int
+	entries  []Entry
+}
+
+func (h *recordingHook) ActionTypes() []ActionType {
+	return h.actionTypes
+}
+
+func (h *recordingHook) Fire(entry *Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.attempts++
+	if h.attempts <= h.failures {
+		return fmt.Errorf("failure %d", h.attempts)
+	}
+	h.entries = append(h.entries, *entry)
+	return nil
+}
+
+func (h *recordingHook) received() []Entry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Entry{}, h.entries...)
+}
+
+func TestFireHooksSynchronouslyWithoutQueue(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	dbClient.Hooks = make(ActionTypeHooks)
+
+	// failing hook doesn't stop delivery to other hooks
+	failing := &recordingHook{actionTypes: []ActionType{ActionTypeWipeDB}, failures: 1}
+	hook := &recordingHook{actionTypes: []ActionType{ActionTypeWipeDB}}
+	dbClient.AddHook(failing)
+	dbClient.AddHook(hook)
+
+	dbClient.fireHooks(&Entry{ActionType: ActionTypeWipeDB, Message: "wipe"})
+
+	expect(t, len(failing.received()), 0)
+	expect(t, len(hook.received()), 1)
+	expect(t, hook.received()[0].Message, "wipe")
+}
+
+func TestHookFilters(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	dbClient.Hooks = make(ActionTypeHooks)
+
+	hook := &recordingHook{actionTypes: []ActionType{ActionTypeRequestCaptured, ActionTypeWipeDB}}
+	err := dbClient.AddHookWithOptions(hook, HookOptions{
+		Destination: `\.internal$`,
+		ActionTypes: []ActionType{ActionTypeRequestCaptured},
+		Modes:       []string{CaptureMode},
+	})
+	expect(t, err, nil)
+
+	// only registered for filtered action types
+	expect(t, len(dbClient.Hooks[ActionTypeWipeDB]), 0)
+
+	dbClient.fireHooks(&Entry{ActionType: ActionTypeRequestCaptured, Destination: "payments.internal", Mode: CaptureMode, Message: "match"})
+	dbClient.fireHooks(&Entry{ActionType: ActionTypeRequestCaptured, Destination: "payments.com", Mode: CaptureMode})
+	dbClient.fireHooks(&Entry{ActionType: ActionTypeRequestCaptured, Destination: "payments.internal", Mode: VirtualizeMode})
+
+	received := hook.received()
+	expect(t, len(received), 1)
+	expect(t, received[0].Message, "match")
+
+	err = dbClient.AddHookWithOptions(hook, HookOptions{Destination: "("})
+	refute(t, err, nil)
+}
+
+func TestHookQueueRetriesAndDeadLetters(t *testing.T) {
+	counter := NewModeCounter()
+
+	queue := NewHookQueue(10, 2, time.Millisecond)
+	queue.RegisterMetrics(counter)
+	queue.Start(1)
+
+	// succeeds on third attempt
+	flaky := &recordingHook{failures: 2}
+	// never succeeds
+	broken := &recordingHook{failures: 100}
+
+	queue.Enqueue(flaky, Entry{ActionType: ActionTypeRequestCaptured})
+	queue.Enqueue(broken, Entry{ActionType: ActionTypeRequestCaptured})
+	queue.Close()
+
+	expect(t, len(flaky.received()), 1)
+	expect(t, len(broken.received()), 0)
+	expect(t, broken.attempts, 3)
+
+	stats := counter.Flush()
+	expect(t, stats.Counters[MetricHooksQueued], int64(2))
+	expect(t, stats.Counters[MetricHooksDelivered], int64(1))
+	expect(t, stats.Counters[MetricHooksFailed], int64(5))
+	expect(t, stats.Counters[MetricHooksDeadLettered], int64(1))
+	expect(t, stats.Gauges[MetricHooksQueueLength], int64(0))
+}
+
+func TestHookQueueDropsWhenFull(t *testing.T) {
+	counter := NewModeCounter()
+
+	// workers are not started so nothing leaves the queue
+	queue := NewHookQueue(1, 0, 0)
+	queue.RegisterMetrics(counter)
+
+	hook := &recordingHook{}
+	queue.Enqueue(hook, Entry{})
+	queue.Enqueue(hook, Entry{})
+
+	stats := counter.Flush()
+	expect(t, stats.Counters[MetricHooksQueued], int64(1))
+	expect(t, stats.Counters[MetricHooksDropped], int64(1))
+	expect(t, stats.Gauges[MetricHooksQueueLength], int64(1))
+}
+
+func TestHookQueueDefaults(t *testing.T) {
+	queue := NewHookQueue(-1, -1, 0)
+	expect(t, cap(queue.queue), DefaultHookQueueSize)
+	expect(t, queue.Retries, DefaultHookRetries)
+	expect(t, queue.RetryDelay, DefaultHookRetryDelay)
+
+	// zero retries turn retrying off
+	queue = NewHookQueue(0, 0, -time.Second)
+	expect(t, cap(queue.queue), DefaultHookQueueSize)
+	expect(t, queue.Retries, 0)
+	expect(t, queue.RetryDelay, DefaultHookRetryDelay)
+}
+
+func TestFireHooksThroughQueue(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	dbClient.Hooks = make(ActionTypeHooks)
+
+	dbClient.HookQueue = NewHookQueue(10, 0, 0)
+
+	queued := &recordingHook{actionTypes: []ActionType{ActionTypeConfigurationChanged}}
+	synchronous := &recordingHook{actionTypes: []ActionType{ActionTypeConfigurationChanged}}
+	dbClient.AddHook(queued)
+	err := dbClient.AddHookWithOptions(synchronous, HookOptions{Sync: true})
+	expect(t, err, nil)
+
+	dbClient.fireHooks(&Entry{ActionType: ActionTypeConfigurationChanged})
+
+	// synchronous hook is called straight away, queued one only after workers deliver it
+	expect(t, len(synchronous.received()), 1)
+	expect(t, len(queued.received()), 0)
+
+	dbClient.HookQueue.Start(1)
+	dbClient.HookQueue.Close()
+	expect(t, len(queued.received()), 1)
+}
+
+// policyHook - "before" hook rejecting payloads for blocked destination and rewriting response bodies
+type policyHook struct {
+	actionTypes []ActionType
+	blocked     string
+	body        string
+}
+
+func (h *policyHook) ActionTypes() []ActionType {
+	return h.actionTypes
+}
+
+func (h *policyHook) Fire(entry *Entry) error {
+	if entry.Destination == h.blocked {
+		return Veto("destination is blocked")
+	}
+	if h.body == "" {
+		return nil
+	}
+
+	payload, err := decodePayload(entry.Data)
+	if err != nil {
+		return err
+	}
+	payload.Response.Body = h.body
+	entry.Data, err = payload.Encode()
+	return err
+}
+
+func TestBeforeCaptureHook(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+	dbClient.Hooks = make(ActionTypeHooks)
+
+	dbClient.AddHook(&policyHook{
+		actionTypes: []ActionType{ActionTypeBeforeCapture},
+		blocked:     "blocked.com",
+		body:        "redacted",
+	})
+
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}}
+
+	blocked, _ := http.NewRequest("GET", "http://blocked.com/", nil)
+	dbClient.save(blocked, nil, resp, []byte("secret"))
+
+	allowed, _ := http.NewRequest("GET", "http://allowed.com/", nil)
+	dbClient.save(allowed, nil, resp, []byte("secret"))
+
+	payloads, err := dbClient.Cache.GetAllRequests()
+	expect(t, err, nil)
+	expect(t, len(payloads), 1)
+	expect(t, payloads[0].Request.Destination, "allowed.com")
+	expect(t, payloads[0].Response.Body, "redacted")
+}
+
+func TestBeforeImportHook(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+	dbClient.Hooks = make(ActionTypeHooks)
+
+	dbClient.AddHook(&policyHook{actionTypes: []ActionType{ActionTypeBeforeImport}, blocked: "blocked.com"})
+
+	err := dbClient.ImportPayloads([]Payload{
+		{
+			Request:  RequestDetails{Destination: "blocked.com", Path: "/", Method: "GET"},
+			Response: ResponseDetails{Status: 200, Body: "blocked"},
+		},
+		{
+			Request:  RequestDetails{Destination: "allowed.com", Path: "/", Method: "GET"},
+			Response: ResponseDetails{Status: 200, Body: "allowed"},
+		},
+	})
+	expect(t, err, nil)
+
+	payloads, err := dbClient.Cache.GetAllRequests()
+	expect(t, err, nil)
+	expect(t, len(payloads), 1)
+	expect(t, payloads[0].Request.Destination, "allowed.com")
+}
+
+// modeHook - "before" configuration change hook
+type modeHook struct {
+	mode string
+	veto bool
+}
+
+func (h *modeHook) ActionTypes() []ActionType {
+	return []ActionType{ActionTypeBeforeConfigurationChange, ActionTypeBeforeWipeDB}
+}
+
+func (h *modeHook) Fire(entry *Entry) error {
+	if h.veto {
+		return Veto("changes are frozen")
+	}
+	entry.Data = []byte(h.mode)
+	return nil
+}
+
+func TestBeforeHooksVetoAdminActions(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+	dbClient.Hooks = make(ActionTypeHooks)
+
+	dbClient.Cfg.SetMode(VirtualizeMode)
+	dbClient.AddHook(&modeHook{veto: true})
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	dbClient.captureRequest(req)
+
+	m := getBoneRouter(*dbClient)
+
+	rec := httptest.NewRecorder()
+	deleteReq, err := http.NewRequest("DELETE", "/records", nil)
+	expect(t, err, nil)
+	m.ServeHTTP(rec, deleteReq)
+	expect(t, rec.Code, http.StatusForbidden)
+
+	count, err := dbClient.Cache.RecordsCount()
+	expect(t, err, nil)
+	expect(t, count, 1)
+
+	rec = httptest.NewRecorder()
+	stateReq, err := http.NewRequest("POST", "/state", ioutil.NopCloser(bytes.NewBufferString(`{"mode":"capture"}`)))
+	expect(t, err, nil)
+	m.ServeHTTP(rec, stateReq)
+	expect(t, rec.Code, http.StatusForbidden)
+	expect(t, dbClient.Cfg.GetMode(), VirtualizeMode)
+}
+
+func TestBeforeConfigurationChangeHookModifiesMode(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	dbClient.Hooks = make(ActionTypeHooks)
+
+	dbClient.Cfg.SetMode(VirtualizeMode)
+	dbClient.AddHook(&modeHook{mode: SynthesizeMode})
+
+	m := getBoneRouter(*dbClient)
+
+	rec := httptest.NewRecorder()
+	stateReq, err := http.NewRequest("POST", "/state", ioutil.NopCloser(bytes.NewBufferString(`{"mode":"capture"}`)))
+	expect(t, err, nil)
+	m.ServeHTTP(rec, stateReq)
+	expect(t, rec.Code, http.StatusOK)
+	expect(t, dbClient.Cfg.GetMode(), SynthesizeMode)
+}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"regexp"
+	"time"
 )
 
 // VirtualizeMode - default mode when Hoverfly looks for captured requests to respond
@@ -23,6 +24,9 @@ const ModifyMode = "modify"
 // CaptureMode - requests are captured and stored in cache
 const CaptureMode = "capture"
 
+// FuzzMode - recorded responses are returned with mutations, to check how clients cope with malformed responses
+const FuzzMode = "fuzz"
+
 // orPanic - wrapper for logging errors
 func orPanic(err error) {
 	if err != nil {
@@ -39,11 +43,65 @@ func GetNewHoverfly(cfg *Configuration, cache Cache) (*goproxy.ProxyHttpServer,
 
 	// getting connections
 	d := DBClient{
-		Cache:   cache,
-		HTTP:    &http.Client{},
-		Cfg:     cfg,
-		Counter: counter,
-		Hooks:   make(ActionTypeHooks),
+		Cache:    cache,
+		HTTP:     &http.Client{},
+		Cfg:      cfg,
+		Counter:  counter,
+		Hooks:    make(ActionTypeHooks),
+		Notifier: NewRequestNotifier(),
+		Journal:  NewJournal(DefaultJournalSize),
+		Logging:  NewLogManager(DefaultLogBufferSize),
+	}
+
+	d.Callbacks = NewCallbackScheduler(DefaultCallbackWorkers, DefaultCallbackQueueSize)
+
+	if !cfg.HooksSync {
+		d.HookQueue = NewHookQueue(cfg.HookQueueSize, cfg.HookRetries, cfg.HookRetryDelay)
+		d.HookQueue.RegisterMetrics(counter)
+		d.HookQueue.Start(DefaultHookWorkers)
+	}
+
+	if cfg.TracingEndpoint != "" {
+		d.Tracer = NewTracer(cfg.TracingEndpoint, cfg.TracingServiceName)
+	}
+
+	fuzzer, err := NewFuzzer(cfg.FuzzSeed, cfg.FuzzMutations)
+	orPanic(err)
+	d.Fuzzer = fuzzer
+
+	faker, err := NewFaker(cfg.FakeSeed, cfg.FakeLocale)
+	orPanic(err)
+	d.Faker = faker
+
+	ConfigureWASMMiddleware(cfg.WASMLimits())
+
+	if cfg.ReplicationLogSize > 0 {
+		d.Replication = NewReplicationLog(cfg.ReplicationLogSize)
+		// recorded in the request path, so changes are numbered in the order they were stored
+		orPanic(d.AddHookWithOptions(d.Replication, HookOptions{Sync: true}))
+	}
+
+	if cfg.Registry != "" {
+		registry, err := NewRegistryClient(cfg.Registry, cfg.RegistryCacheDir)
+		orPanic(err)
+		d.Registry = registry
+	}
+
+	if len(cfg.SessionCookies) > 0 {
+		d.Sessions = NewSessionStore(cfg.SessionCookies, cfg.SessionMatching)
+	}
+
+	// blobs are kept in the same database as payloads
+	if bc, ok := cache.(*BoltCache); ok {
+		d.Bodies = NewBodyStore(cfg.BodyFilesDir, bc.DS)
+	} else {
+		d.Bodies = NewBodyStore(cfg.BodyFilesDir, nil)
+	}
+	if cfg.GetMode() == FuzzMode {
+		log.WithFields(log.Fields{
+			"seed":      fuzzer.Seed,
+			"mutations": fuzzer.Mutations,
+		}).Info("fuzzing responses, reuse the seed to reproduce mutations")
 	}
 
 	// creating proxy
@@ -111,15 +169,44 @@ func hoverflyError(req *http.Request, err error, msg string, statusCode int) *ht
 
 // processRequest - processes incoming requests and based on proxy state (record/playback)
 // returns HTTP response.
-func (d *DBClient) processRequest(req *http.Request) (*http.Request, *http.Response) {
+func (d *DBClient) processRequest(req *http.Request) (_ *http.Request, resp *http.Response) {
 
 	mode := d.Cfg.GetMode()
+	started := time.Now()
+
+	span := d.Tracer.StartRequestSpan(req)
+	req = requestWithSpan(req, span)
+	span.SetAttribute("hoverfly.mode", mode)
+
+	defer func() {
+		if resp != nil {
+			span.SetAttribute("http.status_code", resp.StatusCode)
+			if kind := resp.Header.Get(HoverflyErrorHeader); kind != "" {
+				span.SetError(fmt.Errorf("hoverfly error: %s", kind))
+			}
+		}
+		span.Finish()
+		d.AccessLog.Log(newAccessLogEntry(req, resp, mode, started))
+		latency := time.Since(started)
+		d.Counter.Observe(latency, matchResult(resp, mode))
+
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		d.Counter.Windows.Observe(req.Host, req.URL.Path, status, latency, time.Now())
+	}()
+
+	// letting waiting clients know about this request
+	if rd, err := getRequestDetails(req); err == nil {
+		d.Notifier.Notify(ObservedRequest{Request: rd, Mode: mode, Time: time.Now()})
+	}
 
 	if mode == CaptureMode {
 		newResponse, err := d.captureRequest(req)
 
 		if err != nil {
-			return req, hoverflyError(req, err, "Could not capture request", http.StatusServiceUnavailable)
+			return req, d.errorResponse(req, err, "Could not capture request", ErrorKindCapture, "")
 		}
 		log.WithFields(log.Fields{
 			"mode":        mode,
@@ -133,10 +220,10 @@ func (d *DBClient) processRequest(req *http.Request) (*http.Request, *http.Respo
 		return req, newResponse
 
 	} else if mode == SynthesizeMode {
-		response, err := SynthesizeResponse(req, d.Cfg.Middleware)
+		response, err := d.synthesizeResponse(req)
 
 		if err != nil {
-			return req, hoverflyError(req, err, "Could not create synthetic response!", http.StatusServiceUnavailable)
+			return req, d.errorResponse(req, err, "Could not create synthetic response!", ErrorKindSynthesize, "")
 		}
 
 		log.WithFields(log.Fields{
@@ -158,11 +245,12 @@ func (d *DBClient) processRequest(req *http.Request) (*http.Request, *http.Respo
 				"error":      err.Error(),
 				"middleware": d.Cfg.Middleware,
 			}).Error("Got error when performing request modification")
-			return req, hoverflyError(
+			return req, d.errorResponse(
 				req,
 				err,
 				fmt.Sprintf("Middleware (%s) failed or something else happened!", d.Cfg.Middleware),
-				http.StatusServiceUnavailable)
+				ErrorKindModify,
+				"")
 		}
 		// returning modified response
 		return req, response
@@ -26,16 +26,25 @@ func (d *DBClient) Import(uri string) error {
 		}).Info("URL")
 		return d.ImportFromURL(uri)
 	}
+	// simulation published to registry, e.g. "payments:1.2.0"
+	if d.Registry != nil && isSimulationRef(uri) {
+		if exists, _ := exists(uri); !exists {
+			return d.ImportFromRegistry(uri)
+		}
+	}
 	// assuming file URI is disk location
 	ext := path.Ext(uri)
-	if ext != ".json" {
-		return fmt.Errorf("Failed to import payloads, only JSON files are acceppted. Given file: %s", uri)
+	if ext != ".json" && ext != ".zip" {
+		return fmt.Errorf("Failed to import payloads, only JSON files and zip bundles are acceppted. Given file: %s", uri)
 	}
 	// checking whether it exists
 	exists, err := exists(uri)
 	if err != nil {
 		return fmt.Errorf("Failed to import payloads from %s. Got error: %s", uri, err.Error())
 	}
+	if exists && ext == ".zip" {
+		return d.ImportFromZip(uri)
+	}
 	if exists {
 		// file is JSON and it exist
 		return d.ImportFromDisk(uri)
@@ -93,7 +102,13 @@ func (d *DBClient) ImportFromDisk(path string) error {
 		return fmt.Errorf("Got error while parsing payloads file, error %s", err.Error())
 	}
 
-	return d.ImportPayloads(requests.Data)
+	// body files are relative to payloads file
+	bodies, err := d.loadBodies(requests.Data, fileBodyLoader(path))
+	if err != nil {
+		return err
+	}
+
+	return d.importPayloads(requests.Data, bodies)
 }
 
 // ImportFromURL - takes one string value and tries connect to a remote server, then parse response body into
@@ -113,50 +128,30 @@ func (d *DBClient) ImportFromURL(url string) error {
 		return fmt.Errorf("Got error while parsing payloads, error %s", err.Error())
 	}
 
-	return d.ImportPayloads(requests.Data)
+	// body files are relative to payloads URL
+	bodies, err := d.loadBodies(requests.Data, d.urlBodyLoader(url))
+	if err != nil {
+		return err
+	}
+
+	return d.importPayloads(requests.Data, bodies)
 }
 
 // ImportPayloads - a function to save given payloads into the database.
 func (d *DBClient) ImportPayloads(payloads []Payload) error {
+	return d.importPayloads(payloads, nil)
+}
+
+// importPayloads - saves payloads into the database, bodies are contents of blobs payloads reference
+func (d *DBClient) importPayloads(payloads []Payload, bodies map[string][]byte) error {
 	if len(payloads) > 0 {
 		success := 0
 		failed := 0
 		for _, pl := range payloads {
-			// recalculating request hash and storing it in database
-			r := RequestContainer{Details: pl.Request}
-			key := r.Hash()
-
-			// regenerating key
-			pl.ID = key
-
-			bts, err := pl.Encode()
-			if err != nil {
-				log.WithFields(log.Fields{
-					"error": err.Error(),
-				}).Error("Failed to encode payload")
+			if _, err := d.importPayload(pl, bodies); err != nil {
 				failed++
 			} else {
-				// hook
-				var en Entry
-				en.ActionType = ActionTypeRequestCaptured
-				en.Message = "imported"
-				en.Time = time.Now()
-				en.Data = bts
-
-				if err := d.Hooks.Fire(ActionTypeRequestCaptured, &en); err != nil {
-					log.WithFields(log.Fields{
-						"error":      err.Error(),
-						"message":    en.Message,
-						"actionType": ActionTypeRequestCaptured,
-					}).Error("failed to fire hook")
-				}
-
-				d.Cache.Set([]byte(key), bts)
-				if err == nil {
-					success++
-				} else {
-					failed++
-				}
+				success++
 			}
 		}
 		log.WithFields(log.Fields{
@@ -168,3 +163,65 @@ func (d *DBClient) ImportPayloads(payloads []Payload) error {
 	}
 	return fmt.Errorf("Bad request. Nothing to import!")
 }
+
+// importPayload - saves single payload into the database, returns payload as it was stored. Blob payload
+// references is stored too when bodies contain it.
+func (d *DBClient) importPayload(pl Payload, bodies map[string][]byte) (Payload, error) {
+	pl, err := d.beforePayloadHooks(ActionTypeBeforeImport, "import", pl)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":       err.Error(),
+			"destination": pl.Request.Destination,
+			"path":        pl.Request.Path,
+		}).Warn("Payload not imported")
+		return pl, err
+	}
+
+	if pl.Request.Session == "" {
+		pl.Request.Session = d.Sessions.identity(pl.Request.Headers)
+	}
+
+	// recalculating request hash and storing it in database
+	r := RequestContainer{Details: pl.Request}
+	key := r.Hash()
+
+	// regenerating key
+	pl.ID = key
+
+	if err := pl.validateCallbacks(); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"key":   key,
+		}).Error("Invalid payload callbacks")
+		return pl, err
+	}
+
+	bts, err := pl.Encode()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Failed to encode payload")
+		return pl, err
+	}
+
+	if err := d.storePayload(key, bts, pl.Response.BodyFile, bodies[pl.Response.BodyFile]); err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"key":   key,
+		}).Error("Failed to store payload")
+		return pl, err
+	}
+
+	// hook, fired only after payload is stored, so hooks can read it back and replicas never get sequence
+	// numbers of changes missing from records
+	var en Entry
+	en.ActionType = ActionTypeRequestCaptured
+	en.Message = "imported"
+	en.Time = time.Now()
+	en.Data = bts
+	en.Destination = pl.Request.Destination
+
+	d.fireHooks(&en)
+
+	return pl, nil
+}
@@ -0,0 +1,79 @@
+package hoverfly
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultJournalSize - how many entries are kept in the journal, oldest entries are dropped first
+const DefaultJournalSize = 1000
+
+// JournalEntryCallback - journal entry type for outbound callbacks
+const JournalEntryCallback = "callback"
+
+// JournalEntry - describes single action performed by Hoverfly, such as an outbound callback
+type JournalEntry struct {
+	Type     string           `json:"type"`
+	Time     time.Time        `json:"time"`
+	Request  RequestDetails   `json:"request"`
+	Response *ResponseDetails `json:"response,omitempty"`
+	// Latency in milliseconds
+	Latency  float64 `json:"latency"`
+	Attempts int     `json:"attempts,omitempty"`
+	Error    string  `json:"error,omitempty"`
+	// Key of the payload that caused this entry
+	Key string `json:"key,omitempty"`
+}
+
+// Journal - bounded in-memory log of actions performed by Hoverfly
+type Journal struct {
+	mu      sync.Mutex
+	entries []JournalEntry
+	size    int
+}
+
+// NewJournal - returns new journal instance that keeps up to size entries
+func NewJournal(size int) *Journal {
+	return &Journal{size: size}
+}
+
+// Add - adds new entry to the journal
+func (j *Journal) Add(entry JournalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = append(j.entries, entry)
+	if len(j.entries) > j.size {
+		j.entries = j.entries[len(j.entries)-j.size:]
+	}
+}
+
+// Entries - returns up to limit most recent journal entries of given type, empty type returns
+// all types and limit <= 0 returns all entries
+func (j *Journal) Entries(entryType string, limit int) []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := []JournalEntry{}
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+		if entryType == "" || j.entries[i].Type == entryType {
+			entries = append(entries, j.entries[i])
+		}
+	}
+
+	// returning in chronological order
+	for i, k := 0, len(entries)-1; i < k; i, k = i+1, k-1 {
+		entries[i], entries[k] = entries[k], entries[i]
+	}
+	return entries
+}
+
+// Delete - removes all journal entries
+func (j *Journal) Delete() {
+	j.mu.Lock()
+	j.entries = nil
+	j.mu.Unlock()
+}
@@ -0,0 +1,67 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJournalSizeLimit(t *testing.T) {
+	j := NewJournal(3)
+
+	for i := 0; i < 5; i++ {
+		j.Add(JournalEntry{Type: JournalEntryCallback, Attempts: i})
+	}
+
+	entries := j.Entries("", 0)
+	expect(t, len(entries), 3)
+	expect(t, entries[0].Attempts, 2)
+	expect(t, entries[2].Attempts, 4)
+}
+
+func TestJournalEntriesFilter(t *testing.T) {
+	j := NewJournal(10)
+
+	j.Add(JournalEntry{Type: JournalEntryCallback, Key: "1"})
+	j.Add(JournalEntry{Type: "other", Key: "2"})
+	j.Add(JournalEntry{Type: JournalEntryCallback, Key: "3"})
+	j.Add(JournalEntry{Type: JournalEntryCallback, Key: "4"})
+
+	entries := j.Entries(JournalEntryCallback, 2)
+	expect(t, len(entries), 2)
+	expect(t, entries[0].Key, "3")
+	expect(t, entries[1].Key, "4")
+
+	j.Delete()
+	expect(t, len(j.Entries("", 0)), 0)
+}
+
+func TestJournalHandler(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	m := getBoneRouter(*dbClient)
+
+	dbClient.Journal.Add(JournalEntry{Type: JournalEntryCallback, Key: "abc"})
+
+	req, err := http.NewRequest("GET", "/journal?type=callback", nil)
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+
+	var jr journalResponse
+	err = json.Unmarshal(rec.Body.Bytes(), &jr)
+	expect(t, err, nil)
+	expect(t, len(jr.Data), 1)
+	expect(t, jr.Data[0].Key, "abc")
+
+	req, err = http.NewRequest("DELETE", "/journal", nil)
+	expect(t, err, nil)
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+	expect(t, len(dbClient.Journal.Entries("", 0)), 0)
+}
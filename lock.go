@@ -0,0 +1,72 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// StatusLocked - returned by admin API when records or mode are changed while simulation is locked
+const StatusLocked = 423
+
+type lockResponse struct {
+	Locked bool `json:"locked"`
+}
+
+// rejectLocked - responds with 423 Locked when simulation is locked, returns true if request was rejected
+func (d *DBClient) rejectLocked(w http.ResponseWriter) bool {
+	if !d.Cfg.IsLocked() {
+		return false
+	}
+	var response messageResponse
+	response.Message = "Simulation is locked, records and mode can't be changed until it is unlocked"
+
+	b, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(StatusLocked)
+	w.Write(b)
+	return true
+}
+
+// setLocked - locks or unlocks simulation and notifies hooks
+func (d *DBClient) setLocked(locked bool) {
+	d.Cfg.SetLocked(locked)
+
+	message := "unlocked"
+	if locked {
+		message = "locked"
+	}
+	log.WithFields(log.Fields{
+		"mode": d.Cfg.GetMode(),
+	}).Info("Simulation " + message)
+
+	var en Entry
+	en.ActionType = ActionTypeConfigurationChanged
+	en.Message = message
+	en.Time = time.Now()
+	en.Mode = d.Cfg.GetMode()
+	en.Data = []byte(en.Mode)
+
+	d.fireHooks(&en)
+}
+
+// LockHandler - returns whether simulation is locked
+func (d *DBClient) LockHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	b, _ := json.Marshal(lockResponse{Locked: d.Cfg.IsLocked()})
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(b)
+}
+
+// SetLockHandler - locks simulation, records and mode can't be changed through the admin API afterwards
+func (d *DBClient) SetLockHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	d.setLocked(true)
+	d.LockHandler(w, req, next)
+}
+
+// DeleteLockHandler - unlocks simulation
+func (d *DBClient) DeleteLockHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	d.setLocked(false)
+	d.LockHandler(w, req, next)
+}
@@ -0,0 +1,102 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SpectoLabs/hoverfly/authentication/backends"
+)
+
+func lockTestRequest(dbClient *DBClient, method, path, body string, headers ...string) *httptest.ResponseRecorder {
+	m := getBoneRouter(*dbClient)
+
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestLockedSimulation(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Cfg.SetMode("virtualize")
+	expect(t, dbClient.ImportPayloads([]Payload{{
+		Request:  RequestDetails{Destination: "a.com", Path: "/", Method: "GET"},
+		Response: ResponseDetails{Status: 200},
+	}}), nil)
+
+	rec := lockTestRequest(dbClient, "POST", "/lock", "")
+	expect(t, rec.Code, http.StatusOK)
+	expect(t, dbClient.Cfg.IsLocked(), true)
+
+	rec = lockTestRequest(dbClient, "POST", "/state", `{"mode":"capture"}`)
+	expect(t, rec.Code, StatusLocked)
+	rec = lockTestRequest(dbClient, "DELETE", "/records", "")
+	expect(t, rec.Code, StatusLocked)
+	rec = lockTestRequest(dbClient, "POST", "/records", `{"data":[{"request":{"destination":"b.com"},"response":{"status":200}}]}`)
+	expect(t, rec.Code, StatusLocked)
+	rec = lockTestRequest(dbClient, "POST", "/add", "inputDestination=b.com",
+		"Content-Type", "application/x-www-form-urlencoded")
+	expect(t, rec.Code, StatusLocked)
+	rec = lockTestRequest(dbClient, "POST", "/payloads", `{"payload":{"request":{"destination":"b.com"}}}`)
+	expect(t, rec.Code, StatusLocked)
+
+	// dry runs don't change anything
+	rec = lockTestRequest(dbClient, "POST", "/payloads", `{"payload":{"request":{"destination":"b.com"}},"dryRun":true}`)
+	expect(t, rec.Code, http.StatusOK)
+
+	expect(t, dbClient.Cfg.GetMode(), "virtualize")
+	count, _ := dbClient.Cache.RecordsCount()
+	expect(t, count, 1)
+
+	rec = lockTestRequest(dbClient, "GET", "/state", "")
+	var state stateRequest
+	expect(t, json.Unmarshal(rec.Body.Bytes(), &state), nil)
+	expect(t, state.Locked, true)
+
+	rec = lockTestRequest(dbClient, "DELETE", "/lock", "")
+	expect(t, rec.Code, http.StatusOK)
+	rec = lockTestRequest(dbClient, "POST", "/state", `{"mode":"capture"}`)
+	expect(t, rec.Code, http.StatusOK)
+	expect(t, json.Unmarshal(rec.Body.Bytes(), &state), nil)
+	expect(t, state.Locked, false)
+	expect(t, state.Mode, "capture")
+}
+
+func TestLockedBatchIsRolledBack(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Cfg.SetLocked(true)
+
+	code, response := batchRequestRecorder(t, dbClient, `{"operations": [
+		{"method": "GET", "path": "/records"},
+		{"method": "DELETE", "path": "/records"}
+	]}`)
+	expect(t, code, 400)
+	expect(t, response.Data[1].Status, StatusLocked)
+}
+
+func TestUnlockRequiresAuthentication(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.AB = backends.NewBoltDBAuthBackend(TestDB, []byte(GetRandomName(10)), []byte(GetRandomName(10)))
+	dbClient.Cfg.AuthEnabled = true
+	dbClient.Cfg.SecretKey = []byte("secret")
+	dbClient.Cfg.SetLocked(true)
+
+	rec := lockTestRequest(dbClient, "DELETE", "/lock", "")
+	expect(t, rec.Code, http.StatusUnauthorized)
+	expect(t, dbClient.Cfg.IsLocked(), true)
+}
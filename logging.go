@@ -0,0 +1,293 @@
+package hoverfly
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultLogBufferSize - how many recent log entries are kept in memory
+const DefaultLogBufferSize = 1000
+
+// Log components, each of them can have its own log level
+const (
+	ComponentProxy      = "proxy"
+	ComponentMiddleware = "middleware"
+	ComponentAdmin      = "admin"
+	ComponentAuth       = "auth"
+)
+
+// LogComponents - all known log components
+var LogComponents = []string{ComponentProxy, ComponentMiddleware, ComponentAdmin, ComponentAuth}
+
+// loggingFile - this file, frames from it are skipped when looking for the caller
+var _, loggingFile, _, _ = runtime.Caller(0)
+
+// LogEntry - log entry kept in recent logs buffer
+type LogEntry struct {
+	Time      time.Time              `json:"time"`
+	Level     string                 `json:"level"`
+	Component string                 `json:"component"`
+	Message   string                 `json:"message"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// LogManager - controls log levels at runtime, globally and per component, and keeps recent log
+// entries in a ring buffer. Component is taken from "component" field of the entry or, when it's not
+// there, from the source file that logged it. Installed logger is left at debug level, entries are
+// filtered by the formatter against levels that are swapped atomically, so they can change while
+// other goroutines log.
+type LogManager struct {
+	mu     sync.Mutex
+	levels atomic.Value
+
+	entries []LogEntry
+	size    int
+}
+
+// logLevels - immutable snapshot of log levels, replaced as a whole on every change
+type logLevels struct {
+	global     log.Level
+	components map[string]log.Level
+	// max - most verbose level of all components, anything above it is dropped straight away
+	max log.Level
+}
+
+func newLogLevels(global log.Level, components map[string]log.Level) *logLevels {
+	levels := &logLevels{global: global, components: components, max: global}
+	for _, l := range components {
+		if l > levels.max {
+			levels.max = l
+		}
+	}
+	return levels
+}
+
+func (l *logLevels) component(component string) log.Level {
+	if level, ok := l.components[component]; ok {
+		return level
+	}
+	return l.global
+}
+
+// NewLogManager - returns log manager keeping up to size recent log entries
+func NewLogManager(size int) *LogManager {
+	m := &LogManager{size: size}
+	m.levels.Store(newLogLevels(log.InfoLevel, map[string]log.Level{}))
+	return m
+}
+
+// Install - starts managing given logger, its current level becomes the global level. It should be
+// called before the logger is used by other goroutines.
+func (m *LogManager) Install(logger *log.Logger) {
+	m.update(func(levels *logLevels) *logLevels {
+		return newLogLevels(logger.Level, levels.components)
+	})
+
+	logger.Formatter = &componentFormatter{manager: m, formatter: logger.Formatter}
+	logger.SetLevel(log.DebugLevel)
+}
+
+// Level - returns global log level
+func (m *LogManager) Level() log.Level {
+	return m.loadLevels().global
+}
+
+// SetLevel - sets global log level, components without their own level follow it
+func (m *LogManager) SetLevel(level log.Level) {
+	m.update(func(levels *logLevels) *logLevels {
+		return newLogLevels(level, levels.components)
+	})
+}
+
+// ComponentLevels - returns effective log level for each component
+func (m *LogManager) ComponentLevels() map[string]log.Level {
+	current := m.loadLevels()
+	levels := make(map[string]log.Level)
+	for _, c := range LogComponents {
+		levels[c] = current.component(c)
+	}
+	return levels
+}
+
+// SetComponentLevel - sets log level for given component
+func (m *LogManager) SetComponentLevel(component string, level log.Level) error {
+	if !validLogComponent(component) {
+		return fmt.Errorf("unknown log component '%s'", component)
+	}
+	m.update(func(levels *logLevels) *logLevels {
+		components := copyLogLevels(levels.components)
+		components[component] = level
+		return newLogLevels(levels.global, components)
+	})
+	return nil
+}
+
+// ResetComponentLevel - makes component follow global log level again
+func (m *LogManager) ResetComponentLevel(component string) error {
+	if !validLogComponent(component) {
+		return fmt.Errorf("unknown log component '%s'", component)
+	}
+	m.update(func(levels *logLevels) *logLevels {
+		components := copyLogLevels(levels.components)
+		delete(components, component)
+		return newLogLevels(levels.global, components)
+	})
+	return nil
+}
+
+// Entries - returns up to limit most recent log entries with given level or more severe, empty
+// component returns entries of all components, limit <= 0 returns all entries
+func (m *LogManager) Entries(level log.Level, component string, limit int) []LogEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := []LogEntry{}
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+		e := m.entries[i]
+		l, err := log.ParseLevel(e.Level)
+		if err != nil || l > level {
+			continue
+		}
+		if component == "" || e.Component == component {
+			entries = append(entries, e)
+		}
+	}
+
+	// returning in chronological order
+	for i, k := 0, len(entries)-1; i < k; i, k = i+1, k-1 {
+		entries[i], entries[k] = entries[k], entries[i]
+	}
+	return entries
+}
+
+func (m *LogManager) loadLevels() *logLevels {
+	return m.levels.Load().(*logLevels)
+}
+
+// update - replaces levels snapshot, writers are serialized so that concurrent changes aren't lost
+func (m *LogManager) update(change func(*logLevels) *logLevels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.levels.Store(change(m.loadLevels()))
+}
+
+// enabled - checks whether entry should be logged according to its component level, component
+// is looked up only for entries that some component could log
+func (m *LogManager) enabled(entry *log.Entry) (string, bool) {
+	levels := m.loadLevels()
+	if entry.Level > levels.max {
+		return "", false
+	}
+	component := entryComponent(entry)
+	return component, entry.Level <= levels.component(component)
+}
+
+func (m *LogManager) add(component string, entry *log.Entry) {
+	fields := make(map[string]interface{}, len(entry.Data))
+	for k, v := range entry.Data {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fields[k] = v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = append(m.entries, LogEntry{
+		Time:      entry.Time,
+		Level:     entry.Level.String(),
+		Component: component,
+		Message:   entry.Message,
+		Fields:    fields,
+	})
+	if len(m.entries) > m.size {
+		m.entries = m.entries[len(m.entries)-m.size:]
+	}
+}
+
+// componentFormatter - drops entries that are below their component level and adds the rest to
+// recent logs buffer, so component of each entry is worked out only once
+type componentFormatter struct {
+	manager   *LogManager
+	formatter log.Formatter
+}
+
+func (f *componentFormatter) Format(entry *log.Entry) ([]byte, error) {
+	component, ok := f.manager.enabled(entry)
+	if !ok {
+		return nil, nil
+	}
+	f.manager.add(component, entry)
+	return f.formatter.Format(entry)
+}
+
+func copyLogLevels(levels map[string]log.Level) map[string]log.Level {
+	c := make(map[string]log.Level, len(levels))
+	for k, v := range levels {
+		c[k] = v
+	}
+	return c
+}
+
+func validLogComponent(component string) bool {
+	for _, c := range LogComponents {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+// entryComponent - returns component that created given log entry
+func entryComponent(entry *log.Entry) string {
+	if c, ok := entry.Data["component"].(string); ok && validLogComponent(c) {
+		return c
+	}
+
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		if frame.File != loggingFile && !strings.Contains(strings.ToLower(frame.Function), "sirupsen/logrus") {
+			return fileComponent(frame.File)
+		}
+		if !more {
+			return ComponentProxy
+		}
+	}
+}
+
+// fileComponent - maps source file to log component
+func fileComponent(file string) string {
+	if strings.Contains(filepath.ToSlash(file), "/authentication/") {
+		return ComponentAuth
+	}
+	switch filepath.Base(file) {
+	case "middleware.go", "synthesize.go":
+		return ComponentMiddleware
+	case "admin.go":
+		return ComponentAdmin
+	}
+	return ComponentProxy
+}
+
+// logLevelsRequest - log levels as used by admin API
+type logLevelsRequest struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+type logsResponse struct {
+	Data []LogEntry `json:"data"`
+}
@@ -0,0 +1,207 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func testLogger(level log.Level) (*log.Logger, *bytes.Buffer) {
+	var out bytes.Buffer
+	logger := log.New()
+	logger.Out = &out
+	logger.Level = level
+	logger.Formatter = &log.JSONFormatter{}
+	return logger, &out
+}
+
+func TestFileComponent(t *testing.T) {
+	expect(t, fileComponent("/go/src/github.com/SpectoLabs/hoverfly/middleware.go"), ComponentMiddleware)
+	expect(t, fileComponent("/go/src/github.com/SpectoLabs/hoverfly/synthesize.go"), ComponentMiddleware)
+	expect(t, fileComponent("/go/src/github.com/SpectoLabs/hoverfly/admin.go"), ComponentAdmin)
+	expect(t, fileComponent("/go/src/github.com/SpectoLabs/hoverfly/authentication/jwt_backend.go"), ComponentAuth)
+	expect(t, fileComponent("/go/src/github.com/SpectoLabs/hoverfly/hoverfly.go"), ComponentProxy)
+}
+
+func TestLogManagerComponentLevels(t *testing.T) {
+	logger, out := testLogger(log.InfoLevel)
+
+	m := NewLogManager(DefaultLogBufferSize)
+	m.Install(logger)
+
+	// logger lets through debug entries, they are filtered by component levels
+	expect(t, logger.Level, log.DebugLevel)
+	expect(t, m.Level(), log.InfoLevel)
+
+	err := m.SetComponentLevel(ComponentMiddleware, log.DebugLevel)
+	expect(t, err, nil)
+
+	logger.WithField("component", ComponentMiddleware).Debug("middleware debug")
+	logger.WithField("component", ComponentProxy).Debug("proxy debug")
+	logger.WithField("component", ComponentProxy).Info("proxy info")
+
+	expect(t, strings.Contains(out.String(), "middleware debug"), true)
+	expect(t, strings.Contains(out.String(), "proxy debug"), false)
+	expect(t, strings.Contains(out.String(), "proxy info"), true)
+
+	// entries logged from this file belong to proxy component
+	logger.Debug("unlabelled debug")
+	expect(t, strings.Contains(out.String(), "unlabelled debug"), false)
+
+	err = m.ResetComponentLevel(ComponentMiddleware)
+	expect(t, err, nil)
+	expect(t, logger.Level, log.DebugLevel)
+
+	logger.WithField("component", ComponentMiddleware).Debug("middleware debug after reset")
+	expect(t, strings.Contains(out.String(), "middleware debug after reset"), false)
+
+	err = m.SetComponentLevel("database", log.DebugLevel)
+	refute(t, err, nil)
+}
+
+func TestLogManagerEntries(t *testing.T) {
+	logger, _ := testLogger(log.DebugLevel)
+
+	m := NewLogManager(3)
+	m.Install(logger)
+
+	logger.WithField("component", ComponentAuth).Debug("first")
+	logger.WithField("component", ComponentAuth).Warn("second")
+	logger.WithField("component", ComponentAdmin).Error("third")
+	logger.WithFields(log.Fields{"component": ComponentProxy, "key": "abc"}).Info("fourth")
+
+	// buffer keeps only 3 most recent entries
+	entries := m.Entries(log.DebugLevel, "", 0)
+	expect(t, len(entries), 3)
+	expect(t, entries[0].Message, "second")
+	expect(t, entries[2].Message, "fourth")
+	expect(t, entries[2].Fields["key"], "abc")
+
+	warnings := m.Entries(log.WarnLevel, "", 0)
+	expect(t, len(warnings), 2)
+
+	auth := m.Entries(log.DebugLevel, ComponentAuth, 0)
+	expect(t, len(auth), 1)
+	expect(t, auth[0].Level, "warning")
+
+	latest := m.Entries(log.DebugLevel, "", 1)
+	expect(t, len(latest), 1)
+	expect(t, latest[0].Message, "fourth")
+}
+
+func TestSetLogLevelsHandler(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	logger, _ := testLogger(log.InfoLevel)
+	dbClient.Logging.Install(logger)
+
+	m := getBoneRouter(*dbClient)
+
+	body := `{"level": "warning", "components": {"auth": "debug"}}`
+	req, err := http.NewRequest("POST", "/logging", ioutil.NopCloser(strings.NewReader(body)))
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+
+	expect(t, dbClient.Logging.Level(), log.WarnLevel)
+	levels := dbClient.Logging.ComponentLevels()
+	expect(t, levels[ComponentAuth], log.DebugLevel)
+	expect(t, levels[ComponentProxy], log.WarnLevel)
+
+	req, err = http.NewRequest("GET", "/logging", nil)
+	expect(t, err, nil)
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+
+	var response logLevelsRequest
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	expect(t, err, nil)
+	expect(t, response.Level, "warning")
+	expect(t, response.Components[ComponentAuth], "debug")
+}
+
+func TestLogManagerConcurrentLevelChanges(t *testing.T) {
+	logger, _ := testLogger(log.InfoLevel)
+
+	m := NewLogManager(DefaultLogBufferSize)
+	m.Install(logger)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			logger.WithField("component", ComponentProxy).Debug("proxy debug")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		m.SetLevel(log.DebugLevel)
+		m.SetLevel(log.InfoLevel)
+	}
+	<-done
+
+	expect(t, m.Level(), log.InfoLevel)
+}
+
+func TestSetLogLevelsHandlerBadRequest(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	m := getBoneRouter(*dbClient)
+
+	for _, body := range []string{`{"level": "loud"}`, `{"components": {"database": "debug"}}`} {
+		req, err := http.NewRequest("POST", "/logging", ioutil.NopCloser(strings.NewReader(body)))
+		expect(t, err, nil)
+
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, req)
+		expect(t, rec.Code, http.StatusBadRequest)
+	}
+
+	// nothing changed
+	expect(t, dbClient.Logging.Level(), log.InfoLevel)
+}
+
+func TestLogsHandler(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	logger, _ := testLogger(log.DebugLevel)
+	dbClient.Logging.Install(logger)
+
+	logger.WithField("component", ComponentProxy).Info("request served")
+	logger.WithField("component", ComponentMiddleware).Error("middleware failed")
+
+	m := getBoneRouter(*dbClient)
+
+	req, err := http.NewRequest("GET", "/logs?level=error", nil)
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+
+	var response logsResponse
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	expect(t, err, nil)
+	expect(t, len(response.Data), 1)
+	expect(t, response.Data[0].Message, "middleware failed")
+	expect(t, response.Data[0].Component, ComponentMiddleware)
+
+	req, err = http.NewRequest("GET", "/logs?limit=abc", nil)
+	expect(t, err, nil)
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusBadRequest)
+}
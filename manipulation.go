@@ -14,6 +14,13 @@ import (
 type Constructor struct {
 	request *http.Request
 	payload Payload
+	// events - optional, reports middleware failures
+	events eventFunc
+	// bodies - optional, storage of body files referenced by payload
+	bodies *BodyStore
+	// body - opened body file, streamed instead of payload body
+	body     responseBody
+	bodySize int64
 }
 
 // NewConstructor - returns constructor instance
@@ -26,14 +33,28 @@ func NewConstructor(req *http.Request, payload Payload) *Constructor {
 // full path.
 func (c *Constructor) ApplyMiddleware(middleware string) error {
 
+	span := spanFromRequest(c.request).StartChild("middleware", SpanKindInternal)
+	span.SetAttribute("hoverfly.middleware", middleware)
+
 	newPayload, err := ExecuteMiddleware(middleware, c.payload)
 
+	span.SetError(err)
+	span.Finish()
+
 	if err != nil {
 		log.WithFields(log.Fields{
 			"error":      err.Error(),
 			"middleware": middleware,
 		}).Error("Error during middleware transformation, not modifying payload!")
 
+		if c.events != nil {
+			c.events(ActionTypeMiddlewareFailed, "middleware failed", EventData{
+				Request:    c.payload.Request,
+				Middleware: middleware,
+				Error:      err.Error(),
+			})
+		}
+
 		return err
 	}
 
@@ -65,10 +86,24 @@ func (c *Constructor) ReconstructResponse() *http.Response {
 
 		}
 	}
+	if c.payload.Response.BodyFile != "" {
+		if err := c.openBody(); err != nil {
+			log.WithFields(log.Fields{
+				"error":    err.Error(),
+				"bodyFile": c.payload.Response.BodyFile,
+			}).Error("Failed to open body file, returning empty body")
+		}
+	}
+
 	// adding body, length, status code
-	buf := bytes.NewBufferString(c.payload.Response.Body)
-	response.ContentLength = int64(buf.Len())
-	response.Body = ioutil.NopCloser(buf)
+	if c.body != nil {
+		response.ContentLength = c.bodySize
+		response.Body = c.body
+	} else {
+		buf := bytes.NewBufferString(c.payload.Response.Body)
+		response.ContentLength = int64(buf.Len())
+		response.Body = ioutil.NopCloser(buf)
+	}
 	response.StatusCode = c.payload.Response.Status
 
 	return response
@@ -102,6 +137,10 @@ func (c *Constructor) ReconstructRequest() (*http.Request, error) {
 	newRequest.URL.RawQuery = c.payload.Request.Query
 	newRequest.RemoteAddr = c.payload.Request.RemoteAddr
 	newRequest.Header = c.payload.Request.Headers
+	// middleware can drop headers, request still needs them (i.e. for trace context)
+	if newRequest.Header == nil {
+		newRequest.Header = make(http.Header)
+	}
 
 	// overriding original request
 	c.request = newRequest
@@ -27,6 +27,22 @@ func TestReconstructRequest(t *testing.T) {
 	expect(t, newRequest.URL.RawQuery, "?foo=bar")
 }
 
+func TestReconstructRequestWithoutHeaders(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+
+	// middleware returned payload without headers
+	payload := Payload{Request: RequestDetails{Method: "GET", Destination: "example.com"}}
+
+	c := NewConstructor(req, payload)
+	newRequest, err := c.ReconstructRequest()
+	expect(t, err, nil)
+	expect(t, newRequest.Header == nil, false)
+
+	// headers can be added, e.g. trace context
+	newRequest.Header.Set(TraceParentHeader, "00-trace")
+	expect(t, newRequest.Header.Get(TraceParentHeader), "00-trace")
+}
+
 func TestReconstructRequestBodyPayload(t *testing.T) {
 	req, _ := http.NewRequest("GET", "http://example.com", nil)
 
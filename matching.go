@@ -0,0 +1,190 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sort"
+)
+
+// Matcher names, reported by match endpoint and in virtualize logs
+const (
+	// MatcherExact - request fingerprint matched stored payload
+	MatcherExact = "exact"
+	// MatcherHeadFallback - HEAD request was matched against stored GET payload
+	MatcherHeadFallback = "headFallback"
+	// MatcherAnySession - request with session was matched against payload recorded without session
+	MatcherAnySession = "anySession"
+)
+
+const (
+	// maxNearMisses - how many near miss candidates are returned by match explanation
+	maxNearMisses = 5
+	// maxNearMissDifferences - stored payloads differing in more fields aren't near misses
+	maxNearMissDifferences = 2
+)
+
+// lookupPayload - finds stored payload for given request details, returns key of the found payload
+// and name of the matcher that found it
+func (d *DBClient) lookupPayload(details RequestDetails) (key, matcher string, payloadBts []byte, err error) {
+	r := RequestContainer{Details: details}
+	key = r.Hash()
+
+	payloadBts, err = d.Cache.Get([]byte(key))
+	if err == nil {
+		return key, MatcherExact, payloadBts, nil
+	}
+
+	if details.Method == "HEAD" {
+		// HEAD requests can be answered from GET payloads
+		get := details
+		get.Method = "GET"
+		headRequest := RequestContainer{Details: get}
+		headKey := headRequest.Hash()
+
+		if bts, headErr := d.Cache.Get([]byte(headKey)); headErr == nil {
+			return headKey, MatcherHeadFallback, bts, nil
+		}
+	}
+
+	if details.Session != "" {
+		// payloads recorded without session are shared by all sessions
+		details.Session = ""
+		if anyKey, _, bts, anyErr := d.lookupPayload(details); anyErr == nil {
+			return anyKey, MatcherAnySession, bts, nil
+		}
+	}
+
+	return key, "", nil, err
+}
+
+// FieldDifference - describes single request field that differs from stored payload
+type FieldDifference struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// NearMiss - stored payload that almost matched given request
+type NearMiss struct {
+	Payload     Payload           `json:"payload"`
+	Differences []FieldDifference `json:"differences"`
+}
+
+// MatchExplanation - result of a dry-run match, describes which payload would be served and why
+type MatchExplanation struct {
+	Fingerprint string     `json:"fingerprint"`
+	Matched     bool       `json:"matched"`
+	Matcher     string     `json:"matcher,omitempty"`
+	Payload     *Payload   `json:"payload,omitempty"`
+	NearMisses  []NearMiss `json:"nearMisses"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// ExplainMatch - performs matching without sending request through the proxy, returns matched payload
+// (if any) and stored payloads that differ from given request in one or two fields, closest first
+func (d *DBClient) ExplainMatch(details RequestDetails) (MatchExplanation, error) {
+	r := RequestContainer{Details: details}
+	explanation := MatchExplanation{
+		Fingerprint: r.Hash(),
+		NearMisses:  []NearMiss{},
+	}
+
+	key, matcher, payloadBts, err := d.lookupPayload(details)
+	if err == nil {
+		payload, err := decodePayload(payloadBts)
+		if err != nil {
+			explanation.Error = err.Error()
+		} else {
+			explanation.Matched = true
+			explanation.Matcher = matcher
+			explanation.Payload = payload
+		}
+	}
+
+	keys, err := d.Cache.GetAllKeys()
+	if err != nil {
+		return explanation, err
+	}
+
+	// only request details are decoded when looking for candidates, whole payloads are decoded for
+	// the ones that are returned
+	type candidate struct {
+		key         string
+		differences []FieldDifference
+	}
+	var candidates []candidate
+	for k := range keys {
+		if explanation.Matched && k == key {
+			continue
+		}
+		bts, err := d.Cache.Get([]byte(k))
+		if err != nil {
+			continue
+		}
+		stored, err := decodeRequestDetails(bts)
+		if err != nil {
+			continue
+		}
+		differences := requestDifferences(stored, details)
+		if len(differences) == 0 || len(differences) > maxNearMissDifferences {
+			continue
+		}
+		candidates = append(candidates, candidate{key: k, differences: differences})
+	}
+
+	// keys come from a map, sorting by key as well keeps the order stable between calls
+	sort.Slice(candidates, func(i, j int) bool {
+		if len(candidates[i].differences) != len(candidates[j].differences) {
+			return len(candidates[i].differences) < len(candidates[j].differences)
+		}
+		return candidates[i].key < candidates[j].key
+	})
+
+	for _, c := range candidates {
+		if len(explanation.NearMisses) == maxNearMisses {
+			break
+		}
+		bts, err := d.Cache.Get([]byte(c.key))
+		if err != nil {
+			continue
+		}
+		pl, err := decodePayload(bts)
+		if err != nil {
+			continue
+		}
+		explanation.NearMisses = append(explanation.NearMisses, NearMiss{Payload: *pl, Differences: c.differences})
+	}
+
+	return explanation, nil
+}
+
+// decodeRequestDetails - decodes only request details of stored payload, response is skipped
+func decodeRequestDetails(data []byte) (RequestDetails, error) {
+	var p struct {
+		Request RequestDetails
+	}
+	err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&p)
+	return p.Request, err
+}
+
+// requestDifferences - compares fields used for request fingerprint
+func requestDifferences(stored, actual RequestDetails) (differences []FieldDifference) {
+	fields := []struct {
+		name             string
+		expected, actual string
+	}{
+		{"destination", stored.Destination, actual.Destination},
+		{"path", stored.Path, actual.Path},
+		{"method", stored.Method, actual.Method},
+		{"query", stored.Query, actual.Query},
+		{"body", stored.Body, actual.Body},
+		{"session", stored.Session, actual.Session},
+	}
+
+	for _, f := range fields {
+		if f.expected != f.actual {
+			differences = append(differences, FieldDifference{Field: f.name, Expected: f.expected, Actual: f.actual})
+		}
+	}
+	return
+}
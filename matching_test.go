@@ -0,0 +1,147 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getMatchingPayloads() []Payload {
+	return []Payload{
+		{
+			Request:  RequestDetails{Destination: "match.com", Path: "/users", Method: "GET", Query: "page=1"},
+			Response: ResponseDetails{Status: 200, Body: "page one"},
+		},
+		{
+			Request:  RequestDetails{Destination: "match.com", Path: "/users", Method: "GET", Query: "page=2"},
+			Response: ResponseDetails{Status: 200, Body: "page two"},
+		},
+		{
+			Request:  RequestDetails{Destination: "match.com", Path: "/orders", Method: "POST", Body: "order"},
+			Response: ResponseDetails{Status: 201, Body: "created"},
+		},
+	}
+}
+
+func TestExplainMatchExact(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	err := dbClient.ImportPayloads(getMatchingPayloads())
+	expect(t, err, nil)
+
+	details := RequestDetails{Destination: "match.com", Path: "/users", Method: "GET", Query: "page=1"}
+
+	explanation, err := dbClient.ExplainMatch(details)
+	expect(t, err, nil)
+
+	r := RequestContainer{Details: details}
+	expect(t, explanation.Fingerprint, r.Hash())
+	expect(t, explanation.Matched, true)
+	expect(t, explanation.Matcher, MatcherExact)
+	expect(t, explanation.Payload.Response.Body, "page one")
+
+	// candidate differs only in query, orders payload differs in too many fields
+	expect(t, len(explanation.NearMisses), 1)
+	expect(t, len(explanation.NearMisses[0].Differences), 1)
+	expect(t, explanation.NearMisses[0].Differences[0].Field, "query")
+	expect(t, explanation.NearMisses[0].Differences[0].Expected, "page=2")
+	expect(t, explanation.NearMisses[0].Differences[0].Actual, "page=1")
+}
+
+func TestExplainMatchHeadFallback(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	err := dbClient.ImportPayloads(getMatchingPayloads())
+	expect(t, err, nil)
+
+	explanation, err := dbClient.ExplainMatch(RequestDetails{Destination: "match.com", Path: "/users", Method: "HEAD", Query: "page=2"})
+	expect(t, err, nil)
+
+	expect(t, explanation.Matched, true)
+	expect(t, explanation.Matcher, MatcherHeadFallback)
+	expect(t, explanation.Payload.Response.Body, "page two")
+}
+
+func TestExplainMatchMiss(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	err := dbClient.ImportPayloads(getMatchingPayloads())
+	expect(t, err, nil)
+
+	explanation, err := dbClient.ExplainMatch(RequestDetails{Destination: "match.com", Path: "/orders", Method: "POST", Body: "other order"})
+	expect(t, err, nil)
+
+	expect(t, explanation.Matched, false)
+	expect(t, explanation.Matcher, "")
+	expect(t, len(explanation.NearMisses), 1)
+	expect(t, explanation.NearMisses[0].Payload.Response.Body, "created")
+	expect(t, explanation.NearMisses[0].Differences[0].Field, "body")
+}
+
+func TestExplainMatchRanksNearMisses(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	err := dbClient.ImportPayloads(getMatchingPayloads())
+	expect(t, err, nil)
+
+	explanation, err := dbClient.ExplainMatch(RequestDetails{Destination: "match.com", Path: "/users", Method: "GET", Query: "page=1", Body: "filter"})
+	expect(t, err, nil)
+
+	expect(t, explanation.Matched, false)
+	expect(t, len(explanation.NearMisses), 2)
+	expect(t, explanation.NearMisses[0].Payload.Response.Body, "page one")
+	expect(t, len(explanation.NearMisses[0].Differences), 1)
+	expect(t, explanation.NearMisses[1].Payload.Response.Body, "page two")
+	expect(t, len(explanation.NearMisses[1].Differences), 2)
+}
+
+func TestMatchHandler(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+	m := getBoneRouter(*dbClient)
+
+	err := dbClient.ImportPayloads(getMatchingPayloads())
+	expect(t, err, nil)
+
+	body := `{"destination": "match.com", "path": "/users", "method": "GET", "query": "page=2"}`
+
+	req, err := http.NewRequest("POST", "/match", ioutil.NopCloser(bytes.NewBufferString(body)))
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	expect(t, rec.Code, http.StatusOK)
+
+	var explanation MatchExplanation
+	err = json.Unmarshal(rec.Body.Bytes(), &explanation)
+	expect(t, err, nil)
+	expect(t, explanation.Matched, true)
+	expect(t, explanation.Payload.Response.Body, "page two")
+}
+
+func TestMatchHandlerBadBody(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	m := getBoneRouter(*dbClient)
+
+	req, err := http.NewRequest("POST", "/match", ioutil.NopCloser(bytes.NewBufferString("not json")))
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	expect(t, rec.Code, 422)
+}
@@ -4,14 +4,32 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/rcrowley/go-metrics"
 
+	"sync"
 	"time"
 )
 
+// Metric names for request latency and virtualize match results
+const (
+	MetricLatency   = "latency"
+	MetricMatchHit  = "match.hit"
+	MetricMatchMiss = "match.miss"
+)
+
+// latencyPercentiles - percentiles reported for timers
+var latencyPercentiles = []float64{0.5, 0.95, 0.99}
+
 // CounterByMode - container for mode counters, registry and flush interval
 type CounterByMode struct {
-	counterVirtualize, counterCapture, counterModify, counterSynthesize metrics.Counter
-	registry                                                            metrics.Registry
-	flushInterval                                                       time.Duration
+	counterVirtualize, counterCapture, counterModify, counterSynthesize, counterFuzz metrics.Counter
+	counterMatchHit, counterMatchMiss                                                metrics.Counter
+	latency                                                                          metrics.Timer
+	registry                                                                         metrics.Registry
+	flushInterval                                                                    time.Duration
+
+	// Windows - requests broken down by destination, path template and status class
+	Windows *WindowedStats
+
+	mu sync.RWMutex
 }
 
 // NewModeCounter - returns new counter instance
@@ -24,14 +42,23 @@ func NewModeCounter() *CounterByMode {
 		counterCapture:    metrics.NewCounter(),
 		counterModify:     metrics.NewCounter(),
 		counterSynthesize: metrics.NewCounter(),
+		counterFuzz:       metrics.NewCounter(),
+		counterMatchHit:   metrics.NewCounter(),
+		counterMatchMiss:  metrics.NewCounter(),
+		latency:           metrics.NewTimer(),
 		registry:          registry,
 		flushInterval:     5 * time.Second,
+		Windows:           NewWindowedStats(),
 	}
 
 	c.registry.GetOrRegister(VirtualizeMode, c.counterVirtualize)
 	c.registry.GetOrRegister(CaptureMode, c.counterCapture)
 	c.registry.GetOrRegister(ModifyMode, c.counterModify)
 	c.registry.GetOrRegister(SynthesizeMode, c.counterSynthesize)
+	c.registry.GetOrRegister(FuzzMode, c.counterFuzz)
+	c.registry.GetOrRegister(MetricMatchHit, c.counterMatchHit)
+	c.registry.GetOrRegister(MetricMatchMiss, c.counterMatchMiss)
+	c.registry.GetOrRegister(MetricLatency, c.latency)
 
 	log.Debug("new counter created, registration successful")
 
@@ -48,7 +75,40 @@ func (c *CounterByMode) Count(mode string) {
 		c.counterModify.Inc(1)
 	} else if mode == SynthesizeMode {
 		c.counterSynthesize.Inc(1)
+	} else if mode == FuzzMode {
+		c.counterFuzz.Inc(1)
+	}
+}
+
+// Observe - records request latency and match result (see MatchResultHit and MatchResultMiss)
+func (c *CounterByMode) Observe(latency time.Duration, match string) {
+	c.mu.RLock()
+	c.latency.Update(latency)
+	c.mu.RUnlock()
+
+	if match == MatchResultHit {
+		c.counterMatchHit.Inc(1)
+	} else if match == MatchResultMiss {
+		c.counterMatchMiss.Inc(1)
+	}
+}
+
+// Reset - sets all counters to zero and removes recorded latencies and windowed stats
+func (c *CounterByMode) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, counter := range []metrics.Counter{c.counterVirtualize, c.counterCapture, c.counterModify,
+		c.counterSynthesize, c.counterFuzz, c.counterMatchHit, c.counterMatchMiss} {
+		counter.Clear()
 	}
+
+	// timers can't be cleared, replacing it with a new one
+	c.registry.Unregister(MetricLatency)
+	c.latency = metrics.NewTimer()
+	c.registry.GetOrRegister(MetricLatency, c.latency)
+
+	c.Windows.Reset()
 }
 
 // Init initializes logging
@@ -63,17 +123,46 @@ func (c *CounterByMode) Init() {
 
 // Stats - holds information about various system metrics like requests counts
 type Stats struct {
-	Counters    map[string]int64   `json:"counters"`
-	Gauges      map[string]int64   `json:"gauges,omitempty"`
-	GaugesFloat map[string]float64 `json:"gaugesFloat,omitempty"`
+	Counters    map[string]int64      `json:"counters"`
+	Gauges      map[string]int64      `json:"gauges,omitempty"`
+	GaugesFloat map[string]float64    `json:"gaugesFloat,omitempty"`
+	Timers      map[string]TimerStats `json:"timers,omitempty"`
+}
+
+// TimerStats - timer snapshot, durations are in milliseconds
+type TimerStats struct {
+	Count int64   `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+}
+
+func newTimerStats(t metrics.Timer) TimerStats {
+	ms := float64(time.Millisecond)
+	p := t.Percentiles(latencyPercentiles)
+	return TimerStats{
+		Count: t.Count(),
+		Min:   float64(t.Min()) / ms,
+		Max:   float64(t.Max()) / ms,
+		Mean:  t.Mean() / ms,
+		P50:   p[0] / ms,
+		P95:   p[1] / ms,
+		P99:   p[2] / ms,
+	}
 }
 
 // Flush gets current metrics from stats registry
 func (c *CounterByMode) Flush() (h Stats) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
 	counters := make(map[string]int64)
 	gauges := make(map[string]int64)
 	gaugesFloat := make(map[string]float64)
+	timers := make(map[string]TimerStats)
 
 	c.registry.Each(func(name string, i interface{}) {
 		switch metric := i.(type) {
@@ -83,11 +172,14 @@ func (c *CounterByMode) Flush() (h Stats) {
 			gauges[name] = metric.Value()
 		case metrics.GaugeFloat64:
 			gaugesFloat[name] = metric.Value()
+		case metrics.Timer:
+			timers[name] = newTimerStats(metric)
 		}
 	})
 
 	h.Counters = counters
 	h.Gauges = gauges
 	h.GaugesFloat = gaugesFloat
+	h.Timers = timers
 	return
 }
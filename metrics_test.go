@@ -2,6 +2,7 @@ package hoverfly
 
 import (
 	"testing"
+	"time"
 )
 
 func TestVirtualizeInc(t *testing.T) {
@@ -45,3 +46,22 @@ func TestFlush(t *testing.T) {
 
 	expect(t, int(fl.Counters[VirtualizeMode]), 1)
 }
+
+func TestObserve(t *testing.T) {
+	counter := NewModeCounter()
+
+	counter.Observe(10*time.Millisecond, MatchResultHit)
+	counter.Observe(30*time.Millisecond, MatchResultMiss)
+	counter.Observe(20*time.Millisecond, "")
+
+	fl := counter.Flush()
+
+	expect(t, int(fl.Counters[MetricMatchHit]), 1)
+	expect(t, int(fl.Counters[MetricMatchMiss]), 1)
+
+	latency := fl.Timers[MetricLatency]
+	expect(t, latency.Count, int64(3))
+	expect(t, latency.Min, float64(10))
+	expect(t, latency.Max, float64(30))
+	expect(t, latency.P50, float64(20))
+}
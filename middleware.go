@@ -52,12 +52,11 @@ func Pipeline(cmds ...*exec.Cmd) (pipeLineOutput, collectedStandardError []byte,
 	return output.Bytes(), stderr.Bytes(), nil
 }
 
-// ExecuteMiddleware - takes command (middleware string) and payload, which is passed to middleware
+// ExecuteMiddleware - takes command (middleware string) and payload, which is passed to middleware. Commands
+// pointing to ".wasm" files run WASM middleware modules instead of executables.
 func ExecuteMiddleware(command string, payload Payload) (Payload, error) {
 	commands := strings.Split(command, " ")
 
-	cmds := exec.Command(commands[0], commands[1:]...)
-
 	// getting payload
 	bts, err := json.Marshal(payload)
 
@@ -75,10 +74,17 @@ func ExecuteMiddleware(command string, payload Payload) (Payload, error) {
 		}).Error("Failed to marshal json")
 		return payload, err
 	}
-	cmds.Stdin = bytes.NewReader(bts)
 
-	// Run the pipeline
-	mwOutput, stderr, err := Pipeline(cmds)
+	var mwOutput, stderr []byte
+	if IsWASMMiddleware(command) {
+		mwOutput, stderr, err = wasmMiddlewares.execute(commands[0], bts)
+	} else {
+		cmds := exec.Command(commands[0], commands[1:]...)
+		cmds.Stdin = bytes.NewReader(bts)
+
+		// Run the pipeline
+		mwOutput, stderr, err = Pipeline(cmds)
+	}
 
 	// middleware failed to execute
 	if err != nil {
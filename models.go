@@ -16,12 +16,32 @@ import (
 
 // DBClient provides access to cache, http client and configuration
 type DBClient struct {
-	Cache   Cache
-	HTTP    *http.Client
-	Cfg     *Configuration
-	Counter *CounterByMode
-	Hooks   ActionTypeHooks
-	AB      backends.AuthBackend
+	Cache     Cache
+	HTTP      *http.Client
+	Cfg       *Configuration
+	Counter   *CounterByMode
+	Hooks     ActionTypeHooks
+	HookQueue *HookQueue
+	AB        backends.AuthBackend
+	Notifier  *RequestNotifier
+	Journal   *Journal
+	Tracer    *Tracer
+	AccessLog *AccessLogger
+	Logging   *LogManager
+	Fuzzer    *Fuzzer
+	Faker     *Faker
+	Bodies    *BodyStore
+	Sessions  *SessionStore
+	Callbacks *CallbackScheduler
+
+	// replication
+	Replication  *ReplicationLog
+	Subscription *ReplicaSubscription
+	Replicas     []*ReplicaPusher
+	Registry     *RegistryClient
+
+	// inBatch - set on the copy used to execute batch operations, which already hold batchMu
+	inBatch bool
 }
 
 // AddHook - adds a hook to DBClient
@@ -46,6 +66,8 @@ type RequestDetails struct {
 	Body        string              `json:"body"`
 	RemoteAddr  string              `json:"remoteAddr"`
 	Headers     map[string][]string `json:"headers"`
+	// Session - session identity of the request, payloads with session are only matched by the same session
+	Session string `json:"session,omitempty"`
 }
 
 func (r *RequestContainer) concatenate() string {
@@ -56,6 +78,10 @@ func (r *RequestContainer) concatenate() string {
 	buffer.WriteString(r.Details.Method)
 	buffer.WriteString(r.Details.Query)
 	buffer.WriteString(r.Details.Body)
+	// requests without session keep their fingerprint
+	if r.Details.Session != "" {
+		buffer.WriteString(r.Details.Session)
+	}
 
 	return buffer.String()
 }
@@ -74,13 +100,17 @@ type ResponseDetails struct {
 	Status  int                 `json:"status"`
 	Body    string              `json:"body"`
 	Headers map[string][]string `json:"headers"`
+	// BodyFile - reference to body stored outside of payload (see BodyStore), Body is ignored when it's set unless
+	// middleware or fuzzing read the file into Body
+	BodyFile string `json:"bodyFile,omitempty"`
 }
 
 // Payload structure holds request and response structure
 type Payload struct {
-	Response ResponseDetails `json:"response"`
-	Request  RequestDetails  `json:"request"`
-	ID       string          `json:"id"`
+	Response  ResponseDetails `json:"response"`
+	Request   RequestDetails  `json:"request"`
+	ID        string          `json:"id"`
+	Callbacks []Callback      `json:"callbacks,omitempty"`
 }
 
 // Encode method encodes all exported Payload fields to bytes
@@ -241,6 +271,9 @@ func (d *DBClient) doRequest(request *http.Request) (*http.Response, error) {
 	// We can't have this set. And it only contains "/pkg/net/http/" anyway
 	request.RequestURI = ""
 
+	// middleware can replace the request, keeping span of the original one
+	parentSpan := spanFromRequest(request)
+
 	if d.Cfg.Middleware != "" {
 		// middleware is provided, modifying request
 		var payload Payload
@@ -251,7 +284,7 @@ func (d *DBClient) doRequest(request *http.Request) (*http.Response, error) {
 		}
 		payload.Request = rd
 
-		c := NewConstructor(request, payload)
+		c := d.newConstructor(request, payload)
 		err = c.ApplyMiddleware(d.Cfg.Middleware)
 
 		if err != nil {
@@ -271,9 +304,22 @@ func (d *DBClient) doRequest(request *http.Request) (*http.Response, error) {
 		}
 	}
 
+	upstreamSpan := parentSpan.StartChild(fmt.Sprintf("upstream %s %s", request.Method, request.Host), SpanKindClient)
+	if upstreamSpan != nil {
+		upstreamSpan.SetAttribute("http.method", request.Method)
+		upstreamSpan.SetAttribute("http.host", request.Host)
+		upstreamSpan.SetAttribute("http.target", request.URL.RequestURI())
+		// captured payloads are built from the caller's request, so trace context only goes on the outgoing copy
+		request = request.Clone(request.Context())
+		request.Header.Set(TraceParentHeader, upstreamSpan.TraceParent())
+	}
+
 	resp, err := d.HTTP.Do(request)
 
 	if err != nil {
+		upstreamSpan.SetError(err)
+		upstreamSpan.Finish()
+
 		log.WithFields(log.Fields{
 			"mode":   d.Cfg.Mode,
 			"error":  err.Error(),
@@ -284,6 +330,9 @@ func (d *DBClient) doRequest(request *http.Request) (*http.Response, error) {
 		return nil, err
 	}
 
+	upstreamSpan.SetAttribute("http.status_code", resp.StatusCode)
+	upstreamSpan.Finish()
+
 	log.WithFields(log.Fields{
 		"mode":   d.Cfg.Mode,
 		"host":   request.Host,
@@ -328,6 +377,7 @@ func (d *DBClient) save(req *http.Request, reqBody []byte, resp *http.Response,
 			Body:        string(reqBody),
 			RemoteAddr:  req.RemoteAddr,
 			Headers:     req.Header,
+			Session:     d.Sessions.identity(req.Header),
 		}
 
 		payload := Payload{
@@ -336,30 +386,55 @@ func (d *DBClient) save(req *http.Request, reqBody []byte, resp *http.Response,
 			ID:       key,
 		}
 
-		bts, err := payload.Encode()
-
-		// hook
-		var en Entry
-		en.ActionType = ActionTypeRequestCaptured
-		en.Message = "captured"
-		en.Time = time.Now()
-		en.Data = bts
-
-		if err := d.Hooks.Fire(ActionTypeRequestCaptured, &en); err != nil {
+		payload, err := d.beforePayloadHooks(ActionTypeBeforeCapture, "capture", payload)
+		if err != nil {
 			log.WithFields(log.Fields{
-				"error":      err.Error(),
-				"message":    en.Message,
-				"actionType": ActionTypeRequestCaptured,
-			}).Error("failed to fire hook")
+				"error":       err.Error(),
+				"destination": req.Host,
+				"path":        req.URL.Path,
+			}).Warn("Captured payload not saved")
+			return
+		}
+
+		// hooks could have changed the request
+		r := RequestContainer{Details: payload.Request}
+		key = r.Hash()
+		payload.ID = key
+
+		// large bodies are kept outside of payload, blob is stored together with payload
+		var blob []byte
+		if threshold := d.Cfg.BodyBlobThreshold; threshold > 0 && len(payload.Response.Body) > threshold && d.Bodies != nil && d.Bodies.DB != nil {
+			blob = []byte(payload.Response.Body)
+			payload.Response.BodyFile = blobRef(blob)
+			payload.Response.Body = ""
 		}
 
+		bts, err := payload.Encode()
+
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error": err.Error(),
 			}).Error("Failed to serialize payload")
-		} else {
-			d.Cache.Set([]byte(key), bts)
+			return
+		}
+		if err := d.storePayload(key, bts, payload.Response.BodyFile, blob); err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+				"key":   key,
+			}).Error("Failed to store payload")
+			return
 		}
+
+		// hook, fired after payload is stored so hooks can read it back
+		var en Entry
+		en.ActionType = ActionTypeRequestCaptured
+		en.Message = "captured"
+		en.Time = time.Now()
+		en.Data = bts
+		en.Destination = req.Host
+		en.Mode = d.Cfg.GetMode()
+
+		d.fireHooks(&en)
 	}
 }
 
@@ -392,9 +467,32 @@ func (d *DBClient) getResponse(req *http.Request) *http.Response {
 		}).Error("Got error when reading request body")
 	}
 
-	key := getRequestFingerprint(req, reqBody)
+	details := RequestDetails{
+		Path:        req.URL.Path,
+		Method:      req.Method,
+		Destination: req.Host,
+		Scheme:      req.URL.Scheme,
+		Query:       req.URL.RawQuery,
+		Body:        string(reqBody),
+		RemoteAddr:  req.RemoteAddr,
+		Headers:     req.Header,
+	}
+
+	if response := d.serveStatic(req, details, false); response != nil {
+		return response
+	}
 
-	payloadBts, err := d.Cache.Get([]byte(key))
+	// client cookies are matched with recorded ones
+	session, headers := d.Sessions.resolve(details.Headers)
+	details.Headers = headers
+	details.Session = d.Sessions.identity(headers)
+
+	lookupSpan := spanFromRequest(req).StartChild("cache lookup", SpanKindInternal)
+	key, matcher, payloadBts, err := d.lookupPayload(details)
+	lookupSpan.SetAttribute("hoverfly.key", key)
+	lookupSpan.SetAttribute("hoverfly.matched", err == nil)
+	lookupSpan.SetAttribute("hoverfly.matcher", matcher)
+	lookupSpan.Finish()
 
 	if err == nil {
 		// getting cache response
@@ -405,33 +503,81 @@ func (d *DBClient) getResponse(req *http.Request) *http.Response {
 				"value": string(payloadBts),
 				"key":   key,
 			}).Error("Failed to decode payload")
-			return hoverflyError(req, err, "Failed to virtualize", http.StatusInternalServerError)
+			return d.errorResponse(req, err, "Failed to virtualize", ErrorKindVirtualize, key)
 		}
 
-		c := NewConstructor(req, *payload)
+		c := d.newConstructor(req, *payload)
+		mode := d.Cfg.GetMode()
+
+		// middleware and fuzzing work with the body, so body file is read into payload
+		if d.Cfg.Middleware != "" || (mode == FuzzMode && d.Fuzzer != nil) {
+			if err := c.loadBody(); err != nil {
+				log.WithFields(log.Fields{
+					"error":    err.Error(),
+					"bodyFile": c.payload.Response.BodyFile,
+					"key":      key,
+				}).Error("Failed to read body file")
+				return d.errorResponse(req, err, "Failed to virtualize", ErrorKindVirtualize, key)
+			}
+		}
 
 		if d.Cfg.Middleware != "" {
 			_ = c.ApplyMiddleware(d.Cfg.Middleware)
 		}
 
+		if mode == FuzzMode && d.Fuzzer != nil {
+			c.ApplyFuzzing(d.Fuzzer, key)
+		} else {
+			mode = VirtualizeMode
+		}
+
+		if err := c.openBody(); err != nil {
+			log.WithFields(log.Fields{
+				"error":    err.Error(),
+				"bodyFile": c.payload.Response.BodyFile,
+				"key":      key,
+			}).Error("Failed to open body file")
+			return d.errorResponse(req, err, "Failed to virtualize", ErrorKindVirtualize, key)
+		}
+
+		c.ApplyHTTPSemantics()
+
 		response := c.ReconstructResponse()
+		d.Sessions.issue(session, response.Header)
 
 		log.WithFields(log.Fields{
 			"key":         key,
-			"mode":        "virtualize",
+			"matcher":     matcher,
+			"mode":        mode,
 			"middleware":  d.Cfg.Middleware,
 			"path":        req.URL.Path,
 			"rawQuery":    req.URL.RawQuery,
 			"method":      req.Method,
 			"destination": req.Host,
-			"status":      payload.Response.Status,
+			"status":      response.StatusCode,
 			"bodyLength":  response.ContentLength,
 		}).Info("Response found, returning")
 
+		if len(c.payload.Callbacks) > 0 {
+			d.scheduleCallbacks(key, details, c.payload)
+		}
+
+		d.fireEvent(ActionTypeRequestServed, "virtualize", EventData{
+			Request:    details,
+			Response:   &c.payload.Response,
+			Key:        key,
+			Matcher:    matcher,
+			Middleware: d.Cfg.Middleware,
+		})
+
 		return response
 
 	}
 
+	if response := d.serveStatic(req, details, true); response != nil {
+		return response
+	}
+
 	log.WithFields(log.Fields{
 		"key":         key,
 		"error":       err.Error(),
@@ -440,8 +586,14 @@ func (d *DBClient) getResponse(req *http.Request) *http.Response {
 		"destination": req.Host,
 		"method":      req.Method,
 	}).Warn("Failed to retrieve response from cache")
+
+	d.fireEvent(ActionTypeRequestMissed, "virtualize", EventData{
+		Request: details,
+		Key:     key,
+		Error:   err.Error(),
+	})
 	// return error? if we return nil - proxy forwards request to original destination
-	return hoverflyError(req, err, "Could not find recorded request, please record it first!", http.StatusPreconditionFailed)
+	return d.errorResponse(req, err, "Could not find recorded request, please record it first!", ErrorKindMiss, key)
 }
 
 // modifyRequestResponse modifies outgoing request and then modifies incoming response, neither request nor response
@@ -455,6 +607,7 @@ func (d *DBClient) modifyRequestResponse(req *http.Request, middleware string) (
 			"error":      err.Error(),
 			"middleware": middleware,
 		}).Error("Failed to get request details")
+		d.fireEvent(ActionTypeModifyFailed, "modify", EventData{Middleware: middleware, Error: err.Error()})
 		return nil, err
 	}
 
@@ -462,6 +615,7 @@ func (d *DBClient) modifyRequestResponse(req *http.Request, middleware string) (
 	resp, err := d.doRequest(req)
 
 	if err != nil {
+		d.fireEvent(ActionTypeModifyFailed, "modify", EventData{Request: rd, Middleware: middleware, Error: err.Error()})
 		return nil, err
 	}
 
@@ -473,6 +627,7 @@ func (d *DBClient) modifyRequestResponse(req *http.Request, middleware string) (
 			"error":      err.Error(),
 			"middleware": middleware,
 		}).Error("Failed to read response body after sending modified request")
+		d.fireEvent(ActionTypeModifyFailed, "modify", EventData{Request: rd, Middleware: middleware, Error: err.Error()})
 		return nil, err
 	}
 
@@ -484,11 +639,12 @@ func (d *DBClient) modifyRequestResponse(req *http.Request, middleware string) (
 
 	payload := Payload{Response: r, Request: rd}
 
-	c := NewConstructor(req, payload)
+	c := d.newConstructor(req, payload)
 	// applying middleware to modify response
 	err = c.ApplyMiddleware(middleware)
 
 	if err != nil {
+		d.fireEvent(ActionTypeModifyFailed, "modify", EventData{Request: rd, Middleware: middleware, Error: err.Error()})
 		return nil, err
 	}
 
@@ -509,6 +665,12 @@ func (d *DBClient) modifyRequestResponse(req *http.Request, middleware string) (
 		"originalDestination": req.Host,
 	}).Info("request and response modified, returning")
 
+	d.fireEvent(ActionTypeRequestModified, "modify", EventData{
+		Request:    c.payload.Request,
+		Response:   &c.payload.Response,
+		Middleware: middleware,
+	})
+
 	return newResponse, nil
 
 }
@@ -525,6 +687,19 @@ const ActionTypeWipeDB = "wipeDatabase"
 // ActionTypeConfigurationChanged - default action name for identifying configuration changes
 const ActionTypeConfigurationChanged = "configurationChanged"
 
+// "before" action types are fired synchronously before the action is performed. Hooks can modify entry data
+// or return an error (see Veto) to reject the action.
+const (
+	// ActionTypeBeforeCapture - fired before captured payload is saved, data contains encoded payload
+	ActionTypeBeforeCapture = "beforeCapture"
+	// ActionTypeBeforeImport - fired before imported payload is saved, data contains encoded payload
+	ActionTypeBeforeImport = "beforeImport"
+	// ActionTypeBeforeWipeDB - fired before database is wiped
+	ActionTypeBeforeWipeDB = "beforeWipeDatabase"
+	// ActionTypeBeforeConfigurationChange - fired before mode is changed, data contains new mode
+	ActionTypeBeforeConfigurationChange = "beforeConfigurationChange"
+)
+
 // Entry - holds information about action, based on action type - other clients will be able to decode
 // the data field.
 type Entry struct {
@@ -538,6 +713,10 @@ type Entry struct {
 
 	// Message, can carry additional information
 	Message string
+
+	// Destination and Mode of the request that caused the action (if any), used by hook filters
+	Destination string
+	Mode        string
 }
 
 // Hook - an interface to add dynamic hooks to extend functionality
@@ -0,0 +1,178 @@
+package hoverfly
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// DefaultWaitTimeout - how long wait endpoint blocks when timeout is not supplied
+const DefaultWaitTimeout = 30 * time.Second
+
+// MaxWaitTimeout - upper limit for wait endpoint timeout
+const MaxWaitTimeout = 5 * time.Minute
+
+// notifierHistorySize - how many recent requests are kept so waiting clients don't miss requests that
+// arrived just before they started waiting
+const notifierHistorySize = 100
+
+// ErrWaitTimeout - returned when no matching request arrived before timeout
+var ErrWaitTimeout = fmt.Errorf("timed out waiting for request")
+
+// RequestMatcher - describes requests that client is waiting for, each field is a regular expression,
+// empty fields match everything
+type RequestMatcher struct {
+	Destination string `json:"destination"`
+	Path        string `json:"path"`
+	Method      string `json:"method"`
+	Query       string `json:"query"`
+	Body        string `json:"body"`
+}
+
+type fieldMatcher struct {
+	re    *regexp.Regexp
+	field func(RequestDetails) string
+}
+
+type compiledMatcher []fieldMatcher
+
+// compile - validates and compiles matcher expressions
+func (m RequestMatcher) compile() (compiledMatcher, error) {
+	var cm compiledMatcher
+
+	fields := []struct {
+		name, expr string
+		field      func(RequestDetails) string
+	}{
+		{"destination", m.Destination, func(r RequestDetails) string { return r.Destination }},
+		{"path", m.Path, func(r RequestDetails) string { return r.Path }},
+		{"method", m.Method, func(r RequestDetails) string { return r.Method }},
+		{"query", m.Query, func(r RequestDetails) string { return r.Query }},
+		{"body", m.Body, func(r RequestDetails) string { return r.Body }},
+	}
+
+	for _, f := range fields {
+		if f.expr == "" {
+			continue
+		}
+		re, err := regexp.Compile(f.expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s expression '%s': %s", f.name, f.expr, err.Error())
+		}
+		cm = append(cm, fieldMatcher{re: re, field: f.field})
+	}
+	return cm, nil
+}
+
+func (cm compiledMatcher) matches(r RequestDetails) bool {
+	for _, m := range cm {
+		if !m.re.MatchString(m.field(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// ObservedRequest - request that went through the proxy
+type ObservedRequest struct {
+	Request RequestDetails `json:"request"`
+	Mode    string         `json:"mode"`
+	Time    time.Time      `json:"time"`
+}
+
+type requestWaiter struct {
+	matcher compiledMatcher
+	ch      chan ObservedRequest
+}
+
+// RequestNotifier - lets clients block until a request matching their matcher goes through the proxy
+type RequestNotifier struct {
+	mu      sync.Mutex
+	waiters map[*requestWaiter]bool
+	history []ObservedRequest
+}
+
+// NewRequestNotifier - returns new notifier instance
+func NewRequestNotifier() *RequestNotifier {
+	return &RequestNotifier{
+		waiters: make(map[*requestWaiter]bool),
+	}
+}
+
+// Notify - passes observed request to all waiting clients with matching matchers
+func (n *RequestNotifier) Notify(observed ObservedRequest) {
+	// request headers are modified later while proxying, history and waiters get their own copy
+	observed.Request.Headers = copyHeaders(observed.Request.Headers)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.history = append(n.history, observed)
+	if len(n.history) > notifierHistorySize {
+		n.history = n.history[len(n.history)-notifierHistorySize:]
+	}
+
+	for w := range n.waiters {
+		if w.matcher.matches(observed.Request) {
+			// channel is buffered and waiter is removed after the first match
+			w.ch <- observed
+			delete(n.waiters, w)
+		}
+	}
+}
+
+// Wait - blocks until request matching given matcher goes through the proxy, timeout elapses or context is
+// done. When since is not zero, recent requests observed after that time are checked first.
+func (n *RequestNotifier) Wait(ctx context.Context, matcher RequestMatcher, since time.Time, timeout time.Duration) (ObservedRequest, error) {
+	cm, err := matcher.compile()
+	if err != nil {
+		return ObservedRequest{}, err
+	}
+
+	w := &requestWaiter{matcher: cm, ch: make(chan ObservedRequest, 1)}
+
+	n.mu.Lock()
+	if !since.IsZero() {
+		for _, observed := range n.history {
+			if observed.Time.After(since) && cm.matches(observed.Request) {
+				n.mu.Unlock()
+				return observed, nil
+			}
+		}
+	}
+	n.waiters[w] = true
+	n.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case observed := <-w.ch:
+		return observed, nil
+	case <-timer.C:
+		err = ErrWaitTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	n.mu.Lock()
+	delete(n.waiters, w)
+	n.mu.Unlock()
+
+	// request might have arrived while we were giving up
+	select {
+	case observed := <-w.ch:
+		return observed, nil
+	default:
+	}
+	return ObservedRequest{}, err
+}
+
+// Waiting - returns number of currently waiting clients
+func (n *RequestNotifier) Waiting() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.waiters)
+}
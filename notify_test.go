@@ -0,0 +1,137 @@
+package hoverfly
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifierWaitMatchingRequest(t *testing.T) {
+	n := NewRequestNotifier()
+
+	go func() {
+		for n.Waiting() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		n.Notify(ObservedRequest{Request: RequestDetails{Destination: "other.com", Path: "/callback"}, Time: time.Now()})
+		n.Notify(ObservedRequest{Request: RequestDetails{Destination: "payments.com", Path: "/callback"}, Time: time.Now()})
+	}()
+
+	observed, err := n.Wait(context.Background(), RequestMatcher{Destination: "payments", Path: "^/callback$"}, time.Time{}, time.Second)
+	expect(t, err, nil)
+	expect(t, observed.Request.Destination, "payments.com")
+	expect(t, n.Waiting(), 0)
+}
+
+func TestNotifierWaitTimeout(t *testing.T) {
+	n := NewRequestNotifier()
+
+	_, err := n.Wait(context.Background(), RequestMatcher{Path: "/never"}, time.Time{}, 10*time.Millisecond)
+	expect(t, err, ErrWaitTimeout)
+	expect(t, n.Waiting(), 0)
+}
+
+func TestNotifierWaitSince(t *testing.T) {
+	n := NewRequestNotifier()
+
+	since := time.Now().Add(-time.Minute)
+	n.Notify(ObservedRequest{Request: RequestDetails{Path: "/already-here"}, Time: time.Now()})
+
+	observed, err := n.Wait(context.Background(), RequestMatcher{Path: "/already-here"}, since, 10*time.Millisecond)
+	expect(t, err, nil)
+	expect(t, observed.Request.Path, "/already-here")
+
+	// without since only new requests are considered
+	_, err = n.Wait(context.Background(), RequestMatcher{Path: "/already-here"}, time.Time{}, 10*time.Millisecond)
+	expect(t, err, ErrWaitTimeout)
+}
+
+func TestNotifierInvalidMatcher(t *testing.T) {
+	n := NewRequestNotifier()
+
+	_, err := n.Wait(context.Background(), RequestMatcher{Path: "("}, time.Time{}, time.Second)
+	refute(t, err, nil)
+	refute(t, err, ErrWaitTimeout)
+}
+
+func TestNotifierWaitCancelled(t *testing.T) {
+	n := NewRequestNotifier()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for n.Waiting() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	_, err := n.Wait(ctx, RequestMatcher{Path: "/never"}, time.Time{}, time.Minute)
+	expect(t, err, context.Canceled)
+	expect(t, n.Waiting(), 0)
+}
+
+func TestNotifierCopiesHeaders(t *testing.T) {
+	n := NewRequestNotifier()
+
+	headers := http.Header{"Accept": []string{"application/json"}}
+	n.Notify(ObservedRequest{Request: RequestDetails{Path: "/headers", Headers: headers}, Time: time.Now()})
+	headers.Set("Traceparent", "00-abc")
+
+	observed, err := n.Wait(context.Background(), RequestMatcher{Path: "/headers"}, time.Now().Add(-time.Minute), time.Second)
+	expect(t, err, nil)
+	_, ok := observed.Request.Headers["Traceparent"]
+	expect(t, ok, false)
+	expect(t, observed.Request.Headers["Accept"][0], "application/json")
+}
+
+func TestWaitForRequestHandler(t *testing.T) {
+	server, dbClient := testTools(201, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+	m := getBoneRouter(*dbClient)
+
+	dbClient.Cfg.SetMode("capture")
+
+	go func() {
+		for dbClient.Notifier.Waiting() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		r, _ := http.NewRequest("GET", "http://dependency.com/orders?id=1", nil)
+		dbClient.processRequest(r)
+	}()
+
+	body := `{"matcher": {"destination": "dependency.com", "path": "/orders"}, "timeout": 2000}`
+	req, err := http.NewRequest("POST", "/wait", ioutil.NopCloser(bytes.NewBufferString(body)))
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	expect(t, rec.Code, http.StatusOK)
+
+	var observed ObservedRequest
+	err = json.Unmarshal(rec.Body.Bytes(), &observed)
+	expect(t, err, nil)
+	expect(t, observed.Request.Query, "id=1")
+	expect(t, observed.Mode, CaptureMode)
+}
+
+func TestWaitForRequestHandlerTimeout(t *testing.T) {
+	server, dbClient := testTools(201, `{'message': 'here'}`)
+	defer server.Close()
+	m := getBoneRouter(*dbClient)
+
+	body := `{"matcher": {"path": "/never"}, "timeout": 10}`
+	req, err := http.NewRequest("POST", "/wait", ioutil.NopCloser(bytes.NewBufferString(body)))
+	expect(t, err, nil)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+
+	expect(t, rec.Code, http.StatusRequestTimeout)
+}
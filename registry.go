@@ -0,0 +1,681 @@
+package hoverfly
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Simulation registry defaults
+const (
+	DefaultRegistryPort = "8600"
+	// LatestVersion - resolves to the most recently published version of simulation
+	LatestVersion = "latest"
+
+	// RegistryDigestHeader - digest of bundle, sent when publishing and fetching bundles
+	RegistryDigestHeader = "X-Simulation-Digest"
+)
+
+var (
+	rxSimulationName    = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*$`)
+	rxSimulationVersion = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]{0,127}$`)
+	rxBundleDigest      = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// SimulationRef - name and version of simulation published to registry, e.g. "payments:1.2.0"
+type SimulationRef struct {
+	Name    string
+	Version string
+}
+
+// ParseSimulationRef - parses "name:version" reference, version defaults to "latest"
+func ParseSimulationRef(s string) (SimulationRef, error) {
+	ref := SimulationRef{Name: s, Version: LatestVersion}
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		ref.Name, ref.Version = s[:i], s[i+1:]
+	}
+	if !rxSimulationName.MatchString(ref.Name) {
+		return ref, fmt.Errorf("invalid simulation name '%s', lowercase letters, digits and separators (.-_) are allowed", ref.Name)
+	}
+	if !rxSimulationVersion.MatchString(ref.Version) {
+		return ref, fmt.Errorf("invalid simulation version '%s'", ref.Version)
+	}
+	return ref, nil
+}
+
+func (r SimulationRef) String() string {
+	return r.Name + ":" + r.Version
+}
+
+// SimulationManifest - published version of simulation, bundle is stored as a blob addressed by its digest
+type SimulationManifest struct {
+	Name    string    `json:"name"`
+	Version string    `json:"version"`
+	Digest  string    `json:"digest"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+type simulationVersions struct {
+	Name string               `json:"name"`
+	Data []SimulationManifest `json:"data"`
+}
+
+type simulationNames struct {
+	Data []string `json:"data"`
+}
+
+// bundleDigest - returns digest bundles are addressed by
+func bundleDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// RegistryServer - simulation registry storing bundles and manifests in a directory. It serves:
+//
+//	GET /simulations                       names of published simulations
+//	GET /simulations/{name}                published versions of simulation
+//	GET /simulations/{name}/{version}      manifest of version ("latest" is the most recent one)
+//	PUT /simulations/{name}/{version}      publishes bundle, versions can't be overwritten
+//	GET /blobs/{digest}                    bundle
+type RegistryServer struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// NewRegistryServer - returns registry storing simulations in given directory
+func NewRegistryServer(dir string) *RegistryServer {
+	return &RegistryServer{Dir: dir}
+}
+
+func (s *RegistryServer) manifestPath(name, version string) string {
+	return filepath.Join(s.Dir, "simulations", name, version+".json")
+}
+
+func (s *RegistryServer) blobPath(digest string) string {
+	return filepath.Join(s.Dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+}
+
+func (s *RegistryServer) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	b, _ := json.Marshal(v)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (s *RegistryServer) writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	s.writeJSON(w, status, messageResponse{Message: fmt.Sprintf(format, args...)})
+}
+
+// versions - returns manifests of simulation ordered by publishing time
+func (s *RegistryServer) versions(name string) ([]SimulationManifest, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.Dir, "simulations", name))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []SimulationManifest
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".json" {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.Dir, "simulations", name, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var m SimulationManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, m)
+	}
+	sort.Sort(manifestsByCreated(manifests))
+	return manifests, nil
+}
+
+type manifestsByCreated []SimulationManifest
+
+func (m manifestsByCreated) Len() int           { return len(m) }
+func (m manifestsByCreated) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
+func (m manifestsByCreated) Less(i, j int) bool { return m[i].Created.Before(m[j].Created) }
+
+func (s *RegistryServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 2 && parts[0] == "blobs" && req.Method == "GET":
+		s.serveBlob(w, req, parts[1])
+	case len(parts) == 1 && parts[0] == "simulations" && req.Method == "GET":
+		s.serveNames(w)
+	case len(parts) == 2 && parts[0] == "simulations" && req.Method == "GET":
+		s.serveVersions(w, parts[1])
+	case len(parts) == 3 && parts[0] == "simulations" && req.Method == "GET":
+		s.serveManifest(w, SimulationRef{Name: parts[1], Version: parts[2]})
+	case len(parts) == 3 && parts[0] == "simulations" && req.Method == "PUT":
+		s.publish(w, req, SimulationRef{Name: parts[1], Version: parts[2]})
+	default:
+		s.writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *RegistryServer) serveBlob(w http.ResponseWriter, req *http.Request, digest string) {
+	if !rxBundleDigest.MatchString(digest) {
+		s.writeError(w, http.StatusBadRequest, "Invalid digest '%s'", digest)
+		return
+	}
+	f, err := os.Open(s.blobPath(digest))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Blob '%s' not found", digest)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set(RegistryDigestHeader, digest)
+	http.ServeContent(w, req, "", time.Time{}, f)
+}
+
+func (s *RegistryServer) serveNames(w http.ResponseWriter) {
+	files, _ := ioutil.ReadDir(filepath.Join(s.Dir, "simulations"))
+
+	names := simulationNames{Data: []string{}}
+	for _, f := range files {
+		if f.IsDir() {
+			names.Data = append(names.Data, f.Name())
+		}
+	}
+	s.writeJSON(w, http.StatusOK, names)
+}
+
+func (s *RegistryServer) serveVersions(w http.ResponseWriter, name string) {
+	if !rxSimulationName.MatchString(name) {
+		s.writeError(w, http.StatusBadRequest, "Invalid simulation name '%s'", name)
+		return
+	}
+	manifests, err := s.versions(name)
+	if err != nil || len(manifests) == 0 {
+		s.writeError(w, http.StatusNotFound, "Simulation '%s' not found", name)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, simulationVersions{Name: name, Data: manifests})
+}
+
+func (s *RegistryServer) serveManifest(w http.ResponseWriter, ref SimulationRef) {
+	if !rxSimulationName.MatchString(ref.Name) || !rxSimulationVersion.MatchString(ref.Version) {
+		s.writeError(w, http.StatusBadRequest, "Invalid simulation '%s'", ref)
+		return
+	}
+
+	if ref.Version == LatestVersion {
+		manifests, err := s.versions(ref.Name)
+		if err != nil || len(manifests) == 0 {
+			s.writeError(w, http.StatusNotFound, "Simulation '%s' not found", ref)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, manifests[len(manifests)-1])
+		return
+	}
+
+	data, err := ioutil.ReadFile(s.manifestPath(ref.Name, ref.Version))
+	if err != nil {
+		s.writeError(w, http.StatusNotFound, "Simulation '%s' not found", ref)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(data)
+}
+
+func (s *RegistryServer) publish(w http.ResponseWriter, req *http.Request, ref SimulationRef) {
+	if !rxSimulationName.MatchString(ref.Name) || !rxSimulationVersion.MatchString(ref.Version) || ref.Version == LatestVersion {
+		s.writeError(w, http.StatusBadRequest, "Invalid simulation '%s', '%s' version can't be published", ref, LatestVersion)
+		return
+	}
+
+	defer req.Body.Close()
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "Failed to read bundle: %s", err.Error())
+		return
+	}
+
+	digest := bundleDigest(data)
+	if expected := req.Header.Get(RegistryDigestHeader); expected != "" && expected != digest {
+		s.writeError(w, http.StatusBadRequest, "Bundle digest is %s, expected %s", digest, expected)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// versions are immutable, publishing the same bundle again is allowed
+	if existing, err := ioutil.ReadFile(s.manifestPath(ref.Name, ref.Version)); err == nil {
+		var m SimulationManifest
+		if json.Unmarshal(existing, &m) == nil && m.Digest == digest {
+			s.writeJSON(w, http.StatusOK, m)
+			return
+		}
+		s.writeError(w, http.StatusConflict, "Simulation '%s' is already published", ref)
+		return
+	}
+
+	manifest := SimulationManifest{
+		Name:    ref.Name,
+		Version: ref.Version,
+		Digest:  digest,
+		Size:    int64(len(data)),
+		Created: time.Now().UTC(),
+	}
+	encoded, _ := json.Marshal(manifest)
+
+	if err := writeFileAtomic(s.blobPath(digest), data); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "Failed to store bundle: %s", err.Error())
+		return
+	}
+	if err := writeFileAtomic(s.manifestPath(ref.Name, ref.Version), encoded); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "Failed to store manifest: %s", err.Error())
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"simulation": ref.String(),
+		"digest":     digest,
+		"size":       manifest.Size,
+	}).Info("Simulation published")
+
+	s.writeJSON(w, http.StatusCreated, manifest)
+}
+
+// writeFileAtomic - writes file through a temporary file, so readers never see partial content
+func writeFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(name), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+// registryStatusError - registry responded with an error status
+type registryStatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *registryStatusError) Error() string {
+	return fmt.Sprintf("registry returned %d: %s", e.Status, e.Message)
+}
+
+// RegistryClient - publishes simulations to registry and fetches them. Fetched bundles are verified against
+// their digest and cached in CacheDir, so pinned versions can be imported when registry is unavailable.
+type RegistryClient struct {
+	URL      *url.URL
+	CacheDir string
+	HTTP     *http.Client
+}
+
+// DefaultRegistryCacheDir - returns directory fetched simulations are cached in
+func DefaultRegistryCacheDir() string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return filepath.Join(os.TempDir(), "hoverfly", "simulations")
+	}
+	return filepath.Join(home, ".hoverfly", "simulations")
+}
+
+// NewRegistryClient - returns client of registry, credentials in URL are sent with basic auth
+func NewRegistryClient(registry, cacheDir string) (*RegistryClient, error) {
+	u, err := url.Parse(registry)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("registry should be an HTTP URL, e.g. 'http://registry:8600', got '%s'", registry)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if cacheDir == "" {
+		cacheDir = DefaultRegistryCacheDir()
+	}
+	return &RegistryClient{URL: u, CacheDir: cacheDir, HTTP: &http.Client{Timeout: time.Minute}}, nil
+}
+
+// String - returns registry URL without credentials
+func (c *RegistryClient) String() string {
+	u := *c.URL
+	u.User = nil
+	return u.String()
+}
+
+func (c *RegistryClient) do(method, path string, body []byte, header http.Header) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, c.URL.String()+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var msg messageResponse
+		if json.Unmarshal(data, &msg) != nil || msg.Message == "" {
+			msg.Message = strings.TrimSpace(string(data))
+		}
+		return resp, data, &registryStatusError{Status: resp.StatusCode, Message: msg.Message}
+	}
+	return resp, data, nil
+}
+
+func (c *RegistryClient) getJSON(path string, v interface{}) error {
+	_, data, err := c.do("GET", path, nil, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Publish - publishes simulation bundle as given version
+func (c *RegistryClient) Publish(ref SimulationRef, bundle []byte) (*SimulationManifest, error) {
+	if ref.Version == LatestVersion {
+		return nil, fmt.Errorf("version is required, '%s' can't be published", LatestVersion)
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/zip")
+	header.Set(RegistryDigestHeader, bundleDigest(bundle))
+
+	_, data, err := c.do("PUT", "/simulations/"+ref.Name+"/"+ref.Version, bundle, header)
+	if err != nil {
+		return nil, err
+	}
+	var manifest SimulationManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// Simulations - returns names of simulations published to registry
+func (c *RegistryClient) Simulations() ([]string, error) {
+	var names simulationNames
+	err := c.getJSON("/simulations", &names)
+	return names.Data, err
+}
+
+// Versions - returns published versions of simulation, the most recent one is last
+func (c *RegistryClient) Versions(name string) ([]SimulationManifest, error) {
+	var versions simulationVersions
+	err := c.getJSON("/simulations/"+name, &versions)
+	return versions.Data, err
+}
+
+// Manifest - returns manifest of simulation version
+func (c *RegistryClient) Manifest(ref SimulationRef) (*SimulationManifest, error) {
+	var manifest SimulationManifest
+	if err := c.getJSON("/simulations/"+ref.Name+"/"+ref.Version, &manifest); err != nil {
+		return nil, err
+	}
+	if !rxBundleDigest.MatchString(manifest.Digest) {
+		return nil, fmt.Errorf("registry returned invalid digest '%s' for '%s'", manifest.Digest, ref)
+	}
+	return &manifest, nil
+}
+
+func (c *RegistryClient) cachedBundlePath(digest string) string {
+	return filepath.Join(c.CacheDir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:")+".zip")
+}
+
+func (c *RegistryClient) cachedManifestPath(ref SimulationRef) string {
+	return filepath.Join(c.CacheDir, "manifests", ref.Name, ref.Version+".json")
+}
+
+// cachedManifest - returns manifest of version fetched before, "latest" is never served from cache
+func (c *RegistryClient) cachedManifest(ref SimulationRef) (*SimulationManifest, error) {
+	if ref.Version == LatestVersion {
+		return nil, fmt.Errorf("'%s' is not cached", ref)
+	}
+	data, err := ioutil.ReadFile(c.cachedManifestPath(ref))
+	if err != nil {
+		return nil, err
+	}
+	var manifest SimulationManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	if !rxBundleDigest.MatchString(manifest.Digest) {
+		return nil, fmt.Errorf("cached manifest of '%s' has invalid digest", ref)
+	}
+	return &manifest, nil
+}
+
+// verifiedBundle - checks cached bundle matches its digest
+func (c *RegistryClient) verifiedBundle(digest string) (string, bool) {
+	path := c.cachedBundlePath(digest)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	if bundleDigest(data) != digest {
+		log.WithFields(log.Fields{
+			"path":   path,
+			"digest": digest,
+		}).Warn("Cached simulation bundle is corrupted, fetching it again")
+		return "", false
+	}
+	return path, true
+}
+
+// Fetch - returns path of verified bundle of simulation version, bundle is downloaded unless it's cached
+func (c *RegistryClient) Fetch(ref SimulationRef) (string, *SimulationManifest, error) {
+	manifest, err := c.Manifest(ref)
+	if err != nil {
+		// registry rejected the request, i.e. version doesn't exist
+		if statusErr, ok := err.(*registryStatusError); ok && statusErr.Status < 500 {
+			return "", nil, fmt.Errorf("failed to fetch '%s': %s", ref, err.Error())
+		}
+		cached, cacheErr := c.cachedManifest(ref)
+		if cacheErr != nil {
+			return "", nil, fmt.Errorf("failed to fetch '%s': %s", ref, err.Error())
+		}
+		log.WithFields(log.Fields{
+			"error":      err.Error(),
+			"simulation": ref.String(),
+		}).Warn("Registry is unavailable, using cached simulation")
+		manifest = cached
+	}
+
+	path, ok := c.verifiedBundle(manifest.Digest)
+	if !ok {
+		_, data, err := c.do("GET", "/blobs/"+manifest.Digest, nil, nil)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to fetch '%s': %s", ref, err.Error())
+		}
+		if digest := bundleDigest(data); digest != manifest.Digest {
+			return "", nil, fmt.Errorf("checksum of '%s' doesn't match, expected %s, got %s", ref, manifest.Digest, digest)
+		}
+		path = c.cachedBundlePath(manifest.Digest)
+		if err := writeFileAtomic(path, data); err != nil {
+			return "", nil, err
+		}
+	}
+
+	// pinned versions can be imported later without registry
+	encoded, _ := json.Marshal(manifest)
+	pinned := SimulationRef{Name: manifest.Name, Version: manifest.Version}
+	if manifest.Name == "" || manifest.Version == "" {
+		pinned = ref
+	}
+	if err := writeFileAtomic(c.cachedManifestPath(pinned), encoded); err != nil {
+		log.WithFields(log.Fields{
+			"error":      err.Error(),
+			"simulation": ref.String(),
+		}).Warn("Failed to cache simulation manifest")
+	}
+	return path, manifest, nil
+}
+
+// isSimulationRef - checks whether import source looks like simulation published to registry
+func isSimulationRef(uri string) bool {
+	ext := filepath.Ext(uri)
+	if ext == ".json" || ext == ".zip" {
+		return false
+	}
+	_, err := ParseSimulationRef(uri)
+	return err == nil
+}
+
+// ImportFromRegistry - imports simulation published to registry, e.g. "payments:1.2.0"
+func (d *DBClient) ImportFromRegistry(simulation string) error {
+	if d.Registry == nil {
+		return fmt.Errorf("Failed to import '%s', registry is not configured", simulation)
+	}
+	ref, err := ParseSimulationRef(simulation)
+	if err != nil {
+		return err
+	}
+
+	path, manifest, err := d.Registry.Fetch(ref)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"simulation": ref.String(),
+		"version":    manifest.Version,
+		"digest":     manifest.Digest,
+		"registry":   d.Registry.String(),
+	}).Info("Importing simulation from registry")
+
+	return d.ImportFromZip(path)
+}
+
+// PublishSimulation - publishes all records (with body files) as given simulation version
+func (d *DBClient) PublishSimulation(simulation string) (*SimulationManifest, error) {
+	if d.Registry == nil {
+		return nil, fmt.Errorf("Failed to publish '%s', registry is not configured", simulation)
+	}
+	ref, err := ParseSimulationRef(simulation)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := d.WriteSimulationBundle(&buf); err != nil {
+		return nil, err
+	}
+	manifest, err := d.Registry.Publish(ref, buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to publish '%s': %s", ref, err.Error())
+	}
+
+	log.WithFields(log.Fields{
+		"simulation": ref.String(),
+		"digest":     manifest.Digest,
+		"registry":   d.Registry.String(),
+	}).Info("Simulation published")
+	return manifest, nil
+}
+
+type registryRequest struct {
+	// Simulation - name and version, e.g. "payments:1.2.0"
+	Simulation string `json:"simulation"`
+}
+
+// decodeRegistryRequest - reads simulation reference from request body
+func decodeRegistryRequest(w http.ResponseWriter, req *http.Request) (string, bool) {
+	var rr registryRequest
+
+	defer req.Body.Close()
+	body, err := ioutil.ReadAll(req.Body)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Error("Could not read request body!")
+		http.Error(w, "Failed to read request body.", 400)
+		return "", false
+	}
+
+	if err = json.Unmarshal(body, &rr); err != nil {
+		w.WriteHeader(422) // can't process this entity
+		return "", false
+	}
+	return rr.Simulation, true
+}
+
+// PublishSimulationHandler - publishes current records to registry
+func (d *DBClient) PublishSimulationHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	simulation, ok := decodeRegistryRequest(w, req)
+	if !ok {
+		return
+	}
+
+	manifest, err := d.PublishSimulation(simulation)
+	if err != nil {
+		b, _ := json.Marshal(messageResponse{Message: err.Error()})
+		w.WriteHeader(400)
+		w.Write(b)
+		return
+	}
+
+	b, _ := json.Marshal(manifest)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(b)
+}
+
+// ImportSimulationHandler - imports simulation from registry
+func (d *DBClient) ImportSimulationHandler(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	if d.rejectLocked(w) {
+		return
+	}
+
+	simulation, ok := decodeRegistryRequest(w, req)
+	if !ok {
+		return
+	}
+
+	var response messageResponse
+	status := http.StatusOK
+	if err := d.ImportFromRegistry(simulation); err != nil {
+		response.Message = err.Error()
+		status = 400
+	} else {
+		response.Message = fmt.Sprintf("Simulation '%s' imported", simulation)
+	}
+
+	b, _ := json.Marshal(response)
+	w.WriteHeader(status)
+	w.Write(b)
+}
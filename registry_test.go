@@ -0,0 +1,218 @@
+package hoverfly
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func registryTools(t *testing.T) (*httptest.Server, *RegistryServer, *RegistryClient, func()) {
+	dir, err := ioutil.TempDir("", "hoverfly-registry")
+	expect(t, err, nil)
+
+	registry := NewRegistryServer(filepath.Join(dir, "registry"))
+	server := httptest.NewServer(registry)
+
+	client, err := NewRegistryClient(server.URL, filepath.Join(dir, "cache"))
+	expect(t, err, nil)
+
+	return server, registry, client, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func registryClientTools(client *RegistryClient) (*httptest.Server, *DBClient) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	dbClient.Bodies = testBodyStore("")
+	dbClient.Registry = client
+	return server, dbClient
+}
+
+func TestParseSimulationRef(t *testing.T) {
+	ref, err := ParseSimulationRef("payments:1.2.0")
+	expect(t, err, nil)
+	expect(t, ref, SimulationRef{Name: "payments", Version: "1.2.0"})
+	expect(t, ref.String(), "payments:1.2.0")
+
+	ref, err = ParseSimulationRef("payments")
+	expect(t, err, nil)
+	expect(t, ref.Version, LatestVersion)
+
+	for _, invalid := range []string{"Payments:1", "payments:", "../payments:1", "payments:../1", "payments/v1:1"} {
+		_, err = ParseSimulationRef(invalid)
+		refute(t, err, nil)
+	}
+
+	expect(t, isSimulationRef("payments:1.2.0"), true)
+	expect(t, isSimulationRef("payments.zip"), false)
+	expect(t, isSimulationRef("/tmp/payments.json"), false)
+}
+
+func TestPublishAndImportFromRegistry(t *testing.T) {
+	_, _, client, cleanup := registryTools(t)
+	defer cleanup()
+
+	server, dbClient := registryClientTools(client)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+	defer dbClient.Bodies.DeleteBlobs()
+
+	expect(t, dbClient.ImportPayloads([]Payload{replicatedPayload("a.com", "a")}), nil)
+	manifest, err := dbClient.PublishSimulation("payments:1.0.0")
+	expect(t, err, nil)
+	expect(t, manifest.Name, "payments")
+	expect(t, manifest.Version, "1.0.0")
+	expect(t, strings.HasPrefix(manifest.Digest, "sha256:"), true)
+
+	expect(t, dbClient.ImportPayloads([]Payload{replicatedPayload("b.com", "b")}), nil)
+	_, err = dbClient.PublishSimulation("payments:1.1.0")
+	expect(t, err, nil)
+
+	// latest version can't be published
+	_, err = dbClient.PublishSimulation("payments")
+	refute(t, err, nil)
+
+	versions, err := client.Versions("payments")
+	expect(t, err, nil)
+	expect(t, len(versions), 2)
+	names, err := client.Simulations()
+	expect(t, err, nil)
+	expect(t, reflect.DeepEqual(names, []string{"payments"}), true)
+
+	other, otherClient := registryClientTools(client)
+	defer other.Close()
+	defer otherClient.Cache.DeleteData()
+	defer otherClient.Bodies.DeleteBlobs()
+
+	expect(t, otherClient.Import("payments:1.0.0"), nil)
+	expect(t, reflect.DeepEqual(replicatedBodies(t, otherClient), map[string]string{"a.com": "a"}), true)
+
+	otherClient.Cache.DeleteData()
+	expect(t, otherClient.Import("payments"), nil)
+	expect(t, reflect.DeepEqual(replicatedBodies(t, otherClient), map[string]string{"a.com": "a", "b.com": "b"}), true)
+
+	err = otherClient.Import("payments:2.0.0")
+	refute(t, err, nil)
+}
+
+func TestRegistryVersionsAreImmutable(t *testing.T) {
+	_, _, client, cleanup := registryTools(t)
+	defer cleanup()
+
+	_, err := client.Publish(SimulationRef{Name: "payments", Version: "1"}, []byte("bundle"))
+	expect(t, err, nil)
+	// publishing the same bundle again is fine
+	_, err = client.Publish(SimulationRef{Name: "payments", Version: "1"}, []byte("bundle"))
+	expect(t, err, nil)
+
+	_, err = client.Publish(SimulationRef{Name: "payments", Version: "1"}, []byte("changed"))
+	statusErr, ok := err.(*registryStatusError)
+	expect(t, ok, true)
+	expect(t, statusErr.Status, http.StatusConflict)
+}
+
+func TestRegistryRejectsDigestMismatch(t *testing.T) {
+	server, _, _, cleanup := registryTools(t)
+	defer cleanup()
+
+	req, _ := http.NewRequest("PUT", server.URL+"/simulations/payments/1", bytes.NewBufferString("bundle"))
+	req.Header.Set(RegistryDigestHeader, bundleDigest([]byte("other")))
+	resp, err := http.DefaultClient.Do(req)
+	expect(t, err, nil)
+	resp.Body.Close()
+	expect(t, resp.StatusCode, http.StatusBadRequest)
+}
+
+func TestFetchVerifiesChecksum(t *testing.T) {
+	_, registry, client, cleanup := registryTools(t)
+	defer cleanup()
+
+	manifest, err := client.Publish(SimulationRef{Name: "payments", Version: "1"}, []byte("bundle"))
+	expect(t, err, nil)
+
+	// bundle stored in registry was tampered with
+	expect(t, ioutil.WriteFile(registry.blobPath(manifest.Digest), []byte("tampered"), 0600), nil)
+
+	_, _, err = client.Fetch(SimulationRef{Name: "payments", Version: "1"})
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), "checksum"), true)
+
+	_, err = os.Stat(client.cachedBundlePath(manifest.Digest))
+	expect(t, os.IsNotExist(err), true)
+}
+
+func TestFetchUsesCache(t *testing.T) {
+	server, registry, client, cleanup := registryTools(t)
+	defer cleanup()
+
+	ref := SimulationRef{Name: "payments", Version: "1"}
+	_, err := client.Publish(ref, []byte("bundle"))
+	expect(t, err, nil)
+
+	path, _, err := client.Fetch(ref)
+	expect(t, err, nil)
+	data, err := ioutil.ReadFile(path)
+	expect(t, err, nil)
+	expect(t, string(data), "bundle")
+
+	// cached bundle is used, so registry blob isn't needed anymore
+	expect(t, os.RemoveAll(filepath.Join(registry.Dir, "blobs")), nil)
+	_, _, err = client.Fetch(ref)
+	expect(t, err, nil)
+
+	// pinned versions are imported from cache when registry is unavailable
+	server.Close()
+	cachedPath, manifest, err := client.Fetch(ref)
+	expect(t, err, nil)
+	expect(t, cachedPath, path)
+	expect(t, manifest.Version, "1")
+
+	// latest can't be resolved without registry
+	_, _, err = client.Fetch(SimulationRef{Name: "payments", Version: LatestVersion})
+	refute(t, err, nil)
+
+	// corrupted cache isn't used
+	expect(t, ioutil.WriteFile(path, []byte("corrupted"), 0600), nil)
+	_, _, err = client.Fetch(ref)
+	refute(t, err, nil)
+}
+
+func TestRegistryHandlers(t *testing.T) {
+	_, _, client, cleanup := registryTools(t)
+	defer cleanup()
+
+	server, dbClient := registryClientTools(client)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+	defer dbClient.Bodies.DeleteBlobs()
+
+	expect(t, dbClient.ImportPayloads([]Payload{replicatedPayload("a.com", "a")}), nil)
+
+	rec := lockTestRequest(dbClient, "POST", "/registry/publish", `{"simulation":"payments:1"}`)
+	expect(t, rec.Code, http.StatusCreated)
+
+	dbClient.Cfg.SetLocked(true)
+	rec = lockTestRequest(dbClient, "POST", "/registry/import", `{"simulation":"payments:1"}`)
+	expect(t, rec.Code, StatusLocked)
+	dbClient.Cfg.SetLocked(false)
+
+	dbClient.Cache.DeleteData()
+	rec = lockTestRequest(dbClient, "POST", "/registry/import", `{"simulation":"payments:1"}`)
+	expect(t, rec.Code, http.StatusOK)
+	expect(t, reflect.DeepEqual(replicatedBodies(t, dbClient), map[string]string{"a.com": "a"}), true)
+
+	rec = lockTestRequest(dbClient, "POST", "/registry/import", `{"simulation":"missing:1"}`)
+	expect(t, rec.Code, http.StatusBadRequest)
+
+	// registry is not configured
+	dbClient.Registry = nil
+	rec = lockTestRequest(dbClient, "POST", "/registry/publish", `{"simulation":"payments:2"}`)
+	expect(t, rec.Code, http.StatusBadRequest)
+}
@@ -0,0 +1,263 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func replicationSource(t *testing.T) (*httptest.Server, *DBClient, *httptest.Server) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	dbClient.Hooks = make(ActionTypeHooks)
+	dbClient.Replication = NewReplicationLog(DefaultReplicationLogSize)
+	expect(t, dbClient.AddHookWithOptions(dbClient.Replication, HookOptions{Sync: true}), nil)
+
+	admin := httptest.NewServer(getBoneRouter(*dbClient))
+	return server, dbClient, admin
+}
+
+func replicatedPayload(destination, body string) Payload {
+	return Payload{
+		Request:  RequestDetails{Destination: destination, Path: "/", Method: "GET"},
+		Response: ResponseDetails{Status: 200, Body: body},
+	}
+}
+
+func replicatedBodies(t *testing.T, dbClient *DBClient) map[string]string {
+	payloads, err := dbClient.Cache.GetAllRequests()
+	expect(t, err, nil)
+
+	bodies := make(map[string]string)
+	for _, pl := range payloads {
+		bodies[pl.Request.Destination] = pl.Response.Body
+	}
+	return bodies
+}
+
+// waitForPush - changes are pushed in the background, polling until condition is met
+func waitForPush(condition func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return condition()
+}
+
+func TestReplicationLog(t *testing.T) {
+	l := NewReplicationLog(2)
+
+	pl := replicatedPayload("a.com", "a")
+	bts, _ := pl.Encode()
+	for i := 0; i < 3; i++ {
+		expect(t, l.Fire(&Entry{ActionType: ActionTypeRequestCaptured, Data: bts}), nil)
+	}
+	expect(t, l.Fire(&Entry{ActionType: ActionTypeWipeDB}), nil)
+
+	epoch, seq := l.Seq()
+	expect(t, seq, uint64(4))
+
+	changes, _, latest, reset := l.since(epoch, 2, 10)
+	expect(t, reset, false)
+	expect(t, latest, uint64(4))
+	expect(t, len(changes), 2)
+	expect(t, changes[0].Seq, uint64(3))
+	expect(t, changes[0].Payload.Request.Destination, "a.com")
+	expect(t, changes[1].Type, ReplicationChangeWipe)
+
+	// log was trimmed to the last 2 changes
+	_, _, _, reset = l.since(epoch, 1, 10)
+	expect(t, reset, true)
+
+	// unknown epoch or sequence
+	_, _, _, reset = l.since("other", 4, 10)
+	expect(t, reset, true)
+	_, _, _, reset = l.since(epoch, 5, 10)
+	expect(t, reset, true)
+
+	l.reset()
+	_, _, _, reset = l.since(epoch, 4, 10)
+	expect(t, reset, true)
+}
+
+func TestReplicationPull(t *testing.T) {
+	server, source, admin := replicationSource(t)
+	defer server.Close()
+	defer admin.Close()
+	defer source.Cache.DeleteData()
+
+	replicaServer, replica := testTools(200, `{'message': 'here'}`)
+	defer replicaServer.Close()
+	defer replica.Cache.DeleteData()
+
+	expect(t, source.ImportPayloads([]Payload{replicatedPayload("a.com", "a"), replicatedPayload("b.com", "b")}), nil)
+	// records replica had before subscribing are replaced
+	expect(t, replica.ImportPayloads([]Payload{replicatedPayload("old.com", "old")}), nil)
+
+	subscription, err := NewReplicaSubscription(admin.URL)
+	expect(t, err, nil)
+	subscription.Wait = 0
+
+	expect(t, subscription.sync(replica), nil)
+	expect(t, reflect.DeepEqual(replicatedBodies(t, replica), map[string]string{"a.com": "a", "b.com": "b"}), true)
+
+	// incremental changes
+	source.wipeRecords()
+	expect(t, source.ImportPayloads([]Payload{replicatedPayload("c.com", "c")}), nil)
+
+	expect(t, subscription.sync(replica), nil)
+	expect(t, reflect.DeepEqual(replicatedBodies(t, replica), map[string]string{"c.com": "c"}), true)
+
+	status := subscription.Status()
+	expect(t, status.AppliedSeq, uint64(4))
+	expect(t, status.SourceSeq, uint64(4))
+	expect(t, status.Behind, uint64(0))
+	expect(t, status.LagSeconds, float64(0))
+	expect(t, status.URL, admin.URL)
+}
+
+func TestReplicationPullWaitsForChanges(t *testing.T) {
+	server, source, admin := replicationSource(t)
+	defer server.Close()
+	defer admin.Close()
+	defer source.Cache.DeleteData()
+
+	replicaServer, replica := testTools(200, `{'message': 'here'}`)
+	defer replicaServer.Close()
+	defer replica.Cache.DeleteData()
+
+	subscription, err := NewReplicaSubscription(admin.URL)
+	expect(t, err, nil)
+	expect(t, subscription.sync(replica), nil)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		source.ImportPayloads([]Payload{replicatedPayload("a.com", "a")})
+	}()
+
+	started := time.Now()
+	expect(t, subscription.sync(replica), nil)
+	expect(t, time.Since(started) < DefaultReplicationWait, true)
+	expect(t, reflect.DeepEqual(replicatedBodies(t, replica), map[string]string{"a.com": "a"}), true)
+}
+
+func TestReplicationPush(t *testing.T) {
+	server, source, admin := replicationSource(t)
+	defer server.Close()
+	defer admin.Close()
+	defer source.Cache.DeleteData()
+
+	replicaServer, replica := testTools(200, `{'message': 'here'}`)
+	defer replicaServer.Close()
+	defer replica.Cache.DeleteData()
+	replicaAdmin := httptest.NewServer(getBoneRouter(*replica))
+	defer replicaAdmin.Close()
+
+	// large bodies are stored in blobs, replica gets them in payloads
+	source.Bodies = testBodyStore("")
+	ref, err := source.Bodies.Put([]byte("large"))
+	expect(t, err, nil)
+	large := replicatedPayload("blob.com", "")
+	large.Response.BodyFile = ref
+	expect(t, source.ImportPayloads([]Payload{large}), nil)
+
+	pusher, err := NewReplicaPusher(source, replicaAdmin.URL)
+	expect(t, err, nil)
+	expect(t, pusher.push(), nil)
+	expect(t, reflect.DeepEqual(replicatedBodies(t, replica), map[string]string{"blob.com": "large"}), true)
+
+	// changes are pushed when hooks fire
+	source.AddHook(pusher)
+	pusher.Start()
+	defer pusher.Stop()
+	expect(t, source.ImportPayloads([]Payload{replicatedPayload("a.com", "a")}), nil)
+	expect(t, waitForPush(func() bool {
+		return reflect.DeepEqual(replicatedBodies(t, replica), map[string]string{"blob.com": "large", "a.com": "a"})
+	}), true)
+
+	status := pusher.Status()
+	expect(t, status.AppliedSeq, uint64(2))
+	expect(t, status.Behind, uint64(0))
+	expect(t, status.LagSeconds, float64(0))
+
+	// locked replica rejects changes and lag is reported
+	replica.Cfg.SetLocked(true)
+	expect(t, source.ImportPayloads([]Payload{replicatedPayload("b.com", "b")}), nil)
+	expect(t, waitForPush(func() bool { return pusher.Status().Error != "" }), true)
+	status = pusher.Status()
+	expect(t, status.Behind, uint64(1))
+	refute(t, status.Error, "")
+	expect(t, status.LagSeconds > 0, true)
+
+	// status doesn't wait for pushes
+	pusher.pushMu.Lock()
+	status = pusher.Status()
+	pusher.pushMu.Unlock()
+	expect(t, status.Behind, uint64(1))
+
+	replica.Cfg.SetLocked(false)
+	expect(t, pusher.push(), nil)
+	expect(t, len(replicatedBodies(t, replica)), 3)
+
+	// status endpoint
+	source.Replicas = append(source.Replicas, pusher)
+	m := getBoneRouter(*source)
+	req, _ := http.NewRequest("GET", "/replication", nil)
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+
+	var sr replicationStatus
+	expect(t, json.Unmarshal(rec.Body.Bytes(), &sr), nil)
+	expect(t, sr.Seq, uint64(3))
+	expect(t, len(sr.Replicas), 1)
+	expect(t, sr.Replicas[0].Behind, uint64(0))
+}
+
+// failingCache - cache refusing to store records
+type failingCache struct {
+	Cache
+}
+
+func (c failingCache) Set(key, value []byte) error {
+	return fmt.Errorf("disk is full")
+}
+
+func TestFailedImportIsNotReplicated(t *testing.T) {
+	server, dbClient, admin := replicationSource(t)
+	defer server.Close()
+	defer admin.Close()
+	defer dbClient.Cache.DeleteData()
+
+	cache := dbClient.Cache
+	dbClient.Cache = failingCache{Cache: cache}
+	_, err := dbClient.importPayload(replicatedPayload("a.com", "a"), nil)
+	refute(t, err, nil)
+	dbClient.Cache = cache
+
+	changes, err := dbClient.replicationChanges("", 0)
+	expect(t, err, nil)
+	expect(t, changes.Latest, uint64(0))
+	expect(t, len(changes.Data), 0)
+}
+
+func TestReplicationChangesDisabled(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	m := getBoneRouter(*dbClient)
+	req, _ := http.NewRequest("GET", "/replication/changes", nil)
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusNotFound)
+
+	_, err := NewReplicaPusher(dbClient, "http://localhost:8888")
+	refute(t, err, nil)
+}
@@ -0,0 +1,290 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Schema - describes generated JSON value. It's a subset of JSON Schema: type (object, array, string, integer,
+// number, boolean or null), properties, items, minItems, maxItems, minimum, maximum and enum. Format of strings
+// selects fake data, e.g. "email", "name", "uuid", "date-time" (see SchemaFormats).
+type Schema struct {
+	Type       string             `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	MinItems   *int               `json:"minItems,omitempty"`
+	MaxItems   *int               `json:"maxItems,omitempty"`
+	Minimum    *float64           `json:"minimum,omitempty"`
+	Maximum    *float64           `json:"maximum,omitempty"`
+	Enum       []interface{}      `json:"enum,omitempty"`
+}
+
+// SchemaFormats - string formats mapped to fake data generators
+var SchemaFormats = map[string]func(f *Faker) string{
+	"firstName": (*Faker).FirstName,
+	"lastName":  (*Faker).LastName,
+	"name":      (*Faker).Name,
+	"email":     (*Faker).Email,
+	"phone":     (*Faker).Phone,
+	"street":    (*Faker).Street,
+	"city":      (*Faker).City,
+	"postcode":  (*Faker).Postcode,
+	"country":   (*Faker).Country,
+	"address":   (*Faker).Address,
+	"uuid":      (*Faker).UUID,
+	"date":      func(f *Faker) string { return f.Date().Format("2006-01-02") },
+	"date-time": func(f *Faker) string { return f.Date().Format(time.RFC3339) },
+	"localDate": (*Faker).LocalDate,
+	"word":      (*Faker).Word,
+	"sentence":  (*Faker).Sentence,
+	"paragraph": (*Faker).Paragraph,
+}
+
+// schema generation defaults
+const (
+	defaultSchemaMinItems = 1
+	defaultSchemaMaxItems = 5
+	defaultSchemaMaximum  = 1000
+	// maxSchemaDepth - protects against schemas nested too deep
+	maxSchemaDepth = 32
+)
+
+// Validate - checks whether value can be generated from schema
+func (s *Schema) Validate() error {
+	return s.validate(0)
+}
+
+func (s *Schema) validate(depth int) error {
+	if depth > maxSchemaDepth {
+		return fmt.Errorf("schema is nested more than %d levels", maxSchemaDepth)
+	}
+	if len(s.Enum) > 0 {
+		return nil
+	}
+
+	switch s.Type {
+	case "object":
+		for name, p := range s.Properties {
+			if p == nil {
+				return fmt.Errorf("property '%s' has no schema", name)
+			}
+			if err := p.validate(depth + 1); err != nil {
+				return fmt.Errorf("property '%s': %s", name, err.Error())
+			}
+		}
+	case "array":
+		if s.Items == nil {
+			return fmt.Errorf("array schema requires items")
+		}
+		if (s.MinItems != nil && *s.MinItems < 0) || (s.MaxItems != nil && *s.MaxItems < 0) {
+			return fmt.Errorf("minItems and maxItems can't be negative")
+		}
+		if s.MinItems != nil && s.MaxItems != nil && *s.MinItems > *s.MaxItems {
+			return fmt.Errorf("minItems is greater than maxItems")
+		}
+		return s.Items.validate(depth + 1)
+	case "string":
+		if _, ok := SchemaFormats[s.Format]; s.Format != "" && !ok {
+			return fmt.Errorf("unknown string format '%s'", s.Format)
+		}
+	case "integer", "number":
+		if s.Minimum != nil && s.Maximum != nil && *s.Minimum > *s.Maximum {
+			return fmt.Errorf("minimum is greater than maximum")
+		}
+		if s.Type == "integer" && s.Minimum != nil && s.Maximum != nil && math.Ceil(*s.Minimum) > math.Floor(*s.Maximum) {
+			return fmt.Errorf("there is no integer between minimum and maximum")
+		}
+	case "boolean", "null":
+	default:
+		return fmt.Errorf("unknown schema type '%s'", s.Type)
+	}
+	return nil
+}
+
+// Generate - generates value described by schema
+func (s *Schema) Generate(f *Faker) interface{} {
+	if len(s.Enum) > 0 {
+		return s.Enum[f.intn(len(s.Enum))]
+	}
+
+	switch s.Type {
+	case "object":
+		// properties are generated in stable order so the same seed gives the same values
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		object := make(map[string]interface{}, len(names))
+		for _, name := range names {
+			object[name] = s.Properties[name].Generate(f)
+		}
+		return object
+	case "array":
+		min, max := defaultSchemaMinItems, defaultSchemaMaxItems
+		if s.MinItems != nil {
+			min = *s.MinItems
+		}
+		if s.MaxItems != nil {
+			max = *s.MaxItems
+		} else if max < min {
+			max = min
+		}
+		// schemas set without validation can't make negative length
+		if min < 0 {
+			min = 0
+		}
+		if max < 0 {
+			max = 0
+		}
+		items := make([]interface{}, f.IntBetween(min, max))
+		for i := range items {
+			items[i] = s.Items.Generate(f)
+		}
+		return items
+	case "string":
+		if generate, ok := SchemaFormats[s.Format]; ok {
+			return generate(f)
+		}
+		return f.Lorem(f.IntBetween(1, 3))
+	case "integer":
+		min, max := s.bounds()
+		return f.IntBetween(int(math.Ceil(min)), int(math.Floor(max)))
+	case "number":
+		min, max := s.bounds()
+		return math.Round(f.FloatBetween(min, max)*100) / 100
+	case "boolean":
+		return f.Bool()
+	}
+	return nil
+}
+
+func (s *Schema) bounds() (min, max float64) {
+	min, max = 0, defaultSchemaMaximum
+	if s.Minimum != nil {
+		min = *s.Minimum
+	}
+	if s.Maximum != nil {
+		max = *s.Maximum
+		if s.Minimum == nil && max < min {
+			min = max - defaultSchemaMaximum
+		}
+	} else if max < min {
+		max = min + defaultSchemaMaximum
+	}
+	return
+}
+
+// ResponseSchema - describes response synthesized for requests matching Destination, Path (regular
+// expressions, empty matches everything) and Method. Body is generated from Schema.
+type ResponseSchema struct {
+	Destination string              `json:"destination,omitempty"`
+	Path        string              `json:"path,omitempty"`
+	Method      string              `json:"method,omitempty"`
+	Status      int                 `json:"status,omitempty"`
+	Headers     map[string][]string `json:"headers,omitempty"`
+	Schema      *Schema             `json:"schema"`
+
+	destination *regexp.Regexp
+	path        *regexp.Regexp
+}
+
+type responseSchemas struct {
+	Data []ResponseSchema `json:"data"`
+}
+
+// compile - compiles destination and path expressions once, so they aren't compiled for every request
+func (rs *ResponseSchema) compile() error {
+	var err error
+	if rs.destination, err = regexp.Compile(rs.Destination); err != nil {
+		return fmt.Errorf("invalid regular expression '%s': %s", rs.Destination, err.Error())
+	}
+	if rs.path, err = regexp.Compile(rs.Path); err != nil {
+		return fmt.Errorf("invalid regular expression '%s': %s", rs.Path, err.Error())
+	}
+	return nil
+}
+
+// Validate - checks whether response schema can be used
+func (rs *ResponseSchema) Validate() error {
+	if err := rs.compile(); err != nil {
+		return err
+	}
+	if rs.Schema == nil {
+		return fmt.Errorf("schema not specified")
+	}
+	return rs.Schema.Validate()
+}
+
+// matches - checks whether response schema is applicable for request
+func (rs *ResponseSchema) matches(request RequestDetails) bool {
+	if rs.Method != "" && rs.Method != request.Method {
+		return false
+	}
+	// schemas with invalid expressions never match
+	if rs.Destination != "" && (rs.destination == nil || !rs.destination.MatchString(request.Destination)) {
+		return false
+	}
+	if rs.Path != "" && (rs.path == nil || !rs.path.MatchString(request.Path)) {
+		return false
+	}
+	return true
+}
+
+// generateResponse - generates response from first schema matching the request
+func generateResponse(schemas []ResponseSchema, f *Faker, request RequestDetails) (*ResponseDetails, error) {
+	if f == nil {
+		f, _ = NewFaker(0, DefaultFakeLocale)
+	}
+	for i := range schemas {
+		rs := &schemas[i]
+		if !rs.matches(request) {
+			continue
+		}
+
+		body, err := json.Marshal(rs.Schema.Generate(f))
+		if err != nil {
+			return nil, err
+		}
+
+		headers := copyHeaders(rs.Headers)
+		if headers.Get("Content-Type") == "" {
+			headers.Set("Content-Type", "application/json")
+		}
+
+		status := rs.Status
+		if status == 0 {
+			status = 200
+		}
+		return &ResponseDetails{Status: status, Body: string(body), Headers: headers}, nil
+	}
+	return nil, fmt.Errorf("no response schema matches request")
+}
+
+// LoadResponseSchemas - reads response schemas from given JSON file
+func LoadResponseSchemas(path string) ([]ResponseSchema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Got error while opening response schemas file, error %s", err.Error())
+	}
+	defer f.Close()
+
+	var schemas responseSchemas
+	if err := json.NewDecoder(f).Decode(&schemas); err != nil {
+		return nil, fmt.Errorf("Got error while parsing response schemas file, error %s", err.Error())
+	}
+
+	for i := range schemas.Data {
+		if err := schemas.Data[i].Validate(); err != nil {
+			return nil, fmt.Errorf("Response schema %d is not valid: %s", i, err.Error())
+		}
+	}
+	return schemas.Data, nil
+}
@@ -0,0 +1,121 @@
+package hoverfly
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func testSchema() *Schema {
+	min, max := 2, 2
+	minimum, maximum := 18.0, 99.0
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"id":     {Type: "string", Format: "uuid"},
+			"email":  {Type: "string", Format: "email"},
+			"age":    {Type: "integer", Minimum: &minimum, Maximum: &maximum},
+			"active": {Type: "boolean"},
+			"role":   {Type: "string", Enum: []interface{}{"admin"}},
+			"tags":   {Type: "array", Items: &Schema{Type: "string"}, MinItems: &min, MaxItems: &max},
+		},
+	}
+}
+
+func TestSchemaGenerate(t *testing.T) {
+	f, _ := NewFaker(5, "")
+
+	schema := testSchema()
+	expect(t, schema.Validate(), nil)
+
+	value := schema.Generate(f).(map[string]interface{})
+	expect(t, len(value), 6)
+	expect(t, regexp.MustCompile(`@`).MatchString(value["email"].(string)), true)
+	age := value["age"].(int)
+	expect(t, age >= 18 && age <= 99, true)
+	expect(t, value["role"], "admin")
+	expect(t, len(value["tags"].([]interface{})), 2)
+
+	// same seed generates the same document
+	other, _ := NewFaker(5, "")
+	a, _ := json.Marshal(value)
+	b, _ := json.Marshal(testSchema().Generate(other))
+	expect(t, string(a), string(b))
+}
+
+func TestSchemaValidate(t *testing.T) {
+	refute(t, (&Schema{Type: "date"}).Validate(), nil)
+	refute(t, (&Schema{Type: "array"}).Validate(), nil)
+	refute(t, (&Schema{Type: "string", Format: "nope"}).Validate(), nil)
+	refute(t, (&ResponseSchema{Path: "("}).Validate(), nil)
+	refute(t, (&ResponseSchema{}).Validate(), nil)
+
+	negative, empty := -3, -1
+	refute(t, (&Schema{Type: "array", Items: &Schema{Type: "string"}, MinItems: &negative, MaxItems: &empty}).Validate(), nil)
+
+	minimum, maximum := 0.5, 0.7
+	refute(t, (&Schema{Type: "integer", Minimum: &minimum, Maximum: &maximum}).Validate(), nil)
+	expect(t, (&Schema{Type: "number", Minimum: &minimum, Maximum: &maximum}).Validate(), nil)
+}
+
+func TestSchemaGenerateBounds(t *testing.T) {
+	f, _ := NewFaker(5, "")
+
+	// not validated schemas don't panic
+	negative := -3
+	items := (&Schema{Type: "array", Items: &Schema{Type: "string"}, MinItems: &negative, MaxItems: &negative}).Generate(f)
+	expect(t, len(items.([]interface{})), 0)
+
+	maximum := -10.0
+	value := (&Schema{Type: "integer", Maximum: &maximum}).Generate(f).(int)
+	expect(t, value <= -10, true)
+}
+
+func TestSynthesizeFromResponseSchemas(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	dbClient.Faker, _ = NewFaker(9, "fr_FR")
+	dbClient.Cfg.SetResponseSchemas([]ResponseSchema{
+		{Path: "^/users/", Method: "GET", Schema: testSchema()},
+	})
+
+	req, _ := http.NewRequest("GET", "http://schema.com/users/1", nil)
+	response, err := dbClient.synthesizeResponse(req)
+	expect(t, err, nil)
+	expect(t, response.StatusCode, 200)
+	expect(t, response.Header.Get("Content-Type"), "application/json")
+
+	var body map[string]interface{}
+	err = json.NewDecoder(response.Body).Decode(&body)
+	expect(t, err, nil)
+	expect(t, body["role"], "admin")
+
+	req, _ = http.NewRequest("POST", "http://schema.com/users/1", nil)
+	_, err = dbClient.synthesizeResponse(req)
+	refute(t, err, nil)
+}
+
+func TestSetResponseSchemasHandler(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+
+	m := getBoneRouter(*dbClient)
+
+	body := `{"data": [{"path": "/users", "schema": {"type": "object", "properties": {"name": {"type": "string", "format": "name"}}}}]}`
+	req, err := http.NewRequest("POST", "/response-schemas", bytes.NewBufferString(body))
+	expect(t, err, nil)
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+	expect(t, len(dbClient.Cfg.GetResponseSchemas()), 1)
+
+	req, err = http.NewRequest("POST", "/response-schemas", bytes.NewBufferString(`{"data": [{"schema": {"type": "date"}}]}`))
+	expect(t, err, nil)
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusBadRequest)
+}
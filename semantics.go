@@ -0,0 +1,224 @@
+package hoverfly
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// headers that describe the representation and should not be sent with 304 Not Modified responses
+var notModifiedDroppedHeaders = []string{"Content-Length", "Content-Type", "Content-Range", "Content-Encoding"}
+
+// ApplyHTTPSemantics - adjusts payload response based on original request semantics: conditional
+// requests (If-None-Match, If-Modified-Since) get 304 Not Modified, Range requests get 206 Partial Content
+// and HEAD requests get headers only.
+func (c *Constructor) ApplyHTTPSemantics() {
+	method := c.request.Method
+
+	if method != "GET" && method != "HEAD" {
+		return
+	}
+
+	if c.payload.Response.Status == http.StatusOK {
+		if isNotModified(c.request.Header, http.Header(c.payload.Response.Headers)) {
+			c.notModified()
+		} else if rangeHeader := c.request.Header.Get("Range"); rangeHeader != "" {
+			if ifRangeMatches(c.request.Header.Get("If-Range"), http.Header(c.payload.Response.Headers)) {
+				c.partialContent(rangeHeader)
+			}
+		}
+	}
+
+	if method == "HEAD" {
+		headers := copyHeaders(c.payload.Response.Headers)
+		if headers.Get("Content-Length") == "" && c.payload.Response.Status != http.StatusNotModified {
+			headers.Set("Content-Length", strconv.FormatInt(c.bodyLength(), 10))
+		}
+		c.payload.Response.Headers = headers
+		c.payload.Response.Body = ""
+		c.payload.Response.BodyFile = ""
+		c.closeBody()
+	}
+}
+
+// notModified changes payload response to 304 Not Modified
+func (c *Constructor) notModified() {
+	headers := copyHeaders(c.payload.Response.Headers)
+	for _, h := range notModifiedDroppedHeaders {
+		headers.Del(h)
+	}
+
+	log.WithFields(log.Fields{
+		"path":        c.request.URL.Path,
+		"destination": c.request.Host,
+		"etag":        headers.Get("ETag"),
+	}).Debug("conditional request matched, returning 304")
+
+	c.payload.Response.Status = http.StatusNotModified
+	c.payload.Response.Headers = headers
+	c.payload.Response.Body = ""
+	c.payload.Response.BodyFile = ""
+	c.closeBody()
+}
+
+// partialContent changes payload response to 206 Partial Content or, if requested range can't be
+// satisfied, to 416 Requested Range Not Satisfiable
+func (c *Constructor) partialContent(rangeHeader string) {
+	size := c.bodyLength()
+	start, end, err := parseRange(rangeHeader, size)
+
+	if err == errMultipleRanges {
+		// multiple ranges are not supported, full body is a valid response
+		return
+	}
+
+	headers := copyHeaders(c.payload.Response.Headers)
+	headers.Del("Content-Length")
+
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+			"range": rangeHeader,
+			"size":  size,
+		}).Debug("requested range not satisfiable")
+
+		headers.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		c.payload.Response.Status = http.StatusRequestedRangeNotSatisfiable
+		c.payload.Response.Headers = headers
+		c.payload.Response.Body = ""
+		c.payload.Response.BodyFile = ""
+		c.closeBody()
+		return
+	}
+
+	headers.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	c.payload.Response.Status = http.StatusPartialContent
+	c.payload.Response.Headers = headers
+	if c.body != nil {
+		c.body = sectionBody{io.NewSectionReader(c.body, start, end-start+1), c.body}
+		c.bodySize = end - start + 1
+		return
+	}
+	c.payload.Response.Body = c.payload.Response.Body[start : end+1]
+}
+
+var errMultipleRanges = fmt.Errorf("multiple ranges are not supported")
+
+// parseRange - parses single "bytes=" range and returns inclusive start and end positions
+func parseRange(s string, size int64) (start, end int64, err error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return 0, 0, fmt.Errorf("invalid range unit: %s", s)
+	}
+	spec := strings.TrimSpace(s[len(prefix):])
+	if strings.Contains(spec, ",") {
+		return 0, 0, errMultipleRanges
+	}
+
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("invalid range: %s", s)
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	if first == "" {
+		// suffix range, last N bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, fmt.Errorf("invalid suffix range: %s", s)
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, fmt.Errorf("range start out of bounds: %s", s)
+	}
+
+	if last == "" {
+		return start, size - 1, nil
+	}
+
+	end, err = strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid range end: %s", s)
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return start, end, nil
+}
+
+// isNotModified - checks conditional request headers against stored ETag and Last-Modified,
+// If-None-Match takes precedence over If-Modified-Since
+func isNotModified(reqHeaders, respHeaders http.Header) bool {
+	if inm := reqHeaders.Get("If-None-Match"); inm != "" {
+		etag := respHeaders.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakETag(candidate) == weakETag(etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := reqHeaders.Get("If-Modified-Since"); ims != "" {
+		lastModified := respHeaders.Get("Last-Modified")
+		if lastModified == "" {
+			return false
+		}
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		modified, err := http.ParseTime(lastModified)
+		if err != nil {
+			return false
+		}
+		return !modified.Truncate(time.Second).After(since)
+	}
+
+	return false
+}
+
+// ifRangeMatches - returns true when range should be applied, either because there is no If-Range
+// validator or because it matches stored ETag/Last-Modified
+func ifRangeMatches(ifRange string, respHeaders http.Header) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		// strong comparison is required for If-Range
+		etag := respHeaders.Get("ETag")
+		return etag != "" && !strings.HasPrefix(etag, "W/") && etag == ifRange
+	}
+	return respHeaders.Get("Last-Modified") == ifRange
+}
+
+// weakETag - strips weak validator prefix for weak comparison
+func weakETag(etag string) string {
+	return strings.TrimPrefix(etag, "W/")
+}
+
+// copyHeaders - returns a copy of given headers so stored payloads are never modified in place
+func copyHeaders(headers map[string][]string) http.Header {
+	h := make(http.Header)
+	for k, values := range headers {
+		for _, v := range values {
+			h.Add(k, v)
+		}
+	}
+	return h
+}
@@ -0,0 +1,150 @@
+package hoverfly
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func getSemanticsPayload() Payload {
+	headers := make(map[string][]string)
+	headers["Content-Type"] = []string{"text/plain"}
+	headers["Etag"] = []string{`"abc123"`}
+	headers["Last-Modified"] = []string{"Tue, 01 Dec 2015 16:49:08 GMT"}
+
+	return Payload{
+		Request: RequestDetails{
+			Path:        "/file",
+			Method:      "GET",
+			Destination: "semantics.com",
+		},
+		Response: ResponseDetails{
+			Status:  200,
+			Body:    "0123456789",
+			Headers: headers,
+		},
+	}
+}
+
+func TestHeadAnsweredFromGetPayload(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	err := dbClient.ImportPayloads([]Payload{getSemanticsPayload()})
+	expect(t, err, nil)
+
+	req, err := http.NewRequest("HEAD", "http://semantics.com/file", nil)
+	expect(t, err, nil)
+
+	response := dbClient.getResponse(req)
+
+	expect(t, response.StatusCode, http.StatusOK)
+	expect(t, response.Header.Get("Content-Length"), "10")
+	expect(t, response.Header.Get("Content-Type"), "text/plain")
+
+	body, err := ioutil.ReadAll(response.Body)
+	expect(t, err, nil)
+	expect(t, string(body), "")
+}
+
+func TestRangeRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://semantics.com/file", nil)
+	req.Header.Set("Range", "bytes=2-5")
+
+	c := NewConstructor(req, getSemanticsPayload())
+	c.ApplyHTTPSemantics()
+	response := c.ReconstructResponse()
+
+	expect(t, response.StatusCode, http.StatusPartialContent)
+	expect(t, response.Header.Get("Content-Range"), "bytes 2-5/10")
+
+	body, err := ioutil.ReadAll(response.Body)
+	expect(t, err, nil)
+	expect(t, string(body), "2345")
+}
+
+func TestRangeRequestSuffix(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://semantics.com/file", nil)
+	req.Header.Set("Range", "bytes=-3")
+
+	c := NewConstructor(req, getSemanticsPayload())
+	c.ApplyHTTPSemantics()
+
+	expect(t, c.payload.Response.Status, http.StatusPartialContent)
+	expect(t, c.payload.Response.Body, "789")
+}
+
+func TestRangeRequestNotSatisfiable(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://semantics.com/file", nil)
+	req.Header.Set("Range", "bytes=20-30")
+
+	c := NewConstructor(req, getSemanticsPayload())
+	c.ApplyHTTPSemantics()
+
+	expect(t, c.payload.Response.Status, http.StatusRequestedRangeNotSatisfiable)
+	expect(t, http.Header(c.payload.Response.Headers).Get("Content-Range"), "bytes */10")
+}
+
+func TestRangeRequestIfRangeMismatch(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://semantics.com/file", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	req.Header.Set("If-Range", `"outdated"`)
+
+	c := NewConstructor(req, getSemanticsPayload())
+	c.ApplyHTTPSemantics()
+
+	expect(t, c.payload.Response.Status, http.StatusOK)
+	expect(t, c.payload.Response.Body, "0123456789")
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://semantics.com/file", nil)
+	req.Header.Set("If-None-Match", `"other", W/"abc123"`)
+
+	c := NewConstructor(req, getSemanticsPayload())
+	c.ApplyHTTPSemantics()
+
+	expect(t, c.payload.Response.Status, http.StatusNotModified)
+	expect(t, c.payload.Response.Body, "")
+	expect(t, http.Header(c.payload.Response.Headers).Get("Content-Type"), "")
+	expect(t, http.Header(c.payload.Response.Headers).Get("Etag"), `"abc123"`)
+}
+
+func TestIfNoneMatchMismatch(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://semantics.com/file", nil)
+	req.Header.Set("If-None-Match", `"other"`)
+
+	c := NewConstructor(req, getSemanticsPayload())
+	c.ApplyHTTPSemantics()
+
+	expect(t, c.payload.Response.Status, http.StatusOK)
+}
+
+func TestIfModifiedSince(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://semantics.com/file", nil)
+	req.Header.Set("If-Modified-Since", "Wed, 02 Dec 2015 10:00:00 GMT")
+
+	c := NewConstructor(req, getSemanticsPayload())
+	c.ApplyHTTPSemantics()
+
+	expect(t, c.payload.Response.Status, http.StatusNotModified)
+
+	req.Header.Set("If-Modified-Since", "Mon, 30 Nov 2015 10:00:00 GMT")
+
+	c = NewConstructor(req, getSemanticsPayload())
+	c.ApplyHTTPSemantics()
+
+	expect(t, c.payload.Response.Status, http.StatusOK)
+}
+
+func TestSemanticsIgnoredForPost(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://semantics.com/file", nil)
+	req.Header.Set("Range", "bytes=2-5")
+
+	c := NewConstructor(req, getSemanticsPayload())
+	c.ApplyHTTPSemantics()
+
+	expect(t, c.payload.Response.Status, http.StatusOK)
+	expect(t, c.payload.Response.Body, "0123456789")
+}
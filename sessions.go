@@ -0,0 +1,253 @@
+package hoverfly
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultMaxSessions - how many simulated sessions are kept, least recently seen sessions are dropped first
+const DefaultMaxSessions = 10000
+
+// SimulatedSession - session cookies Hoverfly issued to one client in virtualize mode. Recorded values of session
+// cookies are replaced with fresh ones, so clients don't share recorded sessions, and fresh values sent back by
+// the client are replaced with the recorded ones before matching.
+type SimulatedSession struct {
+	ID string `json:"id"`
+	// Recorded - recorded values of session cookies by name
+	Recorded map[string]string `json:"recorded"`
+	// Issued - values issued to the client by name
+	Issued   map[string]string `json:"issued"`
+	Created  time.Time         `json:"created"`
+	LastSeen time.Time         `json:"lastSeen"`
+}
+
+type sessionsResponse struct {
+	Data []SimulatedSession `json:"data"`
+}
+
+// SessionStore - cookie jars of clients talking to Hoverfly in virtualize mode
+type SessionStore struct {
+	// Cookies - names of cookies identifying session, e.g. "JSESSIONID"
+	Cookies []string
+	// Match - payloads are matched on session identity, so each session gets responses recorded for it
+	Match       bool
+	MaxSessions int
+
+	mu       sync.Mutex
+	sessions map[string]*SimulatedSession
+	// issued - sessions by issued "name=value" cookie
+	issued map[string]*SimulatedSession
+}
+
+// NewSessionStore - returns session store for given session cookie names
+func NewSessionStore(cookies []string, match bool) *SessionStore {
+	names := append([]string{}, cookies...)
+	sort.Strings(names)
+	return &SessionStore{
+		Cookies:     names,
+		Match:       match,
+		MaxSessions: DefaultMaxSessions,
+		sessions:    make(map[string]*SimulatedSession),
+		issued:      make(map[string]*SimulatedSession),
+	}
+}
+
+func (s *SessionStore) isSessionCookie(name string) bool {
+	for _, c := range s.Cookies {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// requestCookies - parses Cookie headers
+func requestCookies(headers map[string][]string) []*http.Cookie {
+	req := http.Request{Header: http.Header(headers)}
+	return req.Cookies()
+}
+
+// identity - returns session identity of a request, recorded values of its session cookies. Identity is empty
+// when payloads aren't matched on sessions.
+func (s *SessionStore) identity(headers map[string][]string) string {
+	if s == nil || !s.Match {
+		return ""
+	}
+
+	values := make(map[string]string)
+	for _, c := range requestCookies(headers) {
+		values[c.Name] = c.Value
+	}
+
+	var parts []string
+	for _, name := range s.Cookies {
+		if v, ok := values[name]; ok {
+			parts = append(parts, name+"="+v)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// resolve - finds client session by cookies Hoverfly issued, returns request headers with issued values replaced by
+// recorded ones. Session is nil when client hasn't got one yet.
+func (s *SessionStore) resolve(headers map[string][]string) (*SimulatedSession, map[string][]string) {
+	if s == nil {
+		return nil, headers
+	}
+	cookies := requestCookies(headers)
+	if len(cookies) == 0 {
+		return nil, headers
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var session *SimulatedSession
+	translated := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		if sess, ok := s.issued[c.Name+"="+c.Value]; ok {
+			session = sess
+			c.Value = sess.Recorded[c.Name]
+		}
+		translated = append(translated, c.Name+"="+c.Value)
+	}
+	if session == nil {
+		return nil, headers
+	}
+	session.LastSeen = time.Now()
+
+	resolved := copyHeaders(headers)
+	resolved.Set("Cookie", strings.Join(translated, "; "))
+	return session, resolved
+}
+
+// issue - replaces session cookies set by response with fresh values and remembers them in client session,
+// session is created when client hasn't got one yet. Other cookies are returned as recorded.
+func (s *SessionStore) issue(session *SimulatedSession, headers http.Header) *SimulatedSession {
+	if s == nil || len(headers["Set-Cookie"]) == 0 {
+		return session
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	setCookies := make([]string, 0, len(headers["Set-Cookie"]))
+	for _, line := range headers["Set-Cookie"] {
+		resp := http.Response{Header: http.Header{"Set-Cookie": {line}}}
+		parsed := resp.Cookies()
+		if len(parsed) != 1 || !s.isSessionCookie(parsed[0].Name) {
+			setCookies = append(setCookies, line)
+			continue
+		}
+		c := parsed[0]
+
+		if session == nil {
+			session = s.newSession()
+		}
+		if old, ok := session.Issued[c.Name]; ok {
+			delete(s.issued, c.Name+"="+old)
+		}
+
+		// cookie removal is passed to the client as recorded
+		if c.MaxAge < 0 || c.Value == "" || (!c.Expires.IsZero() && c.Expires.Unix() <= 0) {
+			delete(session.Recorded, c.Name)
+			delete(session.Issued, c.Name)
+			setCookies = append(setCookies, line)
+			continue
+		}
+
+		value := randomToken()
+		session.Recorded[c.Name] = c.Value
+		session.Issued[c.Name] = value
+		s.issued[c.Name+"="+value] = session
+
+		c.Value = value
+		setCookies = append(setCookies, c.String())
+
+		log.WithFields(log.Fields{
+			"session": session.ID,
+			"cookie":  c.Name,
+		}).Debug("issued session cookie")
+	}
+	headers["Set-Cookie"] = setCookies
+	return session
+}
+
+func (s *SessionStore) newSession() *SimulatedSession {
+	if len(s.sessions) >= s.MaxSessions {
+		s.evict()
+	}
+	now := time.Now()
+	session := &SimulatedSession{
+		ID:       randomToken(),
+		Recorded: make(map[string]string),
+		Issued:   make(map[string]string),
+		Created:  now,
+		LastSeen: now,
+	}
+	s.sessions[session.ID] = session
+	return session
+}
+
+// evict - drops least recently seen session
+func (s *SessionStore) evict() {
+	var oldest *SimulatedSession
+	for _, session := range s.sessions {
+		if oldest == nil || session.LastSeen.Before(oldest.LastSeen) {
+			oldest = session
+		}
+	}
+	if oldest == nil {
+		return
+	}
+	for name, value := range oldest.Issued {
+		delete(s.issued, name+"="+value)
+	}
+	delete(s.sessions, oldest.ID)
+}
+
+// Sessions - returns copies of current sessions, oldest first
+func (s *SessionStore) Sessions() []SimulatedSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]SimulatedSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		c := *session
+		c.Recorded = make(map[string]string, len(session.Recorded))
+		for k, v := range session.Recorded {
+			c.Recorded[k] = v
+		}
+		c.Issued = make(map[string]string, len(session.Issued))
+		for k, v := range session.Issued {
+			c.Issued[k] = v
+		}
+		sessions = append(sessions, c)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Created.Before(sessions[j].Created) })
+	return sessions
+}
+
+// Reset - removes all sessions, cookies issued before are no longer recognized
+func (s *SessionStore) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = make(map[string]*SimulatedSession)
+	s.issued = make(map[string]*SimulatedSession)
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
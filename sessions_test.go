@@ -0,0 +1,195 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func sessionPayloads() []Payload {
+	login := func(user, sid string) Payload {
+		return Payload{
+			Request: RequestDetails{Destination: "app.com", Path: "/login", Method: "POST", Body: "user=" + user},
+			Response: ResponseDetails{Status: 200, Headers: map[string][]string{
+				"Set-Cookie": {"sid=" + sid + "; Path=/; HttpOnly", "theme=dark"},
+			}},
+		}
+	}
+	profile := func(name, sid string) Payload {
+		return Payload{
+			Request: RequestDetails{Destination: "app.com", Path: "/profile", Method: "GET",
+				Headers: map[string][]string{"Cookie": {"sid=" + sid + "; theme=dark"}}},
+			Response: ResponseDetails{Status: 200, Body: name},
+		}
+	}
+	return []Payload{
+		login("alice", "recorded-a"),
+		login("bob", "recorded-b"),
+		profile("alice", "recorded-a"),
+		profile("bob", "recorded-b"),
+		{
+			Request:  RequestDetails{Destination: "app.com", Path: "/public", Method: "GET"},
+			Response: ResponseDetails{Status: 200, Body: "public"},
+		},
+	}
+}
+
+// sessionLogin - logs in and returns cookie issued by Hoverfly
+func sessionLogin(t *testing.T, dbClient *DBClient, user string) *http.Cookie {
+	req, _ := http.NewRequest("POST", "http://app.com/login", strings.NewReader("user="+user))
+	response := dbClient.getResponse(req)
+	expect(t, response.StatusCode, 200)
+
+	for _, c := range response.Cookies() {
+		if c.Name == "sid" {
+			return c
+		}
+	}
+	t.Fatal("session cookie not issued")
+	return nil
+}
+
+func sessionGet(dbClient *DBClient, path string, cookies ...*http.Cookie) (*http.Response, string) {
+	req, _ := http.NewRequest("GET", "http://app.com"+path, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	response := dbClient.getResponse(req)
+	body, _ := ioutil.ReadAll(response.Body)
+	return response, string(body)
+}
+
+func TestSessionCookiesAreIssuedPerClient(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Sessions = NewSessionStore([]string{"sid"}, false)
+	expect(t, dbClient.ImportPayloads(sessionPayloads()), nil)
+
+	first := sessionLogin(t, dbClient, "alice")
+	second := sessionLogin(t, dbClient, "alice")
+
+	refute(t, first.Value, "recorded-a")
+	refute(t, first.Value, second.Value)
+	expect(t, first.Path, "/")
+	expect(t, first.HttpOnly, true)
+	expect(t, len(dbClient.Sessions.Sessions()), 2)
+
+	// other cookies are replayed as recorded
+	req, _ := http.NewRequest("POST", "http://app.com/login", strings.NewReader("user=alice"))
+	response := dbClient.getResponse(req)
+	expect(t, response.Header["Set-Cookie"][1], "theme=dark")
+
+	// client keeps its session when cookie is set again
+	req, _ = http.NewRequest("POST", "http://app.com/login", strings.NewReader("user=alice"))
+	req.AddCookie(first)
+	dbClient.getResponse(req)
+	expect(t, len(dbClient.Sessions.Sessions()), 3)
+}
+
+func TestSessionMatching(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Sessions = NewSessionStore([]string{"sid"}, true)
+	expect(t, dbClient.ImportPayloads(sessionPayloads()), nil)
+
+	alice := sessionLogin(t, dbClient, "alice")
+	bob := sessionLogin(t, dbClient, "bob")
+
+	_, body := sessionGet(dbClient, "/profile", alice, &http.Cookie{Name: "theme", Value: "dark"})
+	expect(t, body, "alice")
+	_, body = sessionGet(dbClient, "/profile", bob)
+	expect(t, body, "bob")
+
+	// payloads without session are shared
+	_, body = sessionGet(dbClient, "/public", alice)
+	expect(t, body, "public")
+
+	// without session cookie
+	response, _ := sessionGet(dbClient, "/profile")
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+
+	// sessions are forgotten after reset
+	dbClient.Sessions.Reset()
+	response, _ = sessionGet(dbClient, "/profile", alice)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+}
+
+func TestSessionCookieRemoval(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Sessions = NewSessionStore([]string{"sid"}, true)
+	payloads := append(sessionPayloads(), Payload{
+		Request: RequestDetails{Destination: "app.com", Path: "/logout", Method: "GET",
+			Headers: map[string][]string{"Cookie": {"sid=recorded-a"}}},
+		Response: ResponseDetails{Status: 200, Headers: map[string][]string{
+			"Set-Cookie": {"sid=; Path=/; Max-Age=0"},
+		}},
+	})
+	expect(t, dbClient.ImportPayloads(payloads), nil)
+
+	alice := sessionLogin(t, dbClient, "alice")
+	response, _ := sessionGet(dbClient, "/logout", alice)
+	expect(t, response.Header.Get("Set-Cookie"), "sid=; Path=/; Max-Age=0")
+
+	response, _ = sessionGet(dbClient, "/profile", alice)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+}
+
+func TestCaptureSessionIdentity(t *testing.T) {
+	server, dbClient := testTools(200, `{"message": "here"}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Sessions = NewSessionStore([]string{"sid", "JSESSIONID"}, true)
+
+	req, _ := http.NewRequest("GET", "http://app.com/profile", nil)
+	req.Header.Set("Cookie", "theme=dark; sid=abc")
+	dbClient.captureRequest(req)
+
+	payloads, err := dbClient.Cache.GetAllRequests()
+	expect(t, err, nil)
+	expect(t, len(payloads), 1)
+	expect(t, payloads[0].Request.Session, "sid=abc")
+
+	// recorded session is matched when client sends recorded cookie
+	_, body := sessionGet(dbClient, "/profile", &http.Cookie{Name: "sid", Value: "abc"})
+	expect(t, body, "{\"message\": \"here\"}\n")
+}
+
+func TestSessionsHandler(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Sessions = NewSessionStore([]string{"sid"}, false)
+	expect(t, dbClient.ImportPayloads(sessionPayloads()), nil)
+	issued := sessionLogin(t, dbClient, "bob")
+
+	m := getBoneRouter(*dbClient)
+
+	req, _ := http.NewRequest("GET", "/sessions", nil)
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+
+	var sr sessionsResponse
+	expect(t, json.Unmarshal(rec.Body.Bytes(), &sr), nil)
+	expect(t, len(sr.Data), 1)
+	expect(t, sr.Data[0].Recorded["sid"], "recorded-b")
+	expect(t, sr.Data[0].Issued["sid"], issued.Value)
+
+	req, _ = http.NewRequest("DELETE", "/sessions", nil)
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	expect(t, rec.Code, http.StatusOK)
+	expect(t, len(dbClient.Sessions.Sessions()), 0)
+}
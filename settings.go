@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 )
@@ -21,6 +22,75 @@ type Configuration struct {
 	SecretKey          []byte
 	JWTExpirationDelta int
 	AuthEnabled        bool
+	ErrorTemplates     []ErrorTemplate
+	TracingEndpoint    string
+	TracingServiceName string
+
+	// AccessLog - access log file path, empty disables access logging
+	AccessLog       string
+	AccessLogFormat string
+	// AccessLogMaxSize - size in megabytes after which access log is rotated
+	AccessLogMaxSize     int
+	AccessLogRotateEvery time.Duration
+	AccessLogMaxBackups  int
+	AccessLogMaxAge      time.Duration
+
+	// metric exporters, disabled when address is empty
+	StatsDAddress        string
+	GraphiteAddress      string
+	MetricsPrefix        string
+	MetricsFlushInterval time.Duration
+
+	// hook delivery, hooks are called synchronously in the request path when HooksSync is true
+	HooksSync      bool
+	HookQueueSize  int
+	HookRetries    int
+	HookRetryDelay time.Duration
+
+	// FuzzSeed - seed for choosing fuzz mutations, 0 picks random seed
+	FuzzSeed int64
+	// FuzzMutations - mutations applied in fuzz mode, empty enables all
+	FuzzMutations []string
+
+	// fake data used by templates and response schemas, FakeSeed 0 picks random seed
+	FakeSeed        int64
+	FakeLocale      string
+	ResponseSchemas []ResponseSchema
+
+	// BodyFilesDir - simulation directory, body files referenced by payloads are relative to it
+	BodyFilesDir string
+	// BodyBlobThreshold - captured response bodies larger than this (in bytes) are stored as blobs, 0 disables
+	BodyBlobThreshold int
+
+	// StaticRules - local directories served for matching destinations
+	StaticRules []StaticRule
+	// StaticRoot - directory static rules supplied through the admin API are confined to, empty disables them
+	StaticRoot string
+
+	// SessionCookies - names of cookies identifying client sessions in virtualize mode, empty disables sessions
+	SessionCookies []string
+	// SessionMatching - payloads are matched on session identity
+	SessionMatching bool
+
+	// WASM middleware limits, WASMMemoryLimit is in megabytes
+	WASMMemoryLimit int
+	WASMTimeout     time.Duration
+	WASMPoolSize    int
+
+	// ReplicationLogSize - how many changes of records are kept for replicas, 0 disables replication log
+	ReplicationLogSize int
+	// ReplicateFrom - admin API URL of instance to pull simulation from
+	ReplicateFrom string
+	// ReplicateTo - admin API URLs of instances simulation changes are pushed to
+	ReplicateTo []string
+
+	// Registry - URL of simulation registry simulations are published to and imported from by name:version
+	Registry string
+	// RegistryCacheDir - directory verified simulation bundles fetched from registry are cached in
+	RegistryCacheDir string
+
+	// Locked - records and mode can't be changed through the admin API until an admin unlocks them
+	Locked bool
 
 	mu sync.Mutex
 }
@@ -40,6 +110,84 @@ func (c *Configuration) GetMode() (mode string) {
 	return
 }
 
+// SetErrorTemplates - provides safe way to replace error templates
+func (c *Configuration) SetErrorTemplates(templates []ErrorTemplate) {
+	for i := range templates {
+		templates[i].compile()
+	}
+	c.mu.Lock()
+	c.ErrorTemplates = templates
+	c.mu.Unlock()
+}
+
+// GetErrorTemplates - provides safe way to get current error templates
+func (c *Configuration) GetErrorTemplates() (templates []ErrorTemplate) {
+	c.mu.Lock()
+	templates = c.ErrorTemplates
+	c.mu.Unlock()
+	return
+}
+
+// SetResponseSchemas - provides safe way to replace response schemas
+func (c *Configuration) SetResponseSchemas(schemas []ResponseSchema) {
+	for i := range schemas {
+		schemas[i].compile()
+	}
+	c.mu.Lock()
+	c.ResponseSchemas = schemas
+	c.mu.Unlock()
+}
+
+// GetResponseSchemas - provides safe way to get current response schemas
+func (c *Configuration) GetResponseSchemas() (schemas []ResponseSchema) {
+	c.mu.Lock()
+	schemas = c.ResponseSchemas
+	c.mu.Unlock()
+	return
+}
+
+// SetStaticRules - provides safe way to replace static directory rules
+func (c *Configuration) SetStaticRules(rules []StaticRule) {
+	for i := range rules {
+		rules[i].compile()
+	}
+	c.mu.Lock()
+	c.StaticRules = rules
+	c.mu.Unlock()
+}
+
+// GetStaticRules - provides safe way to get current static directory rules
+func (c *Configuration) GetStaticRules() (rules []StaticRule) {
+	c.mu.Lock()
+	rules = c.StaticRules
+	c.mu.Unlock()
+	return
+}
+
+// SetLocked - provides safe way to lock or unlock records and mode
+func (c *Configuration) SetLocked(locked bool) {
+	c.mu.Lock()
+	c.Locked = locked
+	c.mu.Unlock()
+}
+
+// IsLocked - provides safe way to check whether records and mode are locked
+func (c *Configuration) IsLocked() (locked bool) {
+	c.mu.Lock()
+	locked = c.Locked
+	c.mu.Unlock()
+	return
+}
+
+// WASMLimits - returns limits of WASM middleware instances
+func (c *Configuration) WASMLimits() WASMLimits {
+	return WASMLimits{
+		MemoryPages: uint32(c.WASMMemoryLimit * 1024 * 1024 / wasmPageSize),
+		Timeout:     c.WASMTimeout,
+		PoolSize:    c.WASMPoolSize,
+	}.withDefaults()
+}
+
 // DefaultPort - default proxy port
 const DefaultPort = "8500"
 
@@ -64,6 +212,16 @@ const (
 
 	HoverflyDBEV         = "HoverflyDB"
 	HoverflyMiddlewareEV = "HoverflyMiddleware"
+
+	HoverflyTracingEndpointEV    = "HoverflyTracingEndpoint"
+	HoverflyTracingServiceNameEV = "HoverflyTracingServiceName"
+
+	HoverflyAccessLogEV       = "HoverflyAccessLog"
+	HoverflyAccessLogFormatEV = "HoverflyAccessLogFormat"
+
+	HoverflyStatsDEV        = "HoverflyStatsD"
+	HoverflyGraphiteEV      = "HoverflyGraphite"
+	HoverflyMetricsPrefixEV = "HoverflyMetricsPrefix"
 )
 
 // InitSettings gets and returns initial configuration from env
@@ -122,5 +280,34 @@ func InitSettings() *Configuration {
 	// middleware configuration
 	appConfig.Middleware = os.Getenv(HoverflyMiddlewareEV)
 
+	// tracing is enabled when OTLP/HTTP endpoint is provided
+	appConfig.TracingEndpoint = os.Getenv(HoverflyTracingEndpointEV)
+	appConfig.TracingServiceName = os.Getenv(HoverflyTracingServiceNameEV)
+	if appConfig.TracingServiceName == "" {
+		appConfig.TracingServiceName = DefaultTracingServiceName
+	}
+
+	// access log is disabled unless path is provided
+	appConfig.AccessLog = os.Getenv(HoverflyAccessLogEV)
+	appConfig.AccessLogFormat = os.Getenv(HoverflyAccessLogFormatEV)
+	if appConfig.AccessLogFormat == "" {
+		appConfig.AccessLogFormat = AccessLogCombined
+	}
+
+	// metric exporters
+	appConfig.StatsDAddress = os.Getenv(HoverflyStatsDEV)
+	appConfig.GraphiteAddress = os.Getenv(HoverflyGraphiteEV)
+	appConfig.MetricsPrefix = os.Getenv(HoverflyMetricsPrefixEV)
+	if appConfig.MetricsPrefix == "" {
+		appConfig.MetricsPrefix = DefaultMetricsPrefix
+	}
+	appConfig.MetricsFlushInterval = DefaultMetricsFlushInterval
+
+	appConfig.HookQueueSize = DefaultHookQueueSize
+	appConfig.HookRetries = DefaultHookRetries
+	appConfig.HookRetryDelay = DefaultHookRetryDelay
+
+	appConfig.ReplicationLogSize = DefaultReplicationLogSize
+
 	return &appConfig
 }
@@ -0,0 +1,272 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DefaultStaticIndex - file served for directory requests when static rule doesn't set index
+const DefaultStaticIndex = "index.html"
+
+// StaticRule - serves files from local directory Dir for GET and HEAD requests matching Destination (regular
+// expression matched against request host, empty matches everything) and PathPrefix. Request path without
+// the prefix is the file path relative to Dir. Rules take precedence over recorded payloads unless Fallback is set,
+// fallback rules are only used when no payload matches the request.
+type StaticRule struct {
+	Destination string              `json:"destination"`
+	PathPrefix  string              `json:"pathPrefix"`
+	Dir         string              `json:"dir"`
+	Index       string              `json:"index,omitempty"`
+	Listing     bool                `json:"listing,omitempty"`
+	Headers     map[string][]string `json:"headers,omitempty"`
+	Fallback    bool                `json:"fallback,omitempty"`
+
+	destination *regexp.Regexp
+}
+
+type staticRules struct {
+	Data []StaticRule `json:"data"`
+}
+
+// compile - compiles destination expression once, so it isn't compiled for every request
+func (r *StaticRule) compile() error {
+	var err error
+	if r.destination, err = regexp.Compile(r.Destination); err != nil {
+		return fmt.Errorf("invalid destination regexp '%s': %s", r.Destination, err.Error())
+	}
+	return nil
+}
+
+// Validate - checks whether static rule can be used
+func (r *StaticRule) Validate() error {
+	if err := r.compile(); err != nil {
+		return err
+	}
+	if r.PathPrefix != "" && !strings.HasPrefix(r.PathPrefix, "/") {
+		return fmt.Errorf("path prefix '%s' must start with '/'", r.PathPrefix)
+	}
+	if strings.ContainsAny(r.Index, `/\`) {
+		return fmt.Errorf("index '%s' must be a file name", r.Index)
+	}
+	if r.Dir == "" {
+		return fmt.Errorf("directory not specified")
+	}
+	info, err := os.Stat(r.Dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("'%s' is not a directory", r.Dir)
+	}
+	return nil
+}
+
+// confine - resolves Dir against root (relative directories are relative to it) and checks it doesn't point
+// outside of root, symlinks included. Rules supplied through the admin API can only serve directories under root.
+func (r *StaticRule) confine(root string) error {
+	root, err := filepath.Abs(root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid static root: %s", err.Error())
+	}
+
+	dir := r.Dir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("directory '%s' is outside of static root", r.Dir)
+	}
+	r.Dir = dir
+	return nil
+}
+
+// matches - checks whether static rule is applicable for request host and path, prefix has to match whole
+// path segments, i.e. "/assets" matches "/assets/app.js" but not "/assets-v2/app.js"
+func (r *StaticRule) matches(host, urlPath string) bool {
+	// rules with invalid expression never match
+	if r.Destination != "" && (r.destination == nil || !r.destination.MatchString(host)) {
+		return false
+	}
+	prefix := strings.TrimSuffix(r.PathPrefix, "/")
+	return urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/")
+}
+
+func (r *StaticRule) index() string {
+	if r.Index == "" {
+		return DefaultStaticIndex
+	}
+	return r.Index
+}
+
+// serve - returns response with file requested by given path, error is returned when file doesn't exist
+func (r *StaticRule) serve(req *http.Request) (*http.Response, error) {
+	rel := strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(r.PathPrefix, "/")), "/")
+	p, err := NewBodyStore(r.Dir, nil).filePath(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewConstructor(req, Payload{Response: ResponseDetails{Status: http.StatusOK, Headers: copyHeaders(r.Headers)}})
+
+	if info.IsDir() {
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			// relative links in index have to resolve against the directory
+			location := req.URL.Path + "/"
+			if req.URL.RawQuery != "" {
+				location += "?" + req.URL.RawQuery
+			}
+			c.payload.Response.Status = http.StatusMovedPermanently
+			http.Header(c.payload.Response.Headers).Set("Location", location)
+			return c.ReconstructResponse(), nil
+		}
+
+		dir := p
+		p = filepath.Join(dir, r.index())
+		info, err = os.Stat(p)
+		if os.IsNotExist(err) && r.Listing {
+			return c.listing(dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("index '%s' is a directory", p)
+		}
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := http.Header(c.payload.Response.Headers)
+	headers.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	headers.Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	headers.Set("Accept-Ranges", "bytes")
+
+	c.setBody(f, info.Size(), p)
+	c.ApplyHTTPSemantics()
+	return c.ReconstructResponse(), nil
+}
+
+// listing - returns HTML page listing directory content
+func (c *Constructor) listing(dir string) (*http.Response, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html><head><title>Index of %s</title></head><body>\n<h1>Index of %s</h1>\n<ul>\n",
+		html.EscapeString(c.request.URL.Path), html.EscapeString(c.request.URL.Path))
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", link.String(), html.EscapeString(name))
+	}
+	b.WriteString("</ul>\n</body></html>\n")
+
+	http.Header(c.payload.Response.Headers).Set("Content-Type", "text/html; charset=utf-8")
+	c.payload.Response.Body = b.String()
+	c.ApplyHTTPSemantics()
+	return c.ReconstructResponse(), nil
+}
+
+// serveStatic - serves request from first matching static rule that has the file, fallback selects rules used
+// when no payload matches. Returns nil when request can't be served from static directories.
+func (d *DBClient) serveStatic(req *http.Request, details RequestDetails, fallback bool) *http.Response {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return nil
+	}
+
+	rules := d.Cfg.GetStaticRules()
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Fallback != fallback || !rule.matches(req.Host, req.URL.Path) {
+			continue
+		}
+
+		response, err := rule.serve(req)
+		if err != nil {
+			entry := log.WithFields(log.Fields{
+				"error":       err.Error(),
+				"dir":         rule.Dir,
+				"path":        req.URL.Path,
+				"destination": req.Host,
+			})
+			if os.IsNotExist(err) {
+				entry.Debug("file not found in static directory")
+			} else {
+				entry.Warn("failed to serve file from static directory")
+			}
+			continue
+		}
+
+		log.WithFields(log.Fields{
+			"dir":         rule.Dir,
+			"fallback":    rule.Fallback,
+			"path":        req.URL.Path,
+			"method":      req.Method,
+			"destination": req.Host,
+			"status":      response.StatusCode,
+			"bodyLength":  response.ContentLength,
+		}).Info("Static file found, returning")
+
+		served := ResponseDetails{Status: response.StatusCode, Headers: response.Header}
+		d.fireEvent(ActionTypeRequestServed, "static", EventData{
+			Request:  details,
+			Response: &served,
+			Matcher:  "static",
+		})
+		return response
+	}
+	return nil
+}
+
+// LoadStaticRules - reads static directory rules from given JSON file
+func LoadStaticRules(path string) ([]StaticRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Got error while opening static rules file, error %s", err.Error())
+	}
+	defer f.Close()
+
+	var rules staticRules
+	if err := json.NewDecoder(f).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("Got error while parsing static rules file, error %s", err.Error())
+	}
+
+	for i := range rules.Data {
+		if err := rules.Data[i].Validate(); err != nil {
+			return nil, fmt.Errorf("Static rule %d is not valid: %s", i, err.Error())
+		}
+	}
+	return rules.Data, nil
+}
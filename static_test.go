@@ -0,0 +1,207 @@
+package hoverfly
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func staticDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "hoverfly-static")
+	expect(t, err, nil)
+
+	files := map[string]string{
+		"app.js":          "console.log('app');",
+		"css/site.css":    "body { color: red; }",
+		"docs/index.html": "<h1>docs</h1>",
+		"images/logo.png": "png",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		expect(t, os.MkdirAll(filepath.Dir(p), 0700), nil)
+		expect(t, ioutil.WriteFile(p, []byte(content), 0600), nil)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func staticGet(dbClient *DBClient, url string, headers map[string]string) (*http.Response, string) {
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	response := dbClient.getResponse(req)
+	body, _ := ioutil.ReadAll(response.Body)
+	return response, string(body)
+}
+
+func TestServeStaticFiles(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dir, cleanup := staticDir(t)
+	defer cleanup()
+	dbClient.Cfg.SetStaticRules([]StaticRule{{Destination: "cdn.com", PathPrefix: "/assets", Dir: dir}})
+
+	response, body := staticGet(dbClient, "http://cdn.com/assets/css/site.css", nil)
+	expect(t, response.StatusCode, 200)
+	expect(t, body, "body { color: red; }")
+	expect(t, response.ContentLength, int64(len(body)))
+	expect(t, strings.HasPrefix(response.Header.Get("Content-Type"), "text/css"), true)
+	refute(t, response.Header.Get("ETag"), "")
+
+	// directory index
+	response, body = staticGet(dbClient, "http://cdn.com/assets/docs/", nil)
+	expect(t, response.StatusCode, 200)
+	expect(t, body, "<h1>docs</h1>")
+
+	response, _ = staticGet(dbClient, "http://cdn.com/assets/docs?v=1", nil)
+	expect(t, response.StatusCode, http.StatusMovedPermanently)
+	expect(t, response.Header.Get("Location"), "/assets/docs/?v=1")
+
+	// no index and listing disabled
+	response, _ = staticGet(dbClient, "http://cdn.com/assets/images/", nil)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+
+	// prefix matches whole path segments
+	response, _ = staticGet(dbClient, "http://cdn.com/assets-v2/app.js", nil)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+
+	// other destinations
+	response, _ = staticGet(dbClient, "http://other.com/assets/app.js", nil)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+
+	// files outside of directory
+	response, _ = staticGet(dbClient, "http://cdn.com/assets/../static_test.go", nil)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+}
+
+func TestServeStaticRangeAndConditionalRequests(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dir, cleanup := staticDir(t)
+	defer cleanup()
+	dbClient.Cfg.SetStaticRules([]StaticRule{{Dir: dir, Headers: map[string][]string{"Cache-Control": {"max-age=60"}}}})
+
+	response, body := staticGet(dbClient, "http://cdn.com/app.js", map[string]string{"Range": "bytes=0-6"})
+	expect(t, response.StatusCode, http.StatusPartialContent)
+	expect(t, body, "console")
+	expect(t, response.Header.Get("Content-Range"), "bytes 0-6/19")
+	expect(t, response.Header.Get("Cache-Control"), "max-age=60")
+
+	response, _ = staticGet(dbClient, "http://cdn.com/app.js", nil)
+	etag := response.Header.Get("ETag")
+	lastModified := response.Header.Get("Last-Modified")
+
+	response, body = staticGet(dbClient, "http://cdn.com/app.js", map[string]string{"If-None-Match": etag})
+	expect(t, response.StatusCode, http.StatusNotModified)
+	expect(t, body, "")
+
+	response, _ = staticGet(dbClient, "http://cdn.com/app.js", map[string]string{"If-Modified-Since": lastModified})
+	expect(t, response.StatusCode, http.StatusNotModified)
+
+	req, _ := http.NewRequest("HEAD", "http://cdn.com/images/logo.png", nil)
+	response = dbClient.getResponse(req)
+	expect(t, response.StatusCode, 200)
+	expect(t, response.Header.Get("Content-Length"), "3")
+	expect(t, response.Header.Get("Content-Type"), "image/png")
+}
+
+func TestServeStaticListing(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dir, cleanup := staticDir(t)
+	defer cleanup()
+	dbClient.Cfg.SetStaticRules([]StaticRule{{Dir: dir, Listing: true}})
+
+	response, body := staticGet(dbClient, "http://cdn.com/", nil)
+	expect(t, response.StatusCode, 200)
+	expect(t, response.Header.Get("Content-Type"), "text/html; charset=utf-8")
+	expect(t, strings.Contains(body, `<a href="app.js">app.js</a>`), true)
+	expect(t, strings.Contains(body, `<a href="css/">css/</a>`), true)
+}
+
+func TestServeStaticPrecedence(t *testing.T) {
+	server, dbClient := testTools(200, `recorded`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dir, cleanup := staticDir(t)
+	defer cleanup()
+
+	req, _ := http.NewRequest("GET", "http://cdn.com/app.js", nil)
+	dbClient.captureRequest(req)
+
+	dbClient.Cfg.SetStaticRules([]StaticRule{{Dir: dir}})
+	_, body := staticGet(dbClient, "http://cdn.com/app.js", nil)
+	expect(t, body, "console.log('app');")
+
+	dbClient.Cfg.SetStaticRules([]StaticRule{{Dir: dir, Fallback: true}})
+	_, body = staticGet(dbClient, "http://cdn.com/app.js", nil)
+	expect(t, body, "recorded\n")
+
+	// not recorded, served from fallback directory
+	_, body = staticGet(dbClient, "http://cdn.com/css/site.css", nil)
+	expect(t, body, "body { color: red; }")
+
+	// not recorded and not in directory
+	response, _ := staticGet(dbClient, "http://cdn.com/missing.js", nil)
+	expect(t, response.Header.Get(HoverflyErrorHeader), ErrorKindMiss)
+}
+
+func TestStaticRuleValidate(t *testing.T) {
+	dir, cleanup := staticDir(t)
+	defer cleanup()
+
+	valid := StaticRule{Destination: "cdn.com", PathPrefix: "/assets", Dir: dir}
+	expect(t, valid.Validate(), nil)
+
+	for _, rule := range []StaticRule{
+		{Dir: dir, Destination: "("},
+		{Dir: dir, PathPrefix: "assets"},
+		{Dir: dir, Index: "docs/index.html"},
+		{},
+		{Dir: filepath.Join(dir, "app.js")},
+		{Dir: filepath.Join(dir, "missing")},
+	} {
+		refute(t, rule.Validate(), nil)
+	}
+}
+
+func TestSetStaticRulesConfinedToRoot(t *testing.T) {
+	server, dbClient := testTools(200, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dir, cleanup := staticDir(t)
+	defer cleanup()
+
+	// rules can't be set through the API without static root
+	rec := lockTestRequest(dbClient, "POST", "/static-rules", `{"data":[{"dir":"/"}]}`)
+	expect(t, rec.Code, http.StatusForbidden)
+	expect(t, len(dbClient.Cfg.GetStaticRules()), 0)
+
+	dbClient.Cfg.StaticRoot = filepath.Join(dir, "docs")
+	for _, outside := range []string{"/", "..", filepath.Join(dir, "css")} {
+		rec = lockTestRequest(dbClient, "POST", "/static-rules", `{"data":[{"dir":"`+outside+`"}]}`)
+		expect(t, rec.Code, 400)
+	}
+
+	// directory outside of root linked from it
+	expect(t, os.Symlink(filepath.Join(dir, "css"), filepath.Join(dir, "docs", "css")), nil)
+	rec = lockTestRequest(dbClient, "POST", "/static-rules", `{"data":[{"dir":"css"}]}`)
+	expect(t, rec.Code, 400)
+
+	rec = lockTestRequest(dbClient, "POST", "/static-rules", `{"data":[{"destination":"docs.com","dir":"."}]}`)
+	expect(t, rec.Code, http.StatusOK)
+
+	_, body := staticGet(dbClient, "http://docs.com/index.html", nil)
+	expect(t, body, "<h1>docs</h1>")
+}
@@ -11,6 +11,35 @@ import (
 
 // SynthesizeResponse calls middleware to populate response data, nothing gets pass proxy
 func SynthesizeResponse(req *http.Request, middleware string) (*http.Response, error) {
+	return synthesizeResponse(req, middleware, nil, nil)
+}
+
+// responseGenerator - creates response without middleware
+type responseGenerator func(request RequestDetails) (*ResponseDetails, error)
+
+// synthesizeResponse - synthesizes response for DBClient, reporting results to hooks. Responses are
+// generated from response schemas when middleware isn't configured.
+func (d *DBClient) synthesizeResponse(req *http.Request) (*http.Response, error) {
+	var generate responseGenerator
+	if schemas := d.Cfg.GetResponseSchemas(); len(schemas) > 0 {
+		generate = func(request RequestDetails) (*ResponseDetails, error) {
+			return generateResponse(schemas, d.Faker, request)
+		}
+	}
+	return synthesizeResponse(req, d.Cfg.Middleware, generate, d.fireEvent)
+}
+
+func synthesizeResponse(req *http.Request, middleware string, generate responseGenerator, events eventFunc) (*http.Response, error) {
+	failed := func(request RequestDetails, err error) (*http.Response, error) {
+		if events != nil {
+			events(ActionTypeSynthesizeFailed, "synthesize", EventData{
+				Request:    request,
+				Middleware: middleware,
+				Error:      err.Error(),
+			})
+		}
+		return nil, err
+	}
 
 	// this is mainly for testing, since when you create a request during tests
 	// its body will be nil, that results in bad things during read
@@ -28,7 +57,8 @@ func SynthesizeResponse(req *http.Request, middleware string) (*http.Response, e
 		}).Error("Failed to read request body when synthesizing response")
 
 		// creating new error with more info
-		return nil, fmt.Errorf("Synthesize failed, could not read request body - %s", err.Error())
+		return failed(RequestDetails{Path: req.URL.Path, Method: req.Method, Destination: req.Host},
+			fmt.Errorf("Synthesize failed, could not read request body - %s", err.Error()))
 	}
 
 	bodyStr = string(requestBody)
@@ -51,18 +81,33 @@ func SynthesizeResponse(req *http.Request, middleware string) (*http.Response, e
 	}).Debug("Synthesizing new response")
 
 	c := NewConstructor(req, payload)
+	c.events = events
 
 	if middleware != "" {
 		err := c.ApplyMiddleware(middleware)
 		if err != nil {
-			return nil, fmt.Errorf("Synthesize failed, middleware error - %s", err.Error())
+			return failed(request, fmt.Errorf("Synthesize failed, middleware error - %s", err.Error()))
+		}
+	} else if generate != nil {
+		response, err := generate(request)
+		if err != nil {
+			return failed(request, fmt.Errorf("Synthesize failed, schema error - %s", err.Error()))
 		}
+		c.payload.Response = *response
 	} else {
-		return nil, fmt.Errorf("Synthesize failed, middleware not provided")
+		return failed(request, fmt.Errorf("Synthesize failed, middleware not provided"))
 
 	}
 
 	response := c.ReconstructResponse()
+
+	if events != nil {
+		events(ActionTypeResponseSynthesized, "synthesize", EventData{
+			Request:    request,
+			Response:   &c.payload.Response,
+			Middleware: middleware,
+		})
+	}
 	return response, nil
 
 }
@@ -66,11 +66,15 @@ func testTools(code int, body string) (*httptest.Server, *DBClient) {
 	counter := NewModeCounter()
 	// preparing client
 	dbClient := &DBClient{
-		HTTP:    &http.Client{Transport: tr},
-		Cache:   cache,
-		Cfg:     cfg,
-		Counter: counter,
+		HTTP:     &http.Client{Transport: tr},
+		Cache:    cache,
+		Cfg:      cfg,
+		Counter:  counter,
+		Notifier: NewRequestNotifier(),
+		Journal:  NewJournal(DefaultJournalSize),
+		Logging:  NewLogManager(DefaultLogBufferSize),
 	}
+	dbClient.Callbacks = NewCallbackScheduler(DefaultCallbackWorkers, DefaultCallbackQueueSize)
 	return server, dbClient
 }
 
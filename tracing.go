@@ -0,0 +1,389 @@
+package hoverfly
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// TraceParentHeader - W3C trace context header used to propagate traces
+const TraceParentHeader = "traceparent"
+
+// DefaultTracingServiceName - service name reported with spans when it's not configured
+const DefaultTracingServiceName = "hoverfly"
+
+// span kinds, as defined by OTLP
+const (
+	SpanKindInternal = 1
+	SpanKindServer   = 2
+	SpanKindClient   = 3
+)
+
+// span status codes, as defined by OTLP
+const (
+	spanStatusOk    = 1
+	spanStatusError = 2
+)
+
+const (
+	tracingBatchSize     = 512
+	tracingQueueSize     = 4096
+	tracingFlushInterval = 5 * time.Second
+)
+
+type spanContextKey struct{}
+
+// Span - single timed operation, spans with the same trace ID form a trace
+type Span struct {
+	tracer *Tracer
+
+	TraceID      [16]byte
+	SpanID       [8]byte
+	ParentSpanID [8]byte
+	Name         string
+	Kind         int
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	Error        string
+
+	mu sync.Mutex
+}
+
+// SetAttribute - adds attribute to the span, it's safe to call on nil span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError - marks span as failed, it's safe to call on nil span
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// Finish - ends the span and queues it for export, it's safe to call on nil span
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.End = time.Now()
+	s.mu.Unlock()
+	s.tracer.queue(s)
+}
+
+// StartChild - starts new span with this span as parent, returns nil for nil span
+func (s *Span) StartChild(name string, kind int) *Span {
+	if s == nil {
+		return nil
+	}
+	child := s.tracer.newSpan(name, kind)
+	child.TraceID = s.TraceID
+	child.ParentSpanID = s.SpanID
+	return child
+}
+
+// TraceParent - returns W3C traceparent header value for this span
+func (s *Span) TraceParent() string {
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.TraceID[:]), hex.EncodeToString(s.SpanID[:]))
+}
+
+// Tracer - creates spans and exports them in batches to OTLP/HTTP endpoint
+type Tracer struct {
+	Endpoint    string
+	ServiceName string
+	HTTP        *http.Client
+
+	mu      sync.Mutex
+	pending []*Span
+}
+
+// NewTracer - returns tracer exporting spans to given OTLP/HTTP traces endpoint
+// (i.e. http://localhost:4318/v1/traces)
+func NewTracer(endpoint, serviceName string) *Tracer {
+	if serviceName == "" {
+		serviceName = DefaultTracingServiceName
+	}
+	return &Tracer{
+		Endpoint:    endpoint,
+		ServiceName: serviceName,
+		HTTP:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Init - starts periodic span export
+func (t *Tracer) Init() {
+	go func() {
+		for _ = range time.Tick(tracingFlushInterval) {
+			if err := t.Flush(); err != nil {
+				log.WithFields(log.Fields{
+					"error":    err.Error(),
+					"endpoint": t.Endpoint,
+				}).Warn("failed to export spans")
+			}
+		}
+	}()
+}
+
+func (t *Tracer) newSpan(name string, kind int) *Span {
+	s := &Span{
+		tracer:     t,
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]interface{}),
+	}
+	rand.Read(s.SpanID[:])
+	return s
+}
+
+// StartRequestSpan - starts server span for proxied request, continuing the trace from request traceparent
+// header if there is one. Returns nil when tracer is nil.
+func (t *Tracer) StartRequestSpan(req *http.Request) *Span {
+	if t == nil {
+		return nil
+	}
+
+	s := t.newSpan(fmt.Sprintf("%s %s", req.Method, req.Host), SpanKindServer)
+
+	if traceID, parentID, ok := parseTraceParent(req.Header.Get(TraceParentHeader)); ok {
+		s.TraceID = traceID
+		s.ParentSpanID = parentID
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+
+	s.SetAttribute("http.method", req.Method)
+	s.SetAttribute("http.host", req.Host)
+	s.SetAttribute("http.target", req.URL.RequestURI())
+	return s
+}
+
+func (t *Tracer) queue(s *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) >= tracingQueueSize {
+		// dropping spans instead of growing without limit when collector is not available
+		return
+	}
+	t.pending = append(t.pending, s)
+}
+
+// Flush - exports all pending spans
+func (t *Tracer) Flush() error {
+	t.mu.Lock()
+	pending := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+
+	for len(pending) > 0 {
+		n := len(pending)
+		if n > tracingBatchSize {
+			n = tracingBatchSize
+		}
+		if err := t.export(pending[:n]); err != nil {
+			return err
+		}
+		pending = pending[n:]
+	}
+	return nil
+}
+
+// export - sends spans to OTLP/HTTP endpoint using JSON encoding
+func (t *Tracer) export(spans []*Span) error {
+	body, err := json.Marshal(t.otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.HTTP.Post(t.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+
+	log.WithFields(log.Fields{
+		"spans":    len(spans),
+		"endpoint": t.Endpoint,
+	}).Debug("spans exported")
+	return nil
+}
+
+// OTLP JSON structures
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func newOTLPValue(v interface{}) otlpValue {
+	switch value := v.(type) {
+	case string:
+		return otlpValue{StringValue: &value}
+	case int:
+		s := strconv.Itoa(value)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		return otlpValue{IntValue: &s}
+	case bool:
+		return otlpValue{BoolValue: &value}
+	case float64:
+		return otlpValue{DoubleValue: &value}
+	default:
+		s := fmt.Sprintf("%v", value)
+		return otlpValue{StringValue: &s}
+	}
+}
+
+func (t *Tracer) otlpRequest(spans []*Span) otlpTraceRequest {
+	var exported []otlpSpan
+	for _, s := range spans {
+		s.mu.Lock()
+		es := otlpSpan{
+			TraceID:           hex.EncodeToString(s.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.SpanID[:]),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: spanStatusOk},
+		}
+		if s.ParentSpanID != [8]byte{} {
+			es.ParentSpanID = hex.EncodeToString(s.ParentSpanID[:])
+		}
+		if s.Error != "" {
+			es.Status = otlpStatus{Code: spanStatusError, Message: s.Error}
+		}
+		for k, v := range s.Attributes {
+			es.Attributes = append(es.Attributes, otlpKeyValue{Key: k, Value: newOTLPValue(v)})
+		}
+		s.mu.Unlock()
+		exported = append(exported, es)
+	}
+
+	return otlpTraceRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: []otlpKeyValue{{Key: "service.name", Value: newOTLPValue(t.ServiceName)}},
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{Scope: otlpScope{Name: "hoverfly"}, Spans: exported},
+				},
+			},
+		},
+	}
+}
+
+// parseTraceParent - parses W3C traceparent header value
+func parseTraceParent(value string) (traceID [16]byte, parentID [8]byte, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return
+	}
+
+	tid, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return
+	}
+	pid, err := hex.DecodeString(parts[2])
+	if err != nil {
+		return
+	}
+
+	copy(traceID[:], tid)
+	copy(parentID[:], pid)
+
+	// all zero IDs are invalid
+	if traceID == [16]byte{} || parentID == [8]byte{} {
+		return
+	}
+	return traceID, parentID, true
+}
+
+// requestWithSpan - returns shallow copy of the request carrying given span
+func requestWithSpan(req *http.Request, span *Span) *http.Request {
+	if span == nil {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), spanContextKey{}, span))
+}
+
+// spanFromRequest - returns span carried by the request or nil
+func spanFromRequest(req *http.Request) *Span {
+	if req == nil {
+		return nil
+	}
+	span, _ := req.Context().Value(spanContextKey{}).(*Span)
+	return span
+}
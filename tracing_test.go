@@ -0,0 +1,168 @@
+package hoverfly
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// collectorStandIn - records spans received over OTLP/HTTP
+func collectorStandIn(received *[]otlpSpan) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var tr otlpTraceRequest
+		if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, rs := range tr.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				*received = append(*received, ss.Spans...)
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func spansByName(spans []otlpSpan) map[string]otlpSpan {
+	named := make(map[string]otlpSpan)
+	for _, s := range spans {
+		named[s.Name] = s
+	}
+	return named
+}
+
+func TestParseTraceParent(t *testing.T) {
+	traceID, parentID, ok := parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	expect(t, ok, true)
+	expect(t, traceID[0], byte(0x4b))
+	expect(t, parentID[7], byte(0xb7))
+
+	_, _, ok = parseTraceParent("00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	expect(t, ok, false)
+
+	_, _, ok = parseTraceParent("garbage")
+	expect(t, ok, false)
+}
+
+func TestNilTracerIsNoop(t *testing.T) {
+	var tracer *Tracer
+
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	span := tracer.StartRequestSpan(req)
+	expect(t, span, (*Span)(nil))
+
+	// none of these should panic
+	child := span.StartChild("child", SpanKindInternal)
+	child.SetAttribute("key", "value")
+	child.Finish()
+	span.Finish()
+	expect(t, spanFromRequest(requestWithSpan(req, span)), (*Span)(nil))
+}
+
+func TestCaptureRequestSpans(t *testing.T) {
+	var received []otlpSpan
+	collector := collectorStandIn(&received)
+	defer collector.Close()
+
+	var upstreamTraceParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceParent = r.Header.Get(TraceParentHeader)
+		w.WriteHeader(201)
+	}))
+	defer upstream.Close()
+
+	server, dbClient := testTools(201, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.HTTP = &http.Client{}
+	dbClient.Tracer = NewTracer(collector.URL+"/v1/traces", "test-service")
+	dbClient.Cfg.SetMode(CaptureMode)
+
+	r, err := http.NewRequest("GET", upstream.URL+"/orders", nil)
+	expect(t, err, nil)
+	r.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	_, resp := dbClient.processRequest(r)
+	expect(t, resp.StatusCode, 201)
+
+	err = dbClient.Tracer.Flush()
+	expect(t, err, nil)
+
+	spans := spansByName(received)
+	expect(t, len(spans), 2)
+
+	root, ok := spans["GET "+strings.TrimPrefix(upstream.URL, "http://")]
+	expect(t, ok, true)
+	expect(t, root.TraceID, "4bf92f3577b34da6a3ce929d0e0e4736")
+	expect(t, root.ParentSpanID, "00f067aa0ba902b7")
+	expect(t, root.Kind, SpanKindServer)
+
+	upstreamSpan, ok := spans["upstream GET "+strings.TrimPrefix(upstream.URL, "http://")]
+	expect(t, ok, true)
+	expect(t, upstreamSpan.TraceID, root.TraceID)
+	expect(t, upstreamSpan.ParentSpanID, root.SpanID)
+	expect(t, upstreamSpan.Kind, SpanKindClient)
+
+	// upstream received trace context of the upstream span
+	expect(t, upstreamTraceParent, "00-"+upstreamSpan.TraceID+"-"+upstreamSpan.SpanID+"-01")
+
+	// captured payload keeps trace context sent by the client
+	payloads, err := dbClient.Cache.GetAllRequests()
+	expect(t, err, nil)
+	expect(t, len(payloads), 1)
+	expect(t, http.Header(payloads[0].Request.Headers).Get(TraceParentHeader), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+}
+
+func TestVirtualizeRequestSpans(t *testing.T) {
+	var received []otlpSpan
+	collector := collectorStandIn(&received)
+	defer collector.Close()
+
+	server, dbClient := testTools(201, `{'message': 'here'}`)
+	defer server.Close()
+	defer dbClient.Cache.DeleteData()
+
+	dbClient.Tracer = NewTracer(collector.URL+"/v1/traces", "test-service")
+	dbClient.Cfg.SetMode(VirtualizeMode)
+	dbClient.Cfg.Middleware = "./examples/middleware/modify_response/modify_response.py"
+
+	err := dbClient.ImportPayloads([]Payload{
+		{
+			Request:  RequestDetails{Destination: "traced.com", Path: "/", Method: "GET"},
+			Response: ResponseDetails{Status: 200, Body: "here"},
+		},
+	})
+	expect(t, err, nil)
+
+	r, _ := http.NewRequest("GET", "http://traced.com/", nil)
+	dbClient.processRequest(r)
+
+	missing, _ := http.NewRequest("GET", "http://traced.com/missing", nil)
+	dbClient.processRequest(missing)
+
+	err = dbClient.Tracer.Flush()
+	expect(t, err, nil)
+
+	// two root spans, two cache lookups and one middleware span
+	expect(t, len(received), 5)
+
+	var lookups, middleware, failed int
+	for _, s := range received {
+		switch s.Name {
+		case "cache lookup":
+			lookups++
+		case "middleware":
+			middleware++
+		}
+		if s.Status.Code == spanStatusError {
+			failed++
+		}
+	}
+	expect(t, lookups, 2)
+	expect(t, middleware, 1)
+	// missed request is marked as failed
+	expect(t, failed, 1)
+}
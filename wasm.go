@@ -0,0 +1,262 @@
+package hoverfly
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// WASM middleware is selected with the usual middleware setting, when it points to a ".wasm" file. Modules
+// implement a small ABI, they export their memory and two functions:
+//
+//	alloc(size i32) i32 - returns pointer to a buffer of given size in module memory
+//	handle(ptr i32, len i32) i64 - processes Payload JSON (the same as passed to other middleware) stored at ptr,
+//	    returns pointer (high 32 bits) and length (low 32 bits) of modified Payload JSON
+//
+// Modules may import WASI, they get no filesystem access and their stderr is logged. Instances are pooled and
+// reused between calls, failed instances are discarded.
+const (
+	wasmAllocExport  = "alloc"
+	wasmHandleExport = "handle"
+	wasmPageSize     = 64 * 1024
+)
+
+// WASM middleware defaults
+const (
+	DefaultWASMMemoryLimit = 16 // megabytes
+	DefaultWASMTimeout     = 5 * time.Second
+	DefaultWASMPoolSize    = 4
+)
+
+// WASMLimits - limits of WASM middleware instances
+type WASMLimits struct {
+	// MemoryPages - max memory of an instance in 64KiB pages
+	MemoryPages uint32
+	// Timeout - max duration of a single middleware call
+	Timeout time.Duration
+	// PoolSize - max number of idle instances kept for reuse
+	PoolSize int
+}
+
+func (l WASMLimits) withDefaults() WASMLimits {
+	if l.MemoryPages == 0 {
+		l.MemoryPages = DefaultWASMMemoryLimit * 1024 * 1024 / wasmPageSize
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = DefaultWASMTimeout
+	}
+	if l.PoolSize <= 0 {
+		l.PoolSize = DefaultWASMPoolSize
+	}
+	return l
+}
+
+// wasmModule - compiled WASM middleware module
+type wasmModule interface {
+	Instantiate(ctx context.Context) (wasmInstance, error)
+	Close() error
+}
+
+// wasmInstance - instantiated WASM middleware module, instances are used by one call at a time
+type wasmInstance interface {
+	// Handle - passes payload JSON to module and returns its output and stderr
+	Handle(ctx context.Context, payload []byte) (output, stderr []byte, err error)
+	Close() error
+}
+
+// compileWASM - compiles module with given limits, provided by the runtime Hoverfly was built with
+var compileWASM = func(binary []byte, limits WASMLimits) (wasmModule, error) {
+	return nil, fmt.Errorf("WASM middleware is opt-in and not supported by this build, rebuild Hoverfly with '-tags wazero'")
+}
+
+// wasmPool - idle instances of a module loaded from file
+type wasmPool struct {
+	module  wasmModule
+	limits  WASMLimits
+	modTime time.Time
+	size    int64
+
+	mu     sync.Mutex
+	idle   []wasmInstance
+	active int
+	closed bool
+}
+
+func (p *wasmPool) get(ctx context.Context) (wasmInstance, error) {
+	p.mu.Lock()
+	p.active++
+	if n := len(p.idle); n > 0 {
+		instance := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return instance, nil
+	}
+	p.mu.Unlock()
+
+	instance, err := p.module.Instantiate(ctx)
+	if err != nil {
+		p.release(nil)
+		return nil, err
+	}
+	return instance, nil
+}
+
+// release - returns instance to the pool, instance is closed when it's nil, the pool is full or closed
+func (p *wasmPool) release(instance wasmInstance) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.active--
+	if instance != nil {
+		if !p.closed && len(p.idle) < p.limits.PoolSize {
+			p.idle = append(p.idle, instance)
+		} else {
+			instance.Close()
+		}
+	}
+	if p.closed && p.active == 0 {
+		p.module.Close()
+	}
+}
+
+// close - closes idle instances, module is closed once all active calls finish
+func (p *wasmPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, instance := range p.idle {
+		instance.Close()
+	}
+	p.idle = nil
+	if p.active == 0 {
+		p.module.Close()
+	}
+}
+
+// wasmRegistry - WASM middleware modules by file, modules are reloaded when their file changes
+type wasmRegistry struct {
+	mu      sync.Mutex
+	limits  WASMLimits
+	compile func(binary []byte, limits WASMLimits) (wasmModule, error)
+	pools   map[string]*wasmPool
+}
+
+func newWASMRegistry() *wasmRegistry {
+	return &wasmRegistry{
+		limits:  WASMLimits{}.withDefaults(),
+		compile: func(binary []byte, limits WASMLimits) (wasmModule, error) { return compileWASM(binary, limits) },
+		pools:   make(map[string]*wasmPool),
+	}
+}
+
+var wasmMiddlewares = newWASMRegistry()
+
+// configure - replaces limits, loaded modules are dropped when limits change
+func (r *wasmRegistry) configure(limits WASMLimits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limits = limits.withDefaults()
+	if limits == r.limits {
+		return
+	}
+	r.limits = limits
+	for path, pool := range r.pools {
+		pool.close()
+		delete(r.pools, path)
+	}
+}
+
+// pool - returns pool of module loaded from given file, module is compiled on first use and after file changes
+func (r *wasmRegistry) pool(path string) (*wasmPool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pool, ok := r.pools[path]
+	if ok && pool.modTime.Equal(info.ModTime()) && pool.size == info.Size() {
+		return pool, nil
+	}
+
+	binary, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	module, err := r.compile(binary, r.limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile WASM middleware '%s': %s", path, err.Error())
+	}
+
+	if ok {
+		pool.close()
+	}
+	pool = &wasmPool{module: module, limits: r.limits, modTime: info.ModTime(), size: info.Size()}
+	r.pools[path] = pool
+
+	log.WithFields(log.Fields{
+		"middleware":  path,
+		"memoryPages": r.limits.MemoryPages,
+		"timeout":     r.limits.Timeout,
+		"poolSize":    r.limits.PoolSize,
+	}).Info("WASM middleware loaded")
+
+	return pool, nil
+}
+
+// execute - calls module loaded from given file with payload JSON
+func (r *wasmRegistry) execute(path string, payload []byte) (output, stderr []byte, err error) {
+	pool, err := r.pool(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pool.limits.Timeout)
+	defer cancel()
+
+	instance, err := pool.get(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to instantiate WASM middleware: %s", err.Error())
+	}
+
+	output, stderr, err = instance.Handle(ctx, payload)
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("WASM middleware timed out after %s", pool.limits.Timeout)
+	}
+
+	// failed instances might be left in inconsistent state, so they are not reused
+	if err != nil {
+		instance.Close()
+		pool.release(nil)
+		return nil, stderr, err
+	}
+	pool.release(instance)
+	return output, stderr, nil
+}
+
+// IsWASMMiddleware - checks whether middleware setting points to a WASM module
+func IsWASMMiddleware(middleware string) bool {
+	fields := strings.Fields(middleware)
+	return len(fields) > 0 && strings.HasSuffix(strings.ToLower(fields[0]), ".wasm")
+}
+
+// ConfigureWASMMiddleware - sets limits of WASM middleware instances
+func ConfigureWASMMiddleware(limits WASMLimits) {
+	wasmMiddlewares.configure(limits)
+}
+
+// LoadWASMMiddleware - compiles WASM middleware ahead of first request, so invalid modules are reported early
+func LoadWASMMiddleware(middleware string) error {
+	_, err := wasmMiddlewares.pool(strings.Fields(middleware)[0])
+	return err
+}
@@ -0,0 +1,220 @@
+package hoverfly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeWASMModule - stands in for a compiled module, its instances set response body to the binary content
+type fakeWASMModule struct {
+	binary []byte
+	delay  time.Duration
+	fail   bool
+
+	mu           sync.Mutex
+	instantiated int
+	closed       int
+	moduleClosed bool
+}
+
+func (m *fakeWASMModule) Instantiate(ctx context.Context) (wasmInstance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.instantiated++
+	return &fakeWASMInstance{module: m}, nil
+}
+
+func (m *fakeWASMModule) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.moduleClosed = true
+	return nil
+}
+
+type fakeWASMInstance struct {
+	module *fakeWASMModule
+}
+
+func (i *fakeWASMInstance) Handle(ctx context.Context, payload []byte) ([]byte, []byte, error) {
+	if i.module.fail {
+		return nil, []byte("panic"), fmt.Errorf("wasm trap")
+	}
+	select {
+	case <-time.After(i.module.delay):
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+
+	var p Payload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, nil, err
+	}
+	p.Response.Body = string(i.module.binary)
+	out, err := json.Marshal(p)
+	return out, nil, err
+}
+
+func (i *fakeWASMInstance) Close() error {
+	i.module.mu.Lock()
+	defer i.module.mu.Unlock()
+	i.module.closed++
+	return nil
+}
+
+func fakeWASMRegistry(limits WASMLimits, configure func(m *fakeWASMModule)) (*wasmRegistry, *[]*fakeWASMModule) {
+	var modules []*fakeWASMModule
+	r := newWASMRegistry()
+	r.configure(limits)
+	r.compile = func(binary []byte, limits WASMLimits) (wasmModule, error) {
+		m := &fakeWASMModule{binary: binary}
+		if configure != nil {
+			configure(m)
+		}
+		modules = append(modules, m)
+		return m, nil
+	}
+	return r, &modules
+}
+
+func wasmFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "hoverfly-wasm")
+	expect(t, err, nil)
+	path := filepath.Join(dir, "middleware.wasm")
+	expect(t, ioutil.WriteFile(path, []byte(content), 0600), nil)
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestIsWASMMiddleware(t *testing.T) {
+	expect(t, IsWASMMiddleware("./middleware.wasm"), true)
+	expect(t, IsWASMMiddleware("/opt/MW.WASM"), true)
+	expect(t, IsWASMMiddleware("python middleware.py"), false)
+	expect(t, IsWASMMiddleware(""), false)
+}
+
+func TestWASMMiddlewareReusesInstances(t *testing.T) {
+	path, cleanup := wasmFile(t, "from wasm")
+	defer cleanup()
+
+	registry, modules := fakeWASMRegistry(WASMLimits{PoolSize: 1}, nil)
+	payload, _ := json.Marshal(Payload{Response: ResponseDetails{Status: 200, Body: "original"}})
+
+	for i := 0; i < 3; i++ {
+		out, _, err := registry.execute(path, payload)
+		expect(t, err, nil)
+
+		var p Payload
+		expect(t, json.Unmarshal(out, &p), nil)
+		expect(t, p.Response.Body, "from wasm")
+	}
+
+	expect(t, len(*modules), 1)
+	expect(t, (*modules)[0].instantiated, 1)
+}
+
+func TestWASMMiddlewarePoolSize(t *testing.T) {
+	path, cleanup := wasmFile(t, "from wasm")
+	defer cleanup()
+
+	registry, modules := fakeWASMRegistry(WASMLimits{PoolSize: 2}, func(m *fakeWASMModule) {
+		m.delay = 50 * time.Millisecond
+	})
+	payload, _ := json.Marshal(Payload{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry.execute(path, payload)
+		}()
+	}
+	wg.Wait()
+
+	module := (*modules)[0]
+	expect(t, module.instantiated, 5)
+	// only pool size instances are kept
+	expect(t, module.closed, 3)
+}
+
+func TestWASMMiddlewareDiscardsFailedInstances(t *testing.T) {
+	path, cleanup := wasmFile(t, "from wasm")
+	defer cleanup()
+
+	registry, modules := fakeWASMRegistry(WASMLimits{}, func(m *fakeWASMModule) {
+		m.fail = true
+	})
+
+	_, stderr, err := registry.execute(path, []byte("{}"))
+	refute(t, err, nil)
+	expect(t, string(stderr), "panic")
+	expect(t, (*modules)[0].closed, 1)
+}
+
+func TestWASMMiddlewareTimeout(t *testing.T) {
+	path, cleanup := wasmFile(t, "from wasm")
+	defer cleanup()
+
+	registry, modules := fakeWASMRegistry(WASMLimits{Timeout: 10 * time.Millisecond}, func(m *fakeWASMModule) {
+		m.delay = time.Second
+	})
+
+	_, _, err := registry.execute(path, []byte("{}"))
+	refute(t, err, nil)
+	expect(t, err.Error(), "WASM middleware timed out after 10ms")
+	expect(t, (*modules)[0].closed, 1)
+}
+
+func TestWASMMiddlewareReloadsChangedModule(t *testing.T) {
+	path, cleanup := wasmFile(t, "first")
+	defer cleanup()
+
+	registry, modules := fakeWASMRegistry(WASMLimits{}, nil)
+	payload, _ := json.Marshal(Payload{})
+
+	_, _, err := registry.execute(path, payload)
+	expect(t, err, nil)
+
+	expect(t, ioutil.WriteFile(path, []byte("second version"), 0600), nil)
+	out, _, err := registry.execute(path, payload)
+	expect(t, err, nil)
+
+	var p Payload
+	expect(t, json.Unmarshal(out, &p), nil)
+	expect(t, p.Response.Body, "second version")
+	expect(t, len(*modules), 2)
+	expect(t, (*modules)[0].moduleClosed, true)
+}
+
+func TestExecuteWASMMiddleware(t *testing.T) {
+	path, cleanup := wasmFile(t, "from wasm")
+	defer cleanup()
+
+	registry, _ := fakeWASMRegistry(WASMLimits{}, nil)
+	defer func(r *wasmRegistry) { wasmMiddlewares = r }(wasmMiddlewares)
+	wasmMiddlewares = registry
+
+	payload, err := ExecuteMiddleware(path, Payload{Response: ResponseDetails{Status: 201, Body: "original"}})
+	expect(t, err, nil)
+	expect(t, payload.Response.Status, 201)
+	expect(t, payload.Response.Body, "from wasm")
+}
+
+func TestWASMMiddlewareNotSupported(t *testing.T) {
+	path, cleanup := wasmFile(t, "from wasm")
+	defer cleanup()
+
+	registry := newWASMRegistry()
+	registry.compile = func(binary []byte, limits WASMLimits) (wasmModule, error) {
+		return nil, fmt.Errorf("not supported")
+	}
+
+	_, _, err := registry.execute(path, []byte("{}"))
+	refute(t, err, nil)
+}
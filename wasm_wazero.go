@@ -0,0 +1,129 @@
+//go:build wazero
+// +build wazero
+
+package hoverfly
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WASM middleware runs on wazero, a pure Go runtime, so no interpreters are needed in the container
+
+func init() {
+	compileWASM = compileWazeroModule
+}
+
+type wazeroModule struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+}
+
+func compileWazeroModule(binary []byte, limits WASMLimits) (wasmModule, error) {
+	ctx := context.Background()
+
+	// closing module when context is done stops calls running over timeout
+	config := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(limits.MemoryPages).
+		WithCloseOnContextDone(true)
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+
+	compiled, err := runtime.CompileModule(ctx, binary)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+
+	exports := compiled.ExportedFunctions()
+	for _, name := range []string{wasmAllocExport, wasmHandleExport} {
+		if _, ok := exports[name]; !ok {
+			runtime.Close(ctx)
+			return nil, fmt.Errorf("module doesn't export '%s' function", name)
+		}
+	}
+	if len(compiled.ExportedMemories()) == 0 {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("module doesn't export memory")
+	}
+
+	return &wazeroModule{runtime: runtime, compiled: compiled}, nil
+}
+
+func (m *wazeroModule) Instantiate(ctx context.Context) (wasmInstance, error) {
+	stderr := new(bytes.Buffer)
+
+	// instances are anonymous, so the same module can be instantiated more than once. Reactor modules
+	// (i.e. TinyGo or Rust wasi builds) are initialized with "_initialize", missing start functions are skipped.
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithStderr(stderr).
+		WithStartFunctions("_initialize")
+
+	module, err := m.runtime.InstantiateModule(ctx, m.compiled, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wazeroInstance{
+		module: module,
+		alloc:  module.ExportedFunction(wasmAllocExport),
+		handle: module.ExportedFunction(wasmHandleExport),
+		stderr: stderr,
+	}, nil
+}
+
+func (m *wazeroModule) Close() error {
+	return m.runtime.Close(context.Background())
+}
+
+type wazeroInstance struct {
+	module api.Module
+	alloc  api.Function
+	handle api.Function
+	stderr *bytes.Buffer
+}
+
+func (i *wazeroInstance) Handle(ctx context.Context, payload []byte) (output, stderr []byte, err error) {
+	i.stderr.Reset()
+	defer func() {
+		stderr = append([]byte{}, i.stderr.Bytes()...)
+	}()
+
+	results, err := i.alloc.Call(ctx, uint64(len(payload)))
+	if err != nil {
+		return nil, nil, err
+	}
+	ptr := uint32(results[0])
+
+	memory := i.module.Memory()
+	if !memory.Write(ptr, payload) {
+		return nil, nil, fmt.Errorf("allocated buffer %d+%d is out of memory range", ptr, len(payload))
+	}
+
+	results, err = i.handle.Call(ctx, uint64(ptr), uint64(len(payload)))
+	if err != nil {
+		return nil, nil, err
+	}
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+
+	out, ok := memory.Read(outPtr, outLen)
+	if !ok {
+		return nil, nil, fmt.Errorf("output %d+%d is out of memory range", outPtr, outLen)
+	}
+	// memory view is only valid until next call
+	return append([]byte{}, out...), nil, nil
+}
+
+func (i *wazeroInstance) Close() error {
+	return i.module.Close(context.Background())
+}
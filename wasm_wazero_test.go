@@ -0,0 +1,144 @@
+//go:build wazero
+// +build wazero
+
+package hoverfly
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+const wasmOutputOffset = 16
+
+// leb128 - unsigned LEB128 encoding used for sizes and indexes in WASM binaries
+func leb128(v uint64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			out = append(out, b|0x80)
+			continue
+		}
+		return append(out, b)
+	}
+}
+
+// sleb128 - signed LEB128 encoding used for constants in WASM binaries
+func sleb128(v int64) []byte {
+	var out []byte
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func wasmVec(items ...[]byte) []byte {
+	out := leb128(uint64(len(items)))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func wasmSection(id byte, content []byte) []byte {
+	return append(append([]byte{id}, leb128(uint64(len(content)))...), content...)
+}
+
+func wasmName(name string) []byte {
+	return append(leb128(uint64(len(name))), name...)
+}
+
+func wasmBody(instructions ...byte) []byte {
+	body := append([]byte{0x00}, instructions...)
+	return append(leb128(uint64(len(body))), body...)
+}
+
+// testWASMModule - builds a module implementing middleware ABI. Its memory starts with given number of pages,
+// alloc returns fixed buffer and handle returns output stored in a data segment, or never returns when loop is set.
+func testWASMModule(memoryPages uint64, output string, loop bool) []byte {
+	allocBody := append(append([]byte{0x41}, sleb128(1024)...), 0x0b)
+
+	var handleBody []byte
+	if loop {
+		// loop { br 0 }; unreachable
+		handleBody = []byte{0x03, 0x40, 0x0c, 0x00, 0x0b, 0x00, 0x0b}
+	} else {
+		result := int64(wasmOutputOffset)<<32 | int64(len(output))
+		handleBody = append(append([]byte{0x42}, sleb128(result)...), 0x0b)
+	}
+
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	module = append(module, wasmSection(1, wasmVec(
+		[]byte{0x60, 0x01, 0x7f, 0x01, 0x7f},       // (i32) -> i32
+		[]byte{0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e}, // (i32, i32) -> i64
+	))...)
+	module = append(module, wasmSection(3, wasmVec([]byte{0x00}, []byte{0x01}))...)
+	module = append(module, wasmSection(5, wasmVec(append([]byte{0x00}, leb128(memoryPages)...)))...)
+	module = append(module, wasmSection(7, wasmVec(
+		append(wasmName("memory"), 0x02, 0x00),
+		append(wasmName(wasmAllocExport), 0x00, 0x00),
+		append(wasmName(wasmHandleExport), 0x00, 0x01),
+	))...)
+	module = append(module, wasmSection(10, wasmVec(wasmBody(allocBody...), wasmBody(handleBody...)))...)
+
+	offset := append(append([]byte{0x41}, sleb128(wasmOutputOffset)...), 0x0b)
+	segment := append(append([]byte{0x00}, offset...), wasmName(output)...)
+	module = append(module, wasmSection(11, wasmVec(segment))...)
+	return module
+}
+
+func wazeroRegistry(limits WASMLimits) func() {
+	registry := newWASMRegistry()
+	registry.configure(limits)
+	previous := wasmMiddlewares
+	wasmMiddlewares = registry
+	return func() { wasmMiddlewares = previous }
+}
+
+func TestWazeroMiddleware(t *testing.T) {
+	path, cleanup := wasmFile(t, string(testWASMModule(1, `{"response":{"status":201,"body":"from wasm"}}`, false)))
+	defer cleanup()
+	defer wazeroRegistry(WASMLimits{})()
+
+	for i := 0; i < 2; i++ {
+		payload, err := ExecuteMiddleware(path, Payload{Response: ResponseDetails{Status: 200, Body: "original"}})
+		expect(t, err, nil)
+		expect(t, payload.Response.Status, 201)
+		expect(t, payload.Response.Body, "from wasm")
+	}
+}
+
+func TestWazeroMiddlewareTimeout(t *testing.T) {
+	path, cleanup := wasmFile(t, string(testWASMModule(1, "", true)))
+	defer cleanup()
+	defer wazeroRegistry(WASMLimits{Timeout: 50 * time.Millisecond})()
+
+	start := time.Now()
+	_, err := ExecuteMiddleware(path, Payload{})
+	refute(t, err, nil)
+	expect(t, err.Error(), "WASM middleware timed out after 50ms")
+	expect(t, time.Since(start) < 5*time.Second, true)
+}
+
+func TestWazeroMiddlewareMemoryLimit(t *testing.T) {
+	// 32 pages (2MB) are over 1MB limit
+	path, cleanup := wasmFile(t, string(testWASMModule(32, `{}`, false)))
+	defer cleanup()
+	defer wazeroRegistry(WASMLimits{MemoryPages: 16})()
+
+	_, err := ExecuteMiddleware(path, Payload{})
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), "over limit of 16 pages"), true)
+
+	// module within limit is loaded once file changes
+	expect(t, ioutil.WriteFile(path, testWASMModule(16, `{"response":{}}`, false), 0600), nil)
+	_, err = ExecuteMiddleware(path, Payload{})
+	expect(t, err, nil)
+}